@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"toyopuc/toyopuc"
+)
+
+// typeHex 以16进制显示的字 仅命令行使用
+const typeHex toyopuc.DataType = "hex"
+
+// codec 值与 Read/Write 数据的转换
+type codec struct {
+	typ   toyopuc.DataType
+	order toyopuc.WordOrder
+	// 每个值占用的单位 (字、字节或位) 数
+	step int
+}
+
+// newCodec 按地址检查数据类型 未指定时 位为 bool，字节为 uint8，字为 uint16
+func newCodec(typ string, order toyopuc.WordOrder, addr *toyopuc.Address) (c *codec, err error) {
+	c = &codec{typ: toyopuc.DataType(typ), order: order, step: 1}
+	if c.typ == "" {
+		switch addr.Unit {
+		case toyopuc.UnitBit:
+			c.typ = toyopuc.TypeBool
+		case toyopuc.UnitByte:
+			c.typ = toyopuc.TypeUint8
+		default:
+			c.typ = toyopuc.TypeUint16
+		}
+	}
+	var ok bool
+	switch c.typ {
+	case toyopuc.TypeBool:
+		ok = addr.Unit == toyopuc.UnitBit
+	case toyopuc.TypeUint8:
+		ok = addr.Unit == toyopuc.UnitByte
+	case toyopuc.TypeUint16, toyopuc.TypeInt16, toyopuc.TypeBCD, typeHex:
+		ok = addr.Unit == toyopuc.UnitWord
+	case toyopuc.TypeUint32, toyopuc.TypeInt32, toyopuc.TypeFloat32:
+		ok = addr.Unit == toyopuc.UnitWord
+		c.step = 2
+	case toyopuc.TypeString:
+		ok = addr.Unit == toyopuc.UnitWord
+	default:
+		return nil, fmt.Errorf("toyopuc: unknown type '%v'", typ)
+	}
+	if !ok {
+		return nil, fmt.Errorf("toyopuc: type '%v' cannot be used with '%v' (%v access)", c.typ, addr, addr.Unit)
+	}
+	return
+}
+
+// quantity n 个值的 Read 个数 字符串为 n 个字的一个值
+func (c *codec) quantity(n int) int {
+	return n * c.step
+}
+
+// decode Read 的数据转为值
+func (c *codec) decode(data []byte) (values []interface{}, err error) {
+	switch c.typ {
+	case toyopuc.TypeBool:
+		for _, b := range data {
+			values = append(values, b != 0)
+		}
+	case toyopuc.TypeUint8:
+		for _, b := range data {
+			values = append(values, b)
+		}
+	case toyopuc.TypeUint16:
+		for _, v := range toyopuc.DecodeUint16s(data) {
+			values = append(values, v)
+		}
+	case typeHex:
+		for _, v := range toyopuc.DecodeUint16s(data) {
+			values = append(values, fmt.Sprintf("%04X", v))
+		}
+	case toyopuc.TypeInt16:
+		for _, v := range toyopuc.DecodeInt16s(data) {
+			values = append(values, v)
+		}
+	case toyopuc.TypeUint32:
+		var u32 []uint32
+		if u32, err = toyopuc.DecodeUint32s(data, c.order); err != nil {
+			return
+		}
+		for _, v := range u32 {
+			values = append(values, v)
+		}
+	case toyopuc.TypeInt32:
+		var i32 []int32
+		if i32, err = toyopuc.DecodeInt32s(data, c.order); err != nil {
+			return
+		}
+		for _, v := range i32 {
+			values = append(values, v)
+		}
+	case toyopuc.TypeFloat32:
+		var f32 []float32
+		if f32, err = toyopuc.DecodeFloat32s(data, c.order); err != nil {
+			return
+		}
+		for _, v := range f32 {
+			values = append(values, v)
+		}
+	case toyopuc.TypeBCD:
+		var bcd []uint16
+		if bcd, err = toyopuc.DecodeBCDs(data); err != nil {
+			return
+		}
+		for _, v := range bcd {
+			values = append(values, v)
+		}
+	case toyopuc.TypeString:
+		var s string
+		if s, err = toyopuc.DecodeString(data); err != nil {
+			return
+		}
+		values = append(values, s)
+	}
+	return
+}
+
+// encode 命令行的值转为 Write 的数据
+// 整数可以使用 0x 前缀，bool 可以使用 1/0 on/off true/false
+func (c *codec) encode(args []string) (data []byte, err error) {
+	var words []uint16
+	switch c.typ {
+	case toyopuc.TypeBool:
+		for _, a := range args {
+			var b bool
+			if b, err = parseBool(a); err != nil {
+				return
+			}
+			if b {
+				data = append(data, 1)
+			} else {
+				data = append(data, 0)
+			}
+		}
+		return
+	case toyopuc.TypeUint8:
+		for _, a := range args {
+			var v uint64
+			if v, err = strconv.ParseUint(a, 0, 8); err != nil {
+				return
+			}
+			data = append(data, byte(v))
+		}
+		return
+	case toyopuc.TypeUint16, typeHex:
+		base := 0
+		if c.typ == typeHex {
+			base = 16
+		}
+		for _, a := range args {
+			if base == 16 {
+				a = strings.TrimPrefix(strings.TrimPrefix(a, "0x"), "0X")
+			}
+			var v uint64
+			if v, err = strconv.ParseUint(a, base, 16); err != nil {
+				return
+			}
+			words = append(words, uint16(v))
+		}
+	case toyopuc.TypeInt16:
+		var value []int16
+		for _, a := range args {
+			var v int64
+			if v, err = strconv.ParseInt(a, 0, 16); err != nil {
+				return
+			}
+			value = append(value, int16(v))
+		}
+		words = toyopuc.EncodeInt16s(value)
+	case toyopuc.TypeUint32:
+		var value []uint32
+		for _, a := range args {
+			var v uint64
+			if v, err = strconv.ParseUint(a, 0, 32); err != nil {
+				return
+			}
+			value = append(value, uint32(v))
+		}
+		words = toyopuc.EncodeUint32s(value, c.order)
+	case toyopuc.TypeInt32:
+		var value []int32
+		for _, a := range args {
+			var v int64
+			if v, err = strconv.ParseInt(a, 0, 32); err != nil {
+				return
+			}
+			value = append(value, int32(v))
+		}
+		words = toyopuc.EncodeInt32s(value, c.order)
+	case toyopuc.TypeFloat32:
+		var value []float32
+		for _, a := range args {
+			var v float64
+			if v, err = strconv.ParseFloat(a, 32); err != nil {
+				return
+			}
+			value = append(value, float32(v))
+		}
+		words = toyopuc.EncodeFloat32s(value, c.order)
+	case toyopuc.TypeBCD:
+		var value []uint16
+		for _, a := range args {
+			var v uint64
+			if v, err = strconv.ParseUint(a, 10, 16); err != nil {
+				return
+			}
+			value = append(value, uint16(v))
+		}
+		if words, err = toyopuc.EncodeBCDs(value); err != nil {
+			return
+		}
+	case toyopuc.TypeString:
+		s := strings.Join(args, " ")
+		if words, err = toyopuc.EncodeString(s, (len(s)+1)/2); err != nil {
+			return
+		}
+	}
+	return toyopuc.WordBytes(words), nil
+}
+
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "1", "on", "true":
+		return true, nil
+	case "0", "off", "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("toyopuc: '%v' is not a bool value", s)
+}
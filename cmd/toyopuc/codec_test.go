@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"toyopuc/toyopuc"
+)
+
+func TestCodec(t *testing.T) {
+	tests := []struct {
+		typ     string
+		order   toyopuc.WordOrder
+		address string
+		args    []string
+		data    []byte
+		// 解码后的值
+		values string
+	}{
+		{address: "M0010", args: []string{"1", "off", "TRUE", "0"}, data: []byte{1, 0, 1, 0}, values: "[true false true false]"},
+		{address: "D0100L", args: []string{"0x12", "255"}, data: []byte{0x12, 0xFF}, values: "[18 255]"},
+		{address: "D0100", args: []string{"0x1234", "65535"}, data: []byte{0x34, 0x12, 0xFF, 0xFF}, values: "[4660 65535]"},
+		{typ: "hex", address: "D0100", args: []string{"ABCD", "0x12"}, data: []byte{0xCD, 0xAB, 0x12, 0x00}, values: "[ABCD 0012]"},
+		{typ: "int16", address: "D0100", args: []string{"-2", "0x7FFF"}, data: []byte{0xFE, 0xFF, 0xFF, 0x7F}, values: "[-2 32767]"},
+		{typ: "uint32", address: "D0100", args: []string{"0x12345678"}, data: []byte{0x78, 0x56, 0x34, 0x12}, values: "[305419896]"},
+		{typ: "uint32", order: toyopuc.ABCD, address: "D0100", args: []string{"0x12345678"}, data: []byte{0x34, 0x12, 0x78, 0x56}, values: "[305419896]"},
+		{typ: "int32", address: "D0100", args: []string{"-2"}, data: []byte{0xFE, 0xFF, 0xFF, 0xFF}, values: "[-2]"},
+		{typ: "float32", order: toyopuc.ABCD, address: "D0100", args: []string{"1.5"}, data: []byte{0xC0, 0x3F, 0x00, 0x00}, values: "[1.5]"},
+		{typ: "bcd", address: "D0100", args: []string{"1234", "9999"}, data: []byte{0x34, 0x12, 0x99, 0x99}, values: "[1234 9999]"},
+		{typ: "string", address: "D0100", args: []string{"AB", "C"}, data: []byte{0x41, 0x42, 0x20, 0x43}, values: "[AB C]"},
+		{typ: "string", address: "D0100", args: []string{"ABC"}, data: []byte{0x41, 0x42, 0x43, 0x00}, values: "[ABC]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.typ+" "+strings.Join(tt.args, " "), func(t *testing.T) {
+			addr, err := toyopuc.ParseAddress(tt.address)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c, err := newCodec(tt.typ, tt.order, addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := c.encode(tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, tt.data) {
+				t.Errorf("encode(%v) = % x, want % x", tt.args, data, tt.data)
+			}
+			values, err := c.decode(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprint(values); got != tt.values {
+				t.Errorf("decode(% x) = %v, want %v", data, got, tt.values)
+			}
+		})
+	}
+}
+
+func TestCodecErrors(t *testing.T) {
+	tests := []struct {
+		typ     string
+		address string
+		args    []string
+	}{
+		{typ: "bool", address: "D0100"},
+		{typ: "uint8", address: "D0100"},
+		{typ: "hex", address: "M0010"},
+		{typ: "int32", address: "D0100L"},
+		{typ: "uint64", address: "D0100"},
+		{address: "M0010", args: []string{"2"}},
+		{address: "D0100L", args: []string{"256"}},
+		{address: "D0100", args: []string{"-1"}},
+		{typ: "hex", address: "D0100", args: []string{"12345"}},
+		{typ: "int16", address: "D0100", args: []string{"40000"}},
+		{typ: "uint32", address: "D0100", args: []string{"0x100000000"}},
+		{typ: "float32", address: "D0100", args: []string{"x"}},
+		{typ: "bcd", address: "D0100", args: []string{"12a"}},
+		{typ: "bcd", address: "D0100", args: []string{"10000"}},
+		{typ: "string", address: "D0100", args: []string{"\xe9"}},
+	}
+	for _, tt := range tests {
+		addr, err := toyopuc.ParseAddress(tt.address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := newCodec(tt.typ, toyopuc.CDAB, addr)
+		if err == nil {
+			_, err = c.encode(tt.args)
+		}
+		if err == nil {
+			t.Errorf("%v %v %v succeeded", tt.typ, tt.address, tt.args)
+		}
+	}
+	// 无效的 BCD 读出值
+	addr, _ := toyopuc.ParseAddress("D0100")
+	c, err := newCodec("bcd", toyopuc.CDAB, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.decode([]byte{0x0A, 0x00}); err == nil {
+		t.Error("decode of invalid BCD succeeded")
+	}
+	// 不完整的32位值
+	if c, err = newCodec("uint32", toyopuc.CDAB, addr); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.decode(make([]byte, 6)); !errors.Is(err, toyopuc.ErrLength) {
+		t.Errorf("decode of 3 words error = %v, want %v", err, toyopuc.ErrLength)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// runStatus status
+func runStatus(args []string) (err error) {
+	var o options
+	fs := newFlagSet("status", &o)
+	fs.Lookup("format").Usage = "output `format`: table or json"
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return
+	}
+	if len(positional) != 0 {
+		return fmt.Errorf("usage: toyopuc status [flags]")
+	}
+	client, closer := o.dial()
+	defer closer.Close()
+
+	status, err := client.ReadCPUStatus()
+	if err != nil {
+		return
+	}
+	switch o.format {
+	case formatJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(status)
+	case formatTable:
+		mode := "STOP"
+		if status.Run {
+			mode = "RUN"
+		}
+		fmt.Printf("%v\t% X\n%v\n", mode, status.Raw, status)
+		return
+	}
+	return fmt.Errorf("toyopuc: unknown output format '%v'", o.format)
+}
+
+// runRunStop run / stop
+func runRunStop(name string) func(args []string) error {
+	return func(args []string) (err error) {
+		var o options
+		fs := newFlagSet(name, &o)
+		positional, err := parseArgs(fs, args)
+		if err != nil {
+			return
+		}
+		if len(positional) != 0 {
+			return fmt.Errorf("usage: toyopuc %v [flags]", name)
+		}
+		client, closer := o.dial()
+		defer closer.Close()
+
+		if name == "run" {
+			return client.RunCPU()
+		}
+		return client.StopCPU()
+	}
+}
+
+// runClock clock [-sync]
+func runClock(args []string) (err error) {
+	var o options
+	fs := newFlagSet("clock", &o)
+	sync := fs.Bool("sync", false, "set the PLC clock to the host time")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return
+	}
+	if len(positional) != 0 {
+		return fmt.Errorf("usage: toyopuc clock [-sync] [flags]")
+	}
+	client, closer := o.dial()
+	defer closer.Close()
+
+	if *sync {
+		drift, err := client.SyncClock()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("drift %v\n", drift)
+		return nil
+	}
+	t, err := client.ReadClock()
+	if err != nil {
+		return
+	}
+	fmt.Printf("%v (drift %v)\n", t.Format("2006-01-02 15:04:05 Mon"), t.Sub(time.Now().Truncate(time.Second)))
+	return
+}
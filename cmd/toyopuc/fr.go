@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"toyopuc/toyopuc"
+)
+
+// blockList -block 0,1,FR3F 逗号分隔的 FR 块号 (十六进制)
+func blockList(s string) (blocks []int, err error) {
+	if s == "" {
+		return
+	}
+	for _, b := range strings.Split(s, ",") {
+		b = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(b)), "FR")
+		var n int64
+		if n, err = strconv.ParseInt(b, 16, 0); err != nil {
+			return nil, fmt.Errorf("toyopuc: invalid fr block '%v'", b)
+		}
+		blocks = append(blocks, int(n))
+	}
+	return
+}
+
+// runFRExport fr-export FILE
+func runFRExport(args []string) (err error) {
+	var o options
+	fs := newFlagSet("fr-export", &o)
+	block := fs.String("block", "", "comma separated hex fr `blocks` to export (default all 00-3F)")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: toyopuc fr-export FILE [-block 0,1] [flags]")
+	}
+	blocks, err := blockList(*block)
+	if err != nil {
+		return
+	}
+	client, closer := o.dial()
+	defer closer.Close()
+
+	snapshot, err := toyopuc.ExportFR(client, &toyopuc.FROptions{Blocks: blocks, Progress: progress})
+	if err != nil {
+		return
+	}
+	f, err := os.Create(positional[0])
+	if err != nil {
+		return
+	}
+	defer func() {
+		if e := f.Close(); err == nil {
+			err = e
+		}
+	}()
+	_, err = snapshot.WriteTo(f)
+	return
+}
+
+// runFRImport fr-import FILE
+func runFRImport(args []string) (err error) {
+	var o options
+	fs := newFlagSet("fr-import", &o)
+	block := fs.String("block", "", "comma separated hex fr `blocks` to import (default all in the file)")
+	noCommit := fs.Bool("no-commit", false, "write fr RAM only, without registering to flash")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: toyopuc fr-import FILE [-block 0,1] [-no-commit] [flags]")
+	}
+	blocks, err := blockList(*block)
+	if err != nil {
+		return
+	}
+	snapshot, err := readSnapshot(positional[0])
+	if err != nil {
+		return
+	}
+	client, closer := o.dial()
+	defer closer.Close()
+
+	return toyopuc.ImportFR(client, snapshot, &toyopuc.FROptions{Blocks: blocks, NoCommit: *noCommit, Progress: progress})
+}
@@ -0,0 +1,487 @@
+// Command toyopuc reads, writes and monitors TOYOPUC devices over computer link.
+//
+// Usage:
+//
+//	toyopuc read D0100 10 --type int32
+//	toyopuc write M0010 1
+//	toyopuc monitor D0100..D0110 --interval 200ms
+//	toyopuc dump P1-D0000 4096 -o file
+//	toyopuc backup plc.snap
+//	toyopuc restore plc.snap -area IO,P1 -dry-run
+//	toyopuc diff plc.snap -ignore T,C,N
+//	toyopuc status
+//	toyopuc clock -sync
+//	toyopuc fr-export recipes.snap -block 0,1
+//
+// 通用参数 -host -udp -timeout -format -order -v 可以放在子命令的参数之间
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"toyopuc/toyopuc"
+)
+
+// 子命令
+var commands = map[string]func(args []string) error{
+	"read":    runRead,
+	"write":   runWrite,
+	"monitor": runMonitor,
+	"dump":    runDump,
+	"backup":  runBackup,
+	"restore": runRestore,
+	"diff":    runDiff,
+	"status":  runStatus,
+	"run":     runRunStop("run"),
+	"stop":    runRunStop("stop"),
+	"clock":   runClock,
+
+	"fr-export": runFRExport,
+	"fr-import": runFRImport,
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	run, ok := commands[os.Args[1]]
+	if !ok {
+		if os.Args[1] != "help" && os.Args[1] != "-h" && os.Args[1] != "--help" {
+			fmt.Fprintf(os.Stderr, "toyopuc: unknown command '%v'\n", os.Args[1])
+		}
+		usage()
+		os.Exit(2)
+	}
+	if err := run(os.Args[2:]); err != nil {
+		if err == flag.ErrHelp {
+			os.Exit(2)
+		}
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprint(os.Stderr, `usage: toyopuc <command> [arguments] [flags]
+
+commands:
+  read ADDRESS [N]          读出 N 个值 (默认 1)
+  write ADDRESS VALUE...    写入
+  monitor ADDRESS[..END]... 监视变化的值 Ctrl-C 结束
+  dump ADDRESS N            读出 N 个字
+  backup FILE               备份全部区域到快照文件
+  restore FILE              从快照文件恢复 (-area 过滤区域 -dry-run 只显示)
+  diff OLD [NEW]            比较快照 未指定 NEW 时与 PLC 比较 (-ignore T,C,N)
+  status                    读出 CPU 状态
+  run | stop                远程运行/停止
+  clock                     读出时钟 (-sync 设为本机时间)
+  fr-export FILE            导出 FR 到快照文件 (-block 过滤块)
+  fr-import FILE            从快照文件导入 FR 并登录 (-no-commit 只写入 RAM)
+
+flags:
+  -host      PLC 地址 (默认 127.0.0.1:1025)
+  -udp       使用 UDP
+  -timeout   超时 (默认 3s)
+  -format    输出格式 table json csv (dump 另有 bin)
+  -type      数据类型 bool uint8 uint16 int16 uint32 int32 float32 bcd string hex
+  -order     32位数据字序 cdab abcd (默认 cdab)
+  -v         输出收发的帧
+  -relay     经由链接模块中继 link:station[,link:station]...
+
+run 'toyopuc <command> -h' for the flags of a command.
+`)
+}
+
+// options 通用参数
+type options struct {
+	host    string
+	udp     bool
+	timeout time.Duration
+	format  string
+	typ     string
+	order   string
+	verbose bool
+	relay   relayFlag
+}
+
+// newFlagSet 创建子命令的参数 并注册通用参数
+func newFlagSet(name string, o *options) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&o.host, "host", "127.0.0.1:1025", "PLC `address` host:port")
+	fs.BoolVar(&o.udp, "udp", false, "use UDP instead of TCP")
+	fs.DurationVar(&o.timeout, "timeout", 3*time.Second, "request timeout")
+	fs.StringVar(&o.format, "format", formatTable, "output `format`: table, json or csv")
+	fs.StringVar(&o.typ, "type", "", "value `type`: bool uint8 uint16 int16 uint32 int32 float32 bcd string hex")
+	fs.StringVar(&o.order, "order", "cdab", "word `order` of 32-bit values: cdab or abcd")
+	fs.BoolVar(&o.verbose, "v", false, "log frames to stderr")
+	fs.Var(&o.relay, "relay", "relay through `link:station[,link:station]...` of link modules")
+	return fs
+}
+
+// parseArgs 参数与位置参数可以交替出现 如 read D0100 10 --type int32
+// 负数 (write D0200 -5 --type int16) 为位置参数
+func parseArgs(fs *flag.FlagSet, args []string) (positional []string, err error) {
+	var flags []string
+	for k := 0; k < len(args); k++ {
+		a := args[k]
+		switch {
+		case a == "--":
+			// "--" 之后全部为位置参数
+			positional = append(positional, args[k+1:]...)
+			k = len(args)
+		case len(a) < 2 || a[0] != '-' || isNumber(a):
+			positional = append(positional, a)
+		default:
+			flags = append(flags, a)
+			name := strings.TrimLeft(a, "-")
+			if strings.Contains(name, "=") {
+				continue
+			}
+			// 非 bool 参数的值为下一个参数
+			if f := fs.Lookup(name); f != nil && k+1 < len(args) {
+				if b, ok := f.Value.(interface{ IsBoolFlag() bool }); !ok || !b.IsBoolFlag() {
+					k++
+					flags = append(flags, args[k])
+				}
+			}
+		}
+	}
+	err = fs.Parse(flags)
+	return
+}
+
+// isNumber 是否为数值 如 -5 -1.5
+func isNumber(s string) bool {
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
+
+// dial 按参数创建客户端
+func (o *options) dial() (client toyopuc.Client, closer io.Closer) {
+	var logger *log.Logger
+	if o.verbose {
+		logger = log.New(os.Stderr, "", log.LstdFlags|log.Lmicroseconds)
+	}
+	var handler interface {
+		toyopuc.ClientHandler
+		io.Closer
+	}
+	if o.udp {
+		h := toyopuc.NewUDPClientHandler(o.host)
+		h.Timeout = o.timeout
+		h.Logger = logger
+		handler = h
+	} else {
+		h := toyopuc.NewTCPClientHandler(o.host)
+		h.Timeout = o.timeout
+		h.Logger = logger
+		handler = h
+	}
+	if len(o.relay) > 0 {
+		return toyopuc.RelayClient(handler, o.relay...), handler
+	}
+	return toyopuc.NewClient(handler), handler
+}
+
+// relayFlag -relay link:station[,link:station]...
+type relayFlag []toyopuc.RelayHop
+
+func (r *relayFlag) String() string {
+	var parts []string
+	for _, hop := range *r {
+		parts = append(parts, fmt.Sprintf("%v:%v", hop.Link, hop.Station))
+	}
+	return strings.Join(parts, ",")
+}
+
+func (r *relayFlag) Set(s string) error {
+	*r = nil
+	for _, hop := range strings.Split(s, ",") {
+		parts := strings.SplitN(hop, ":", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("relay '%v' must be link:station", hop)
+		}
+		link, e1 := strconv.ParseUint(parts[0], 0, 8)
+		station, e2 := strconv.ParseUint(parts[1], 0, 16)
+		if e1 != nil || e2 != nil {
+			return fmt.Errorf("relay '%v' must be link:station", hop)
+		}
+		*r = append(*r, toyopuc.RelayHop{Link: byte(link), Station: uint16(station)})
+	}
+	return nil
+}
+
+// codec 按参数取得数据类型
+func (o *options) codec(addr *toyopuc.Address) (c *codec, err error) {
+	order, err := toyopuc.ParseWordOrder(o.order)
+	if err != nil {
+		return
+	}
+	return newCodec(o.typ, order, addr)
+}
+
+// runRead read ADDRESS [N]
+func runRead(args []string) (err error) {
+	var o options
+	fs := newFlagSet("read", &o)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return
+	}
+	if len(positional) < 1 || len(positional) > 2 {
+		return fmt.Errorf("usage: toyopuc read ADDRESS [N] [flags]")
+	}
+	addr, err := toyopuc.ParseAddress(positional[0])
+	if err != nil {
+		return
+	}
+	n := 1
+	if len(positional) == 2 {
+		if n, err = parseCount(positional[1]); err != nil {
+			return
+		}
+	}
+	c, err := o.codec(addr)
+	if err != nil {
+		return
+	}
+	if c.quantity(n) > 0xFFFF {
+		return fmt.Errorf("toyopuc: count '%v' of '%v' is too large", n, c.typ)
+	}
+	out, err := newOutput(os.Stdout, o.format)
+	if err != nil {
+		return
+	}
+	client, closer := o.dial()
+	defer closer.Close()
+
+	data, err := client.Read(addr.String(), uint16(c.quantity(n)))
+	if err != nil {
+		return
+	}
+	values, err := c.decode(data)
+	if err != nil {
+		return
+	}
+	for k, v := range values {
+		out.row(time.Time{}, addr.Offset(k*c.step).String(), v)
+	}
+	return out.flush()
+}
+
+// runWrite write ADDRESS VALUE...
+func runWrite(args []string) (err error) {
+	var o options
+	fs := newFlagSet("write", &o)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return
+	}
+	if len(positional) < 2 {
+		return fmt.Errorf("usage: toyopuc write ADDRESS VALUE... [flags]")
+	}
+	addr, err := toyopuc.ParseAddress(positional[0])
+	if err != nil {
+		return
+	}
+	c, err := o.codec(addr)
+	if err != nil {
+		return
+	}
+	data, err := c.encode(positional[1:])
+	if err != nil {
+		return
+	}
+	client, closer := o.dial()
+	defer closer.Close()
+
+	return client.Write(addr.String(), data)
+}
+
+// runMonitor monitor ADDRESS[..END]...
+func runMonitor(args []string) (err error) {
+	var o options
+	fs := newFlagSet("monitor", &o)
+	interval := fs.Duration("interval", time.Second, "polling interval")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return
+	}
+	if len(positional) < 1 {
+		return fmt.Errorf("usage: toyopuc monitor ADDRESS[..END]... [flags]")
+	}
+	tags := make([]toyopuc.Tag, len(positional))
+	addrs := make([]*toyopuc.Address, len(positional))
+	codecs := make([]*codec, len(positional))
+	for k, p := range positional {
+		var n int
+		if addrs[k], n, err = parseRange(p); err != nil {
+			return
+		}
+		if codecs[k], err = o.codec(addrs[k]); err != nil {
+			return
+		}
+		// 范围按单位计数 转为值的个数
+		n = (n + codecs[k].step - 1) / codecs[k].step
+		tags[k] = toyopuc.Tag{Address: addrs[k].String(), Quantity: uint16(codecs[k].quantity(n))}
+	}
+	out, err := newOutput(os.Stdout, o.format)
+	if err != nil {
+		return
+	}
+	out.stream = true
+	client, closer := o.dial()
+	defer closer.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	// 每个值最后输出的内容
+	last := make(map[string]string)
+	sub, err := client.WithContext(ctx).Subscribe(tags, *interval, nil)
+	if err != nil {
+		return
+	}
+	for u := range sub.C {
+		if u.Quality != toyopuc.QualityGood {
+			fmt.Fprintf(os.Stderr, "%v %v: %v\n", u.Time.Format(timeLayout), u.Tag.Address, u.Err)
+			continue
+		}
+		values, e := codecs[u.Index].decode(u.Value)
+		if e != nil {
+			fmt.Fprintf(os.Stderr, "%v %v: %v\n", u.Time.Format(timeLayout), u.Tag.Address, e)
+			continue
+		}
+		for k, v := range values {
+			name := addrs[u.Index].Offset(k * codecs[u.Index].step).String()
+			text := fmt.Sprint(v)
+			if prev, ok := last[name]; ok && prev == text {
+				continue
+			}
+			last[name] = text
+			out.row(u.Time, name, v)
+		}
+		if err = out.flush(); err != nil {
+			sub.Stop()
+			return
+		}
+	}
+	return
+}
+
+// runDump dump ADDRESS N
+func runDump(args []string) (err error) {
+	var o options
+	fs := newFlagSet("dump", &o)
+	file := fs.String("o", "", "output `file` (default stdout)")
+	fs.Lookup("format").DefValue = formatBinary
+	o.format = formatBinary
+	fs.Lookup("format").Usage = "output `format`: bin, table, json or csv"
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return
+	}
+	if len(positional) != 2 {
+		return fmt.Errorf("usage: toyopuc dump ADDRESS N [-o file] [flags]")
+	}
+	addr, err := toyopuc.ParseAddress(positional[0])
+	if err != nil {
+		return
+	}
+	if addr.Unit != toyopuc.UnitWord {
+		return fmt.Errorf("toyopuc: dump '%v' must be a word address", addr)
+	}
+	n, err := parseCount(positional[1])
+	if err != nil {
+		return
+	}
+	var w io.Writer = os.Stdout
+	if *file != "" {
+		var f *os.File
+		if f, err = os.Create(*file); err != nil {
+			return
+		}
+		defer func() {
+			if e := f.Close(); err == nil {
+				err = e
+			}
+		}()
+		w = f
+	}
+	client, closer := o.dial()
+	defer closer.Close()
+
+	data, err := client.Read(addr.String(), uint16(n))
+	if err != nil {
+		return
+	}
+	if o.format == formatBinary {
+		_, err = w.Write(data)
+		return
+	}
+	c, err := o.codec(addr)
+	if err != nil {
+		return
+	}
+	values, err := c.decode(data)
+	if err != nil {
+		return
+	}
+	out, err := newOutput(w, o.format)
+	if err != nil {
+		return
+	}
+	for k, v := range values {
+		out.row(time.Time{}, addr.Offset(k*c.step).String(), v)
+	}
+	return out.flush()
+}
+
+// parseCount 个数 十进制或 0x 开头的十六进制
+func parseCount(s string) (n int, err error) {
+	v, err := strconv.ParseUint(s, 0, 16)
+	if err != nil || v < 1 {
+		return 0, fmt.Errorf("toyopuc: count '%v' must be between '1' and '65535'", s)
+	}
+	return int(v), nil
+}
+
+// parseRange 地址范围 D0100..D0110 (包含结束地址) 或单个地址
+// 返回起始地址与单位 (字、字节或位) 的个数
+func parseRange(s string) (addr *toyopuc.Address, n int, err error) {
+	parts := strings.SplitN(s, "..", 2)
+	if addr, err = toyopuc.ParseAddress(parts[0]); err != nil {
+		return
+	}
+	if len(parts) == 1 {
+		return addr, 1, nil
+	}
+	end, err := toyopuc.ParseAddress(parts[1])
+	if err != nil {
+		return
+	}
+	if end.Family != addr.Family || end.No != addr.No || end.Unit != addr.Unit || end.Device != addr.Device {
+		return nil, 0, fmt.Errorf("toyopuc: '%v' is not a range of the same device", s)
+	}
+	switch addr.Unit {
+	case toyopuc.UnitWord:
+		n = int(end.Word) - int(addr.Word) + 1
+	case toyopuc.UnitByte:
+		n = int(end.ByteAddress()) - int(addr.ByteAddress()) + 1
+	default:
+		n = int(end.Word)*16 + int(end.Bit) - int(addr.Word)*16 - int(addr.Bit) + 1
+	}
+	if n < 1 {
+		return nil, 0, fmt.Errorf("toyopuc: range '%v' is empty", s)
+	}
+	return
+}
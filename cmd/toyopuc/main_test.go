@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		args       []string
+		positional string
+		want       string
+	}{
+		{args: []string{"D0100", "10", "--type", "int32", "-order=abcd"}, positional: "D0100 10", want: "int32 abcd false"},
+		{args: []string{"-type", "int16", "D0200", "-5", "-v"}, positional: "D0200 -5", want: "int16 cdab true"},
+		{args: []string{"-v", "D0100", "-type", "float32", "-1.5"}, positional: "D0100 -1.5", want: "float32 cdab true"},
+		{args: []string{"D0100", "--", "-type", "x"}, positional: "D0100 -type x", want: " cdab false"},
+		{args: []string{"D0100", "-", "-v=false"}, positional: "D0100 -", want: " cdab false"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			var o options
+			positional, err := parseArgs(newFlagSet("test", &o), tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(positional, " "); got != tt.positional {
+				t.Errorf("positional = %q, want %q", got, tt.positional)
+			}
+			if got := fmt.Sprintf("%v %v %v", o.typ, o.order, o.verbose); got != tt.want {
+				t.Errorf("options = %q, want %q", got, tt.want)
+			}
+		})
+	}
+	for _, args := range [][]string{{"D0100", "-unknown"}, {"D0100", "-timeout", "x"}} {
+		var o options
+		fs := newFlagSet("test", &o)
+		fs.SetOutput(new(strings.Builder))
+		if _, err := parseArgs(fs, args); err == nil {
+			t.Errorf("parseArgs(%v) succeeded", args)
+		}
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		in   string
+		addr string
+		n    int
+	}{
+		{in: "D0100", addr: "D0100", n: 1},
+		{in: "D0100..D0110", addr: "D0100", n: 0x11},
+		{in: "D0100L..D0101H", addr: "D0100L", n: 4},
+		{in: "M0010..M001F", addr: "M0010", n: 16},
+		{in: "M000W..M001W", addr: "M000W", n: 2},
+		{in: "D0100.E..D0101.1", addr: "D0100.E", n: 4},
+		{in: "P2-D0000..P2-D0001", addr: "P2-D0000", n: 2},
+	}
+	for _, tt := range tests {
+		addr, n, err := parseRange(tt.in)
+		if err != nil {
+			t.Errorf("parseRange(%v) error = %v", tt.in, err)
+			continue
+		}
+		if addr.String() != tt.addr || n != tt.n {
+			t.Errorf("parseRange(%v) = %v %v, want %v %v", tt.in, addr, n, tt.addr, tt.n)
+		}
+	}
+	for _, in := range []string{"Q0100", "D0110..D0100", "D0100..R0100", "D0100..D0101L", "D0100..P1-D0101", "D0100..Q"} {
+		if _, _, err := parseRange(in); err == nil {
+			t.Errorf("parseRange(%v) succeeded", in)
+		}
+	}
+}
+
+func TestRelayFlag(t *testing.T) {
+	var r relayFlag
+	if err := r.Set("1:2,0x10:0x0300"); err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 2 || r[0].Link != 1 || r[0].Station != 2 || r[1].Link != 0x10 || r[1].Station != 0x300 {
+		t.Errorf("relay = %+v", r)
+	}
+	if got := r.String(); got != "1:2,16:768" {
+		t.Errorf("String() = %v, want %v", got, "1:2,16:768")
+	}
+	// 再次设置时替换
+	if err := r.Set("3:4"); err != nil || r.String() != "3:4" {
+		t.Errorf("relay = %v, %v, want 3:4", r.String(), err)
+	}
+	for _, s := range []string{"", "1", "1:2,3", "x:1", "1:x", "256:1", "1:65536", "1:2:3"} {
+		if err := r.Set(s); err == nil {
+			t.Errorf("Set(%q) succeeded", s)
+		}
+	}
+}
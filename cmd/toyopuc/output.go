@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// 输出格式
+const (
+	formatTable  = "table"
+	formatJSON   = "json"
+	formatCSV    = "csv"
+	formatBinary = "bin"
+)
+
+const timeLayout = "15:04:05.000"
+
+// record 一个值
+type record struct {
+	Time    *time.Time  `json:"time,omitempty"`
+	Address string      `json:"address"`
+	Value   interface{} `json:"value"`
+}
+
+// output 按格式输出
+// stream 为 true 时 (monitor) 每行带时间，json 每行一个对象
+type output struct {
+	w       io.Writer
+	format  string
+	stream  bool
+	records []record
+	header  bool
+}
+
+func newOutput(w io.Writer, format string) (o *output, err error) {
+	switch format {
+	case formatTable, formatJSON, formatCSV:
+	default:
+		return nil, fmt.Errorf("toyopuc: unknown output format '%v'", format)
+	}
+	return &output{w: w, format: format}, nil
+}
+
+// row 添加一个值
+func (o *output) row(t time.Time, address string, value interface{}) {
+	r := record{Address: address, Value: value}
+	if o.stream {
+		r.Time = &t
+	}
+	o.records = append(o.records, r)
+}
+
+// flush 输出已添加的值
+func (o *output) flush() (err error) {
+	records := o.records
+	o.records = nil
+	switch o.format {
+	case formatTable:
+		tw := tabwriter.NewWriter(o.w, 0, 8, 2, ' ', 0)
+		if !o.header && !o.stream {
+			fmt.Fprintln(tw, "ADDRESS\tVALUE")
+		}
+		for _, r := range records {
+			if r.Time != nil {
+				fmt.Fprintf(tw, "%v\t", r.Time.Format(timeLayout))
+			}
+			fmt.Fprintf(tw, "%v\t%v\n", r.Address, r.Value)
+		}
+		err = tw.Flush()
+	case formatCSV:
+		cw := csv.NewWriter(o.w)
+		if !o.header {
+			if o.stream {
+				cw.Write([]string{"time", "address", "value"})
+			} else {
+				cw.Write([]string{"address", "value"})
+			}
+		}
+		for _, r := range records {
+			line := []string{r.Address, fmt.Sprint(r.Value)}
+			if r.Time != nil {
+				line = append([]string{r.Time.Format(time.RFC3339Nano)}, line...)
+			}
+			cw.Write(line)
+		}
+		cw.Flush()
+		err = cw.Error()
+	case formatJSON:
+		enc := json.NewEncoder(o.w)
+		if o.stream {
+			for _, r := range records {
+				if err = enc.Encode(r); err != nil {
+					return
+				}
+			}
+			return
+		}
+		if records == nil {
+			records = []record{}
+		}
+		enc.SetIndent("", "  ")
+		err = enc.Encode(records)
+	}
+	o.header = true
+	return
+}
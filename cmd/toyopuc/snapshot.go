@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"toyopuc/toyopuc"
+)
+
+// areaList -area IO,P1 逗号分隔的区域名
+func areaList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// splitFRAreas 区域名分为 Backup 的区域与 FR 块 (FR00 - FR3F)
+// FR 块不能用 Backup 读出，使用 ExportFR
+func splitFRAreas(names []string) (areas []string, blocks []int, err error) {
+	for _, name := range names {
+		if !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(name)), "FR") {
+			areas = append(areas, name)
+			continue
+		}
+		var b []int
+		if b, err = blockList(name); err != nil {
+			return
+		}
+		blocks = append(blocks, b...)
+	}
+	return
+}
+
+// runBackup backup FILE
+func runBackup(args []string) (err error) {
+	var o options
+	fs := newFlagSet("backup", &o)
+	areas := fs.String("area", "", "comma separated `areas` to back up (default all): "+strings.Join(toyopuc.SnapshotAreas(), " "))
+	skip := fs.Bool("skip-missing", false, "skip areas the CPU does not support")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: toyopuc backup FILE [-area IO,P1] [flags]")
+	}
+	client, closer := o.dial()
+	defer closer.Close()
+
+	snapshot, err := toyopuc.Backup(client, &toyopuc.BackupOptions{
+		Areas:       areaList(*areas),
+		SkipMissing: *skip,
+		Progress:    progress,
+	})
+	if err != nil {
+		return
+	}
+	f, err := os.Create(positional[0])
+	if err != nil {
+		return
+	}
+	defer func() {
+		if e := f.Close(); err == nil {
+			err = e
+		}
+	}()
+	if _, err = snapshot.WriteTo(f); err != nil {
+		return
+	}
+	for _, a := range snapshot.Areas {
+		fmt.Fprintf(os.Stderr, "%v\t%v words\n", a.Name, len(a.Words))
+	}
+	return
+}
+
+// runRestore restore FILE
+func runRestore(args []string) (err error) {
+	var o options
+	fs := newFlagSet("restore", &o)
+	areas := fs.String("area", "", "comma separated `areas` to restore (default all in the file)")
+	dryRun := fs.Bool("dry-run", false, "print the blocks to write without writing")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: toyopuc restore FILE [-area IO,P1] [-dry-run] [flags]")
+	}
+	snapshot, err := readSnapshot(positional[0])
+	if err != nil {
+		return
+	}
+	options := &toyopuc.RestoreOptions{Areas: areaList(*areas), DryRun: *dryRun}
+	if *dryRun {
+		blocks, err := toyopuc.Restore(nil, snapshot, options)
+		for _, b := range blocks {
+			fmt.Println(b)
+		}
+		return err
+	}
+	options.Progress = progress
+	client, closer := o.dial()
+	defer closer.Close()
+
+	_, err = toyopuc.Restore(client, snapshot, options)
+	return
+}
+
+// progress 在 stderr 显示区域的进度
+func progress(area string, done, total int) {
+	fmt.Fprintf(os.Stderr, "\r%-5v %3d%%", area, done*100/total)
+	if done == total {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+// readSnapshot 读出快照文件
+func readSnapshot(name string) (snapshot *toyopuc.Snapshot, err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	return toyopuc.ReadSnapshot(f)
+}
+
+// runDiff diff OLD [NEW] 未指定 NEW 时与 PLC 当前的值比较
+func runDiff(args []string) (err error) {
+	var o options
+	fs := newFlagSet("diff", &o)
+	areas := fs.String("area", "", "comma separated `areas` to compare (default all in OLD)")
+	ignore := fs.String("ignore", "", "comma separated `devices` or addresses to ignore, e.g. T,C,N,D0100..D01FF")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return
+	}
+	if len(positional) < 1 || len(positional) > 2 {
+		return fmt.Errorf("usage: toyopuc diff OLD [NEW] [-ignore T,C,N] [-area IO,P1] [flags]")
+	}
+	switch o.format {
+	case formatTable, formatJSON, formatCSV:
+	default:
+		return fmt.Errorf("toyopuc: unknown output format '%v'", o.format)
+	}
+	old, err := readSnapshot(positional[0])
+	if err != nil {
+		return
+	}
+	var current *toyopuc.Snapshot
+	if len(positional) == 2 {
+		if current, err = readSnapshot(positional[1]); err != nil {
+			return
+		}
+	} else {
+		// 只读出 OLD 中的区域 FR 块 (fr-export 的文件) 使用 ExportFR
+		names := areaList(*areas)
+		if names == nil {
+			for _, a := range old.Areas {
+				names = append(names, a.Name)
+			}
+		}
+		var blocks []int
+		if names, blocks, err = splitFRAreas(names); err != nil {
+			return
+		}
+		client, closer := o.dial()
+		defer closer.Close()
+		current = &toyopuc.Snapshot{}
+		if len(names) > 0 || len(blocks) == 0 {
+			if current, err = toyopuc.Backup(client, &toyopuc.BackupOptions{Areas: names, Progress: progress}); err != nil {
+				return
+			}
+		}
+		if len(blocks) > 0 {
+			var fr *toyopuc.Snapshot
+			if fr, err = toyopuc.ExportFR(client, &toyopuc.FROptions{Blocks: blocks, Progress: progress}); err != nil {
+				return
+			}
+			if current.Time.IsZero() {
+				current.Time = fr.Time
+			}
+			current.Areas = append(current.Areas, fr.Areas...)
+		}
+	}
+	diff, err := toyopuc.DiffSnapshots(old, current, &toyopuc.DiffOptions{
+		Ignore: areaList(*ignore),
+		Areas:  areaList(*areas),
+	})
+	if err != nil {
+		return
+	}
+	for _, name := range diff.Missing {
+		fmt.Fprintf(os.Stderr, "toyopuc: area '%v' is only in one snapshot\n", name)
+	}
+	for _, r := range diff.Resized {
+		fmt.Fprintf(os.Stderr, "toyopuc: area size differs (%v), only the overlapping words are compared\n", r)
+	}
+	return writeDiff(os.Stdout, o.format, diff.Changes)
+}
+
+// diffRecord 一个变化的字
+type diffRecord struct {
+	Address string   `json:"address"`
+	Old     string   `json:"old"`
+	New     string   `json:"new"`
+	Bits    []string `json:"bits"`
+}
+
+// writeDiff 按格式输出变化的字 值为十六进制
+func writeDiff(w io.Writer, format string, changes []toyopuc.Change) (err error) {
+	records := make([]diffRecord, len(changes))
+	for k, c := range changes {
+		records[k] = diffRecord{
+			Address: c.Address,
+			Old:     fmt.Sprintf("%04X", c.Old),
+			New:     fmt.Sprintf("%04X", c.New),
+			Bits:    c.Bits,
+		}
+	}
+	switch format {
+	case formatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+	case formatCSV:
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"address", "old", "new", "bits"})
+		for _, r := range records {
+			cw.Write([]string{r.Address, r.Old, r.New, strings.Join(r.Bits, " ")})
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ADDRESS\tOLD\tNEW\tBITS")
+	for _, r := range records {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\n", r.Address, r.Old, r.New, strings.Join(r.Bits, " "))
+	}
+	return tw.Flush()
+}
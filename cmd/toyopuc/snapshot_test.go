@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"toyopuc/toyopuc"
+	"toyopuc/toyopuc/sim"
+)
+
+func TestSplitFRAreas(t *testing.T) {
+	areas, blocks, err := splitFRAreas([]string{"IO", "FR00", "p1", " fr3f", "FR01"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(areas, blocks); got != "[IO p1] [0 63 1]" {
+		t.Errorf("splitFRAreas = %v, want %v", got, "[IO p1] [0 63 1]")
+	}
+	if _, _, err = splitFRAreas([]string{"FRXY"}); err == nil {
+		t.Error("splitFRAreas(FRXY) succeeded")
+	}
+}
+
+// captureStdout 执行 f 并返回写入 stdout 的内容
+func captureStdout(t *testing.T, f func() error) (out string, err error) {
+	t.Helper()
+	r, w, e := os.Pipe()
+	if e != nil {
+		t.Fatal(e)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	done := make(chan []byte)
+	go func() {
+		b, _ := io.ReadAll(r)
+		done <- b
+	}()
+	err = f()
+	os.Stdout = stdout
+	w.Close()
+	return string(<-done), err
+}
+
+func TestDiffWithPLC(t *testing.T) {
+	s := sim.NewServer()
+	if err := s.Start("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	handler := toyopuc.NewTCPClientHandler(s.Addr().String())
+	defer handler.Close()
+	client := toyopuc.NewClient(handler)
+
+	dir := t.TempDir()
+	save := func(name string, snapshot *toyopuc.Snapshot) string {
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err = snapshot.WriteTo(f); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	// fr-export 与 backup 的文件
+	fr, err := toyopuc.ExportFR(client, &toyopuc.FROptions{Blocks: []int{1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frFile := save("fr.snap", fr)
+	backup, err := toyopuc.Backup(client, &toyopuc.BackupOptions{Areas: []string{"IO"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioFile := save("io.snap", backup)
+
+	if err = client.WriteFR(toyopuc.FRBlockWords+0x10, []uint16{0x1234}); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Memory.Set("D0100", 0x5678); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "fr", args: []string{frFile}, want: "[{FR01:0010 0000 1234}]"},
+		{name: "fr area", args: []string{frFile, "-area", "fr01"}, want: "[{FR01:0010 0000 1234}]"},
+		{name: "io", args: []string{ioFile}, want: "[{D0100 0000 5678}]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := captureStdout(t, func() error {
+				return runDiff(append(tt.args, "-host", s.Addr().String(), "-format", "json"))
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var records []diffRecord
+			if err = json.Unmarshal([]byte(out), &records); err != nil {
+				t.Fatalf("%v: %v", err, out)
+			}
+			var got []string
+			for _, r := range records {
+				got = append(got, fmt.Sprintf("{%v %v %v}", r.Address, r.Old, r.New))
+			}
+			if fmt.Sprintf("%v", got) != tt.want {
+				t.Errorf("diff = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
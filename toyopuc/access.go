@@ -0,0 +1,441 @@
+package toyopuc
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// 一帧的最大数据量 受 tcpMaxLength 限制
+// 超过时 Read Write 自动分割为多帧
+const (
+	// 响应: 头 4 + 指令 1 + 数据
+	frameMaxReadBytes = tcpMaxLength - tcpHeaderSize - 1
+	frameMaxReadWords = frameMaxReadBytes / 2
+	// 请求: 头 4 + 指令 1 + 程序号 1 + 地址 2 + 数据
+	frameMaxWriteBytes = (tcpMaxLength - tcpHeaderSize - 4) &^ 1
+	frameMaxWriteWords = frameMaxWriteBytes / 2
+	// 多点位读写
+	frameMaxBits = 0x80
+)
+
+// frameLimiter 帧中有封装 (如中继) 的客户端 一帧的数据量相应减少
+type frameLimiter interface {
+	frameOverhead() int
+}
+
+// frameOverhead 封装增加的字节数
+func (toyopuc *client) frameOverhead() int {
+	if r, ok := toyopuc.packager.(*RelayPackager); ok {
+		return r.overhead()
+	}
+	return 0
+}
+
+// frameBytes 一帧的最大读出/写入字节数
+func frameBytes(client Client) (read, write int) {
+	overhead := 0
+	if l, ok := client.(frameLimiter); ok {
+		overhead = l.frameOverhead()
+	}
+	return frameMaxReadBytes - overhead, (frameMaxWriteBytes - overhead) &^ 1
+}
+
+// frameWords 一帧的最大读出/写入字数
+func frameWords(client Client) (read, write int) {
+	read, write = frameBytes(client)
+	return read / 2, write / 2
+}
+
+// Read 按设备地址读出
+// 根据设备区域自动选择功能码以及 字/字节/位 访问
+//  字: 返回 quantity*2 字节 CDAB
+//  字节: 返回 quantity 字节
+//  位: 每位返回一个字节 1 ON 0 OFF
+// 超过一帧的数据量时分割为多帧读出
+func (toyopuc *client) Read(address string, quantity uint16) (results []byte, err error) {
+	a, err := ParseAddress(address)
+	if err != nil {
+		return
+	}
+	return toyopuc.read(a, quantity)
+}
+
+// Write 按设备地址写入
+// value 格式与 Read 的返回值相同
+// 超过一帧的数据量时分割为多帧写入
+// 字设备的位为读出、修改、写回，不是原子操作 见 writeWordBit
+func (toyopuc *client) Write(address string, value []byte) (err error) {
+	a, err := ParseAddress(address)
+	if err != nil {
+		return
+	}
+	return toyopuc.write(a, value)
+}
+
+// read 按解析后的地址读出
+func (toyopuc *client) read(a *Address, quantity uint16) (results []byte, err error) {
+	switch a.Unit {
+	case UnitWord:
+		return toyopuc.readWord(a, quantity)
+	case UnitByte:
+		if a.Family == FamilyIO || a.Family == FamilyDataExpansion {
+			return toyopuc.readByte(a, quantity)
+		}
+	case UnitBit:
+		if bitAddr, ok := a.BitAddress(); ok {
+			return toyopuc.readBits(a, bitAddr, quantity)
+		}
+		// 字设备的位 读出所在的字后取位
+		return toyopuc.readWordBit(a, quantity)
+	}
+	err = fmt.Errorf("toyopuc: address '%v' %v access is not supported by %v commands", a, a.Unit, a.Family)
+	return
+}
+
+// write 按解析后的地址写入
+func (toyopuc *client) write(a *Address, value []byte) (err error) {
+	switch a.Unit {
+	case UnitWord:
+		if len(value)%2 != 0 {
+			err = fmt.Errorf("toyopuc: word value length '%v' must be even", len(value))
+			return
+		}
+		return toyopuc.writeWord(a, DecodeUint16s(value))
+	case UnitByte:
+		if a.Family == FamilyIO || a.Family == FamilyDataExpansion {
+			return toyopuc.writeByte(a, value)
+		}
+	case UnitBit:
+		if bitAddr, ok := a.BitAddress(); ok {
+			return toyopuc.writeBits(a, bitAddr, value)
+		}
+		return toyopuc.writeWordBit(a, value)
+	}
+	err = fmt.Errorf("toyopuc: address '%v' %v access is not supported by %v commands", a, a.Unit, a.Family)
+	return
+}
+
+// readWord 字读出
+// 按一帧的最大字数分割，不跨越区域号
+func (toyopuc *client) readWord(a *Address, quantity uint16) (results []byte, err error) {
+	if quantity < 1 {
+		err = fmt.Errorf("toyopuc: quantity '%v' must be greater than '%v',", quantity, 0)
+		return
+	}
+	max, _ := frameWords(toyopuc)
+	for done := 0; done < int(quantity); {
+		chunk := a.offset(uint32(done))
+		n := chunk.wordsInFrame(int(quantity)-done, max)
+		var data []byte
+		if data, err = toyopuc.readWordFrame(chunk, uint16(n)); err != nil {
+			return
+		}
+		results = append(results, data...)
+		done += n
+	}
+	return
+}
+
+// writeWord 字写入
+// 按一帧的最大字数分割，不跨越区域号
+func (toyopuc *client) writeWord(a *Address, value []uint16) (err error) {
+	if len(value) < 1 {
+		err = fmt.Errorf("toyopuc: quantity '%v' must be greater than '%v',", len(value), 0)
+		return
+	}
+	_, max := frameWords(toyopuc)
+	for done := 0; done < len(value); {
+		chunk := a.offset(uint32(done))
+		n := chunk.wordsInFrame(len(value)-done, max)
+		if err = toyopuc.writeWordFrame(chunk, value[done:done+n]); err != nil {
+			return
+		}
+		done += n
+	}
+	return
+}
+
+// readByte 字节读出
+// 按一帧的最大字节数分割，不跨越区域号
+func (toyopuc *client) readByte(a *Address, quantity uint16) (results []byte, err error) {
+	if quantity < 1 {
+		err = fmt.Errorf("toyopuc: quantity '%v' must be greater than '%v',", quantity, 0)
+		return
+	}
+	max, _ := frameBytes(toyopuc)
+	for done := 0; done < int(quantity); {
+		chunk := a.Offset(done)
+		n := chunk.bytesInFrame(int(quantity)-done, max)
+		var data []byte
+		if a.Family == FamilyIO {
+			data, err = toyopuc.ReadIOByte(chunk.ByteAddress(), uint16(n))
+		} else {
+			data, err = toyopuc.ReadDataExpansionByte(chunk.No, chunk.ByteAddress(), uint16(n))
+		}
+		if err != nil {
+			return
+		}
+		results = append(results, data...)
+		done += n
+	}
+	return
+}
+
+// writeByte 字节写入
+// 按一帧的最大字节数分割，不跨越区域号
+func (toyopuc *client) writeByte(a *Address, value []byte) (err error) {
+	if len(value) < 1 {
+		err = fmt.Errorf("toyopuc: quantity '%v' must be greater than '%v',", len(value), 0)
+		return
+	}
+	_, max := frameBytes(toyopuc)
+	for done := 0; done < len(value); {
+		chunk := a.Offset(done)
+		n := chunk.bytesInFrame(len(value)-done, max)
+		if a.Family == FamilyIO {
+			err = toyopuc.WriteIOByte(chunk.ByteAddress(), value[done:done+n])
+		} else {
+			err = toyopuc.WriteDataExpansionByte(chunk.No, chunk.ByteAddress(), value[done:done+n])
+		}
+		if err != nil {
+			return
+		}
+		done += n
+	}
+	return
+}
+
+// readBits 位设备 位读出
+// 按多点位读出的最大点数分割
+func (toyopuc *client) readBits(a *Address, bitAddr, quantity uint16) (results []byte, err error) {
+	if quantity < 1 {
+		err = fmt.Errorf("toyopuc: quantity '%v' must be greater than '%v',", quantity, 0)
+		return
+	}
+	for done := 0; done < int(quantity); {
+		n := minInt(int(quantity)-done, frameMaxBits)
+		var data []byte
+		if data, err = toyopuc.readBit(a, bitAddr+uint16(done), uint16(n)); err != nil {
+			return
+		}
+		results = append(results, data...)
+		done += n
+	}
+	return
+}
+
+// writeBits 位设备 位写入
+// 按多点位写入的最大点数分割
+func (toyopuc *client) writeBits(a *Address, bitAddr uint16, value []byte) (err error) {
+	if len(value) < 1 {
+		err = fmt.Errorf("toyopuc: quantity '%v' must be greater than '%v',", len(value), 0)
+		return
+	}
+	for done := 0; done < len(value); {
+		n := minInt(len(value)-done, frameMaxBits)
+		if err = toyopuc.writeBit(a, bitAddr+uint16(done), value[done:done+n]); err != nil {
+			return
+		}
+		done += n
+	}
+	return
+}
+
+// readWordFrame 字读出 一帧
+func (toyopuc *client) readWordFrame(a *Address, quantity uint16) (results []byte, err error) {
+	switch a.Family {
+	case FamilyIO:
+		return toyopuc.ReadIOWord(a.Word, quantity)
+	case FamilySequentialProgram:
+		return toyopuc.ReadSequentialProgramWord(a.Word, quantity)
+	case FamilyProgramExpansion:
+		return toyopuc.ReadProgramExpansionWord(a.No, a.Word, quantity)
+	case FamilyDataExpansion:
+		return toyopuc.ReadDataExpansionWord(a.No, a.Word, quantity)
+	}
+	err = fmt.Errorf("toyopuc: address '%v' unknown command family", a)
+	return
+}
+
+// writeWordFrame 字写入 一帧
+func (toyopuc *client) writeWordFrame(a *Address, value []uint16) (err error) {
+	switch a.Family {
+	case FamilyIO:
+		return toyopuc.WriteIOWord(a.Word, value)
+	case FamilySequentialProgram:
+		return toyopuc.WriteSequentialProgramWord(a.Word, value)
+	case FamilyProgramExpansion:
+		return toyopuc.WriteProgramExpansionWord(a.No, a.Word, value)
+	case FamilyDataExpansion:
+		return toyopuc.WriteDataExpansionWord(a.No, a.Word, value)
+	}
+	err = fmt.Errorf("toyopuc: address '%v' unknown command family", a)
+	return
+}
+
+// readBit 位设备 位读出
+// I/O寄存器 单点用0x20 多点用0x26，数据扩展用0x98
+func (toyopuc *client) readBit(a *Address, bitAddr, quantity uint16) (results []byte, err error) {
+	if quantity < 1 || quantity > 0x80 {
+		err = fmt.Errorf("toyopuc: quantity '%v' must be between '%v' and '%v',", quantity, 1, 0x80)
+		return
+	}
+	addrs := bitAddresses(bitAddr, quantity)
+	switch a.Family {
+	case FamilyIO:
+		if quantity == 1 {
+			var on bool
+			if on, err = toyopuc.ReadIOBit(bitAddr); err != nil {
+				return
+			}
+			results = []byte{boolToByte(on)}
+			return
+		}
+		var bits []bool
+		if bits, err = toyopuc.ReadIOMultipointBit(addrs); err != nil {
+			return
+		}
+		results = make([]byte, len(bits))
+		for k, v := range bits {
+			results[k] = boolToByte(v)
+		}
+		return
+	case FamilyDataExpansion:
+		var data []byte
+		no := repeatNo(a.No, len(addrs))
+		data, err = toyopuc.ReadDataExpansionMultipoint(byte(quantity), 0, 0, no, addrs, nil, nil, nil, nil)
+		if err != nil {
+			return
+		}
+		results = unpackBits(data, int(quantity))
+		return
+	}
+	err = fmt.Errorf("toyopuc: address '%v' bit access is not supported by %v commands", a, a.Family)
+	return
+}
+
+// writeBit 位设备 位写入
+// I/O寄存器 单点用0x21 多点用0x27，数据扩展用0x99
+func (toyopuc *client) writeBit(a *Address, bitAddr uint16, value []byte) (err error) {
+	quantity := len(value)
+	if quantity < 1 || quantity > 0x80 {
+		err = fmt.Errorf("toyopuc: quantity '%v' must be between '%v' and '%v',", quantity, 1, 0x80)
+		return
+	}
+	addrs := bitAddresses(bitAddr, uint16(quantity))
+	switch a.Family {
+	case FamilyIO:
+		if quantity == 1 {
+			return toyopuc.WriteIOBit(bitAddr, value[0])
+		}
+		return toyopuc.WriteIOMultipointBit(addrs, value)
+	case FamilyDataExpansion:
+		no := repeatNo(a.No, quantity)
+		return toyopuc.WriteDataExpansionMultipoint(byte(quantity), 0, 0, no, addrs, value, nil, nil, nil, nil, nil, nil)
+	}
+	err = fmt.Errorf("toyopuc: address '%v' bit access is not supported by %v commands", a, a.Family)
+	return
+}
+
+// readWordBit 字设备 位读出
+// 读出覆盖所有位的字后取位
+func (toyopuc *client) readWordBit(a *Address, quantity uint16) (results []byte, err error) {
+	if quantity < 1 {
+		err = fmt.Errorf("toyopuc: quantity '%v' must be greater than '%v',", quantity, 0)
+		return
+	}
+	words := (int(a.Bit) + int(quantity) + 15) / 16
+	data, err := toyopuc.readWord(a, uint16(words))
+	if err != nil {
+		return
+	}
+	if len(data) != words*2 {
+		err = fmt.Errorf("%w: response data size '%v' does not match expected '%v'", ErrLength, len(data), words*2)
+		return
+	}
+	results = make([]byte, quantity)
+	for k := range results {
+		bit := int(a.Bit) + k
+		results[k] = byte(binary.LittleEndian.Uint16(data[bit/16*2:])>>(bit%16)) & 1
+	}
+	return
+}
+
+// writeWordBit 字设备 位写入
+// 读出所在的字，修改后写回
+// 读出与写回之间 PLC 程序或其他连接改变的同一字中的其他位会被写回的旧值覆盖
+func (toyopuc *client) writeWordBit(a *Address, value []byte) (err error) {
+	if len(value) < 1 {
+		err = fmt.Errorf("toyopuc: quantity '%v' must be greater than '%v',", len(value), 0)
+		return
+	}
+	words := (int(a.Bit) + len(value) + 15) / 16
+	data, err := toyopuc.readWord(a, uint16(words))
+	if err != nil {
+		return
+	}
+	if len(data) != words*2 {
+		err = fmt.Errorf("%w: response data size '%v' does not match expected '%v'", ErrLength, len(data), words*2)
+		return
+	}
+	current := DecodeUint16s(data)
+	for k, v := range value {
+		bit := int(a.Bit) + k
+		if v != 0 {
+			current[bit/16] |= 1 << (bit % 16)
+		} else {
+			current[bit/16] &^= 1 << (bit % 16)
+		}
+	}
+	return toyopuc.writeWord(a, current)
+}
+
+// bitAddresses 从 start 开始的连续位地址
+func bitAddresses(start, quantity uint16) []uint16 {
+	addrs := make([]uint16, quantity)
+	for k := range addrs {
+		addrs[k] = start + uint16(k)
+	}
+	return addrs
+}
+
+// repeatNo 多点指令中相同的程序号
+func repeatNo(no byte, quantity int) []byte {
+	nos := make([]byte, quantity)
+	for k := range nos {
+		nos[k] = no
+	}
+	return nos
+}
+
+// unpackBits 多点读出的位数据 每字节8位 低位在前
+func unpackBits(data []byte, quantity int) []byte {
+	bits := make([]byte, quantity)
+	for k := range bits {
+		if k/8 < len(data) {
+			bits[k] = data[k/8] >> (k % 8) & 1
+		}
+	}
+	return bits
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func boolToByte(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
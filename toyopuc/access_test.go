@@ -0,0 +1,41 @@
+package toyopuc
+
+import (
+	"errors"
+	"testing"
+)
+
+// shortTransporter 响应的数据只有一个字
+type shortTransporter struct{}
+
+func (shortTransporter) Send(aduRequest []byte) (aduResponse []byte, err error) {
+	return []byte{ResponseFTByte, 0x00, 0x03, 0x00, aduRequest[tcpHeaderSize], 0x34, 0x12}, nil
+}
+
+func TestWordBitShortResponse(t *testing.T) {
+	client := NewClient2(&tcpPackager{RequestFT: RequestFTByte, ResponseFTByte: ResponseFTByte}, shortTransporter{})
+	// D0100.3 起 20 位 需要 2 个字
+	if _, err := client.Read("D0100.3", 20); !errors.Is(err, ErrLength) {
+		t.Errorf("Read error = %v, want %v", err, ErrLength)
+	}
+	if err := client.Write("D0100.3", make([]byte, 20)); !errors.Is(err, ErrLength) {
+		t.Errorf("Write error = %v, want %v", err, ErrLength)
+	}
+}
+
+func TestPC10BlockShortResponse(t *testing.T) {
+	client := NewClient2(&tcpPackager{RequestFT: RequestFTByte, ResponseFTByte: ResponseFTByte}, shortTransporter{})
+	if _, err := client.ReadPC10Block(PC10Address(0, 0x0200), 4); !errors.Is(err, ErrLength) {
+		t.Errorf("ReadPC10Block error = %v, want %v", err, ErrLength)
+	}
+	if _, err := client.ReadPC10Block(PC10Address(0, 0x0200), 2); err != nil {
+		t.Errorf("ReadPC10Block error = %v", err)
+	}
+}
+
+func TestFRShortResponse(t *testing.T) {
+	client := NewClient2(&tcpPackager{RequestFT: RequestFTByte, ResponseFTByte: ResponseFTByte}, shortTransporter{})
+	if _, err := client.ReadFR(0x10, 2); !errors.Is(err, ErrLength) {
+		t.Errorf("ReadFR error = %v, want %v", err, ErrLength)
+	}
+}
@@ -0,0 +1,505 @@
+package toyopuc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Family 指令族
+// 决定地址使用哪一组功能码访问
+type Family byte
+
+const (
+	// 基本I/O寄存器 (0x1C - 0x27)
+	FamilyIO Family = iota
+	// 顺序程序 (0x18 0x19)
+	FamilySequentialProgram
+	// 程序扩展 (0x90 0x91)
+	FamilyProgramExpansion
+	// 数据扩展 (0x94 - 0x99)
+	FamilyDataExpansion
+)
+
+// String 指令族名称
+func (f Family) String() string {
+	switch f {
+	case FamilyIO:
+		return "io"
+	case FamilySequentialProgram:
+		return "sequential program"
+	case FamilyProgramExpansion:
+		return "program expansion"
+	case FamilyDataExpansion:
+		return "data expansion"
+	}
+	return "unknown"
+}
+
+// Unit 访问单位
+type Unit byte
+
+const (
+	UnitBit Unit = iota
+	UnitByte
+	UnitWord
+)
+
+// String 访问单位名称
+func (u Unit) String() string {
+	switch u {
+	case UnitBit:
+		return "bit"
+	case UnitByte:
+		return "byte"
+	case UnitWord:
+		return "word"
+	}
+	return "unknown"
+}
+
+// Address 解析后的设备地址
+type Address struct {
+	// 设备名 如 D M EX U
+	Device string
+	// 程序号 P1- P2- P3- 前缀，无前缀为0
+	Program byte
+	// 指令族
+	Family Family
+	// 扩展指令中的程序号/区域号 (0x90 - 0x99 的 no)
+	// 00 扩展区域 01 PRG1 02 PRG2 03 PRG3 07 GX/GY 08 - 0B U
+	No byte
+	// 访问单位
+	Unit Unit
+	// 字地址 指令地址空间中的字地址
+	Word uint16
+	// 位号 0 - 15，仅 UnitBit 有效
+	Bit byte
+	// 高位字节，仅 UnitByte 有效
+	High bool
+}
+
+// ByteAddress 字节地址
+// 字地址*2，高位字节+1
+func (a *Address) ByteAddress() uint16 {
+	if a.High {
+		return a.Word*2 + 1
+	}
+	return a.Word * 2
+}
+
+// BitAddress 位地址
+// 只有位设备 (P K V T C L X Y M 等) 的位访问有位地址，字设备的位 (D0100.3) 返回 false
+func (a *Address) BitAddress() (uint16, bool) {
+	d := lookupDevice(a.Device)
+	if d == nil || !d.bit || a.Unit != UnitBit {
+		return 0, false
+	}
+	return a.Word*16 + uint16(a.Bit), true
+}
+
+// offset 向后偏移 words 个字的地址
+// 分段的设备 (U) 跨越区域时区域号加1
+func (a *Address) offset(words uint32) *Address {
+	b := *a
+	d := lookupDevice(a.Device)
+	if d != nil && d.segment > 0 {
+		n := d.number(a.No, a.Word) + words
+		b.No, b.Word = d.no+byte(n/d.segment), d.base+uint16(n%d.segment)
+		return &b
+	}
+	b.Word += uint16(words)
+	return &b
+}
+
+// Offset 向后偏移 n 个访问单位 (字、字节或位) 的地址
+// 如 D0100 偏移 2 为 D0102，D0100L 偏移 1 为 D0100H，M0017 偏移 1 为 M0018
+func (a *Address) Offset(n int) *Address {
+	switch a.Unit {
+	case UnitWord:
+		return a.offset(uint32(n))
+	case UnitByte:
+		k := n
+		if a.High {
+			k++
+		}
+		b := a.offset(uint32(k / 2))
+		b.High = k%2 == 1
+		return b
+	}
+	k := int(a.Bit) + n
+	b := a.offset(uint32(k / 16))
+	b.Bit = byte(k % 16)
+	return b
+}
+
+// PC10 扩展模式的区域号 (32位地址的高8位)
+// 00 - 0B 与数据扩展的 no 相同
+const (
+	// 文件寄存器 FR 的第一个区域号
+	// FR 0x200000 字分为 64 个区域 0x40 - 0x7F，每区域 0x8000 字
+	PC10AreaFR = 0x40
+)
+
+// PC10Address PC10 扩展模式的32位地址
+// 区域号<<24 | 区域内的字节地址 (位读写时为位地址)
+func PC10Address(area byte, offset uint32) uint32 {
+	return uint32(area)<<24 | offset&0xFFFFFF
+}
+
+// PC10Address 设备地址的 PC10 32位地址
+// 只有数据扩展的设备 (扩展区域、P1- P2- P3- 前缀的基本设备、GX/GY、U) 有 PC10 地址
+// 字、字节访问为字节地址，位访问为位地址 (字设备的位为 字地址*16+位号)
+func (a *Address) PC10Address() (address uint32, err error) {
+	if a.Family != FamilyDataExpansion {
+		err = fmt.Errorf("toyopuc: address '%v' cannot be used with PC10 commands, only data expansion devices", a)
+		return
+	}
+	switch a.Unit {
+	case UnitBit:
+		return PC10Address(a.No, uint32(a.Word)*16+uint32(a.Bit)), nil
+	case UnitByte:
+		return PC10Address(a.No, uint32(a.ByteAddress())), nil
+	}
+	return PC10Address(a.No, uint32(a.Word)*2), nil
+}
+
+// wordsInFrame 一帧能访问的字数 不超过 max，不跨越区域号
+func (a *Address) wordsInFrame(quantity, max int) int {
+	if quantity > max {
+		quantity = max
+	}
+	d := lookupDevice(a.Device)
+	if d != nil && d.segment > 0 {
+		if rest := int(d.segment) - int(a.Word-d.base); quantity > rest {
+			quantity = rest
+		}
+	}
+	return quantity
+}
+
+// bytesInFrame 一帧能访问的字节数 不超过 max，不跨越区域号
+// 从高位字节开始时第一个字只有一个字节
+func (a *Address) bytesInFrame(quantity, max int) int {
+	high := 0
+	if a.High {
+		high = 1
+	}
+	if n := a.wordsInFrame((quantity+high+1)/2, (max+high)/2)*2 - high; quantity > n {
+		quantity = n
+	}
+	return quantity
+}
+
+// String 规范化的设备地址
+func (a *Address) String() string {
+	var sb strings.Builder
+	if a.Program != 0 {
+		fmt.Fprintf(&sb, "P%d-", a.Program)
+	}
+	d := lookupDevice(a.Device)
+	if d == nil {
+		return sb.String() + a.Device
+	}
+	n := d.number(a.No, a.Word)
+	sb.WriteString(a.Device)
+	switch {
+	case a.Unit == UnitWord && d.bit:
+		fmt.Fprintf(&sb, "%0*X%s", d.digits-1, n, "W")
+	case a.Unit == UnitWord:
+		fmt.Fprintf(&sb, "%0*X", d.digits, n)
+	case a.Unit == UnitByte:
+		if d.bit {
+			fmt.Fprintf(&sb, "%0*X", d.digits-1, n)
+		} else {
+			fmt.Fprintf(&sb, "%0*X", d.digits, n)
+		}
+		if a.High {
+			sb.WriteString("H")
+		} else {
+			sb.WriteString("L")
+		}
+	case d.bit:
+		fmt.Fprintf(&sb, "%0*X", d.digits, n*16+uint32(a.Bit))
+	default:
+		fmt.Fprintf(&sb, "%0*X.%X", d.digits, n, a.Bit)
+	}
+	return sb.String()
+}
+
+// device 设备定义
+type device struct {
+	// 设备名
+	name string
+	// 位设备 编号为位编号，最后一位十六进制数为位号
+	bit bool
+	// 扩展区域设备 不能带 P1- P2- P3- 前缀
+	ext bool
+	// 编号上限 (位设备为位编号，字设备为字编号)
+	max uint32
+	// 编号0 所在的字地址
+	base uint16
+	// 扩展区域号
+	no byte
+	// 显示位数
+	digits int
+	// 分段 大于0时 区域号 = no + 字编号/segment，字地址 = 字编号%segment
+	segment uint32
+}
+
+// word 设备编号 转 (区域号, 字地址)
+func (d *device) word(n uint32) (no byte, word uint16) {
+	if d.bit {
+		n /= 16
+	}
+	if d.segment > 0 {
+		return d.no + byte(n/d.segment), d.base + uint16(n%d.segment)
+	}
+	return d.no, d.base + uint16(n)
+}
+
+// number (区域号, 字地址) 转 字编号
+func (d *device) number(no byte, word uint16) uint32 {
+	n := uint32(word - d.base)
+	if d.segment > 0 {
+		n += uint32(no-d.no) * d.segment
+	}
+	return n
+}
+
+// words 字数 分段的设备为全部区域的字数
+func (d *device) words() uint32 {
+	if d.bit {
+		return (d.max + 1) / 16
+	}
+	return d.max + 1
+}
+
+// contains 指令族、区域号与字地址是否属于该设备
+// 基本设备属于 I/O寄存器 与 数据扩展 no 01 - 03
+func (d *device) contains(family Family, no byte, word uint16) bool {
+	if word < d.base {
+		return false
+	}
+	switch {
+	case family == FamilyProgramExpansion:
+		return d.name == "PRG" && uint32(word-d.base) < d.words()
+	case family == FamilyIO || (family == FamilyDataExpansion && no >= 1 && no <= 3):
+		return !d.ext && d.name != "PRG" && uint32(word-d.base) < d.words()
+	case family == FamilyDataExpansion && d.ext:
+		if d.segment > 0 {
+			return no >= d.no && uint32(no-d.no) < d.words()/d.segment && uint32(word-d.base) < d.segment
+		}
+		return no == d.no && uint32(word-d.base) < d.words()
+	}
+	return false
+}
+
+// addressOf 字地址的设备地址 (字访问) 不属于任何设备时返回nil
+// 共用字地址的设备 (T/C X/Y GXY/GX/GY) 取设备表中的第一个
+func addressOf(family Family, no byte, word uint16) *Address {
+	for i := range devices {
+		d := &devices[i]
+		if !d.contains(family, no, word) {
+			continue
+		}
+		a := &Address{Device: d.name, Family: family, No: no, Unit: UnitWord, Word: word}
+		if family == FamilyProgramExpansion || (family == FamilyDataExpansion && !d.ext) {
+			a.Program = no
+		}
+		return a
+	}
+	return nil
+}
+
+// 设备表
+// 基本区域的字地址与 I/O寄存器 (0x1C) 以及 数据扩展 PRG1 - PRG3 (0x94 no 01 - 03) 相同
+var devices = []device{
+	// 基本位设备
+	{name: "P", bit: true, max: 0x1FF, base: 0x0000, digits: 4},
+	{name: "K", bit: true, max: 0x2FF, base: 0x0020, digits: 4},
+	{name: "V", bit: true, max: 0x0FF, base: 0x0050, digits: 4},
+	{name: "T", bit: true, max: 0x1FF, base: 0x0060, digits: 4},
+	{name: "C", bit: true, max: 0x1FF, base: 0x0060, digits: 4},
+	{name: "L", bit: true, max: 0x7FF, base: 0x0080, digits: 4},
+	{name: "X", bit: true, max: 0x7FF, base: 0x0100, digits: 4},
+	{name: "Y", bit: true, max: 0x7FF, base: 0x0100, digits: 4},
+	{name: "M", bit: true, max: 0x7FF, base: 0x0180, digits: 4},
+	// 基本字设备
+	{name: "S", max: 0x03FF, base: 0x0200, digits: 4},
+	{name: "N", max: 0x01FF, base: 0x0600, digits: 4},
+	{name: "R", max: 0x07FF, base: 0x0800, digits: 4},
+	{name: "D", max: 0x2FFF, base: 0x1000, digits: 4},
+	{name: "B", max: 0x1FFF, base: 0x6000, digits: 4},
+	// 顺序程序
+	{name: "PRG", max: 0x7FFF, base: 0x0000, digits: 4},
+
+	// 扩展位设备 no 00
+	{name: "EP", bit: true, ext: true, max: 0x0FFF, base: 0x0000, digits: 4},
+	{name: "EK", bit: true, ext: true, max: 0x0FFF, base: 0x0100, digits: 4},
+	{name: "EV", bit: true, ext: true, max: 0x0FFF, base: 0x0200, digits: 4},
+	{name: "ET", bit: true, ext: true, max: 0x07FF, base: 0x0300, digits: 4},
+	{name: "EC", bit: true, ext: true, max: 0x07FF, base: 0x0300, digits: 4},
+	{name: "EL", bit: true, ext: true, max: 0x1FFF, base: 0x0380, digits: 4},
+	{name: "EX", bit: true, ext: true, max: 0x07FF, base: 0x0580, digits: 4},
+	{name: "EY", bit: true, ext: true, max: 0x07FF, base: 0x0580, digits: 4},
+	{name: "EM", bit: true, ext: true, max: 0x1FFF, base: 0x0600, digits: 4},
+	// 扩展字设备 no 00
+	{name: "ES", ext: true, max: 0x07FF, base: 0x0800, digits: 4},
+	{name: "EN", ext: true, max: 0x07FF, base: 0x1000, digits: 4},
+	{name: "H", ext: true, max: 0x07FF, base: 0x1800, digits: 4},
+	// GX/GY no 07
+	{name: "GXY", bit: true, ext: true, max: 0xFFFF, base: 0x0000, no: 0x07, digits: 4},
+	{name: "GX", bit: true, ext: true, max: 0xFFFF, base: 0x0000, no: 0x07, digits: 4},
+	{name: "GY", bit: true, ext: true, max: 0xFFFF, base: 0x0000, no: 0x07, digits: 4},
+	// 扩展寄存器 U no 08 - 0B 每个区域 0x8000 字
+	{name: "U", ext: true, max: 0x1FFFF, base: 0x0000, no: 0x08, digits: 5, segment: 0x8000},
+}
+
+// lookupDevice 按设备名查找设备定义
+func lookupDevice(name string) *device {
+	for i := range devices {
+		if devices[i].name == name {
+			return &devices[i]
+		}
+	}
+	return nil
+}
+
+// ParseAddress 解析设备地址
+// 支持的格式:
+//  D0100      字设备 字访问
+//  D0100L     字设备 低位字节
+//  D0100H     字设备 高位字节
+//  D0100.3    字设备的第3位
+//  M0013      位设备 位访问 (最后一位十六进制数为位号)
+//  M0010.3    等同于 M0013，点号前的编号必须以0结尾
+//  M001W      位设备 字访问
+//  M001L      位设备 字节访问
+//  P2-D0100   程序2 的 D0100 (数据扩展 no 02)
+//  EX0000 ES0000 EN0000 H0000 GXY0000 U08000   扩展区域
+func ParseAddress(s string) (addr *Address, err error) {
+	text := strings.ToUpper(strings.TrimSpace(s))
+	rest := text
+	a := &Address{}
+	// 程序号前缀
+	if len(rest) > 3 && rest[0] == 'P' && rest[2] == '-' {
+		if rest[1] < '1' || rest[1] > '3' {
+			err = fmt.Errorf("toyopuc: address '%v' program number must be between '%v' and '%v'", s, 1, 3)
+			return
+		}
+		a.Program = rest[1] - '0'
+		rest = rest[3:]
+	}
+	// 设备名 取最长匹配
+	var d *device
+	for i := range devices {
+		if strings.HasPrefix(rest, devices[i].name) && (d == nil || len(devices[i].name) > len(d.name)) {
+			d = &devices[i]
+		}
+	}
+	if d == nil {
+		err = fmt.Errorf("toyopuc: address '%v' unknown device", s)
+		return
+	}
+	a.Device = d.name
+	rest = rest[len(d.name):]
+	if d.ext && a.Program != 0 {
+		err = fmt.Errorf("toyopuc: address '%v' device '%v' cannot be used with a program number", s, d.name)
+		return
+	}
+	// 编号
+	end := 0
+	for end < len(rest) && isHex(rest[end]) {
+		end++
+	}
+	digits, suffix := rest[:end], rest[end:]
+	if digits == "" {
+		err = fmt.Errorf("toyopuc: address '%v' missing device number", s)
+		return
+	}
+	n64, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil {
+		err = fmt.Errorf("toyopuc: address '%v' invalid device number: %v", s, err)
+		return
+	}
+	n := uint32(n64)
+
+	// 位设备的 W L H 后缀编号为字编号
+	max := d.max
+	if d.bit {
+		max = d.max / 16
+	}
+	switch {
+	case suffix == "":
+		if d.bit {
+			a.Unit = UnitBit
+			a.Bit = byte(n % 16)
+			max = d.max
+		} else {
+			a.Unit = UnitWord
+		}
+	case suffix == "W":
+		a.Unit = UnitWord
+		if d.bit {
+			n *= 16
+		}
+	case suffix == "L" || suffix == "H":
+		a.Unit = UnitByte
+		a.High = suffix == "H"
+		if d.bit {
+			n *= 16
+		}
+	case len(suffix) == 2 && suffix[0] == '.' && isHex(suffix[1]):
+		a.Unit = UnitBit
+		bit, _ := strconv.ParseUint(suffix[1:], 16, 8)
+		a.Bit = byte(bit)
+		if d.bit {
+			if n%16 != 0 {
+				err = fmt.Errorf("toyopuc: address '%v' bit device number must end with 0 when a bit number is given", s)
+				return
+			}
+			n += uint32(bit)
+			max = d.max
+		}
+	default:
+		err = fmt.Errorf("toyopuc: address '%v' invalid suffix '%v'", s, suffix)
+		return
+	}
+	// 范围校验
+	check := n
+	if d.bit && (a.Unit == UnitWord || a.Unit == UnitByte) {
+		check = n / 16
+	}
+	if check > max {
+		err = fmt.Errorf("toyopuc: address '%v' out of range, %v number must be between '%X' and '%X'", s, d.name, 0, max)
+		return
+	}
+	if d.name == "PRG" && a.Unit != UnitWord {
+		err = fmt.Errorf("toyopuc: address '%v' sequential program only supports word access", s)
+		return
+	}
+	a.No, a.Word = d.word(n)
+
+	// 指令族
+	switch {
+	case d.name == "PRG" && a.Program == 0:
+		a.Family = FamilySequentialProgram
+	case d.name == "PRG":
+		a.Family = FamilyProgramExpansion
+		a.No = a.Program
+	case d.ext:
+		a.Family = FamilyDataExpansion
+	case a.Program != 0:
+		a.Family = FamilyDataExpansion
+		a.No = a.Program
+	default:
+		a.Family = FamilyIO
+	}
+	addr = a
+	return
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'A' && c <= 'F')
+}
@@ -0,0 +1,198 @@
+package toyopuc
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		in string
+		// 规范化的地址
+		s string
+		// 指令族 区域号 单位 字地址 位号或高位字节
+		want string
+	}{
+		// 基本位设备的上下限
+		{in: "P0000", s: "P0000", want: "io 0 bit 0000 0"},
+		{in: "P01FF", s: "P01FF", want: "io 0 bit 001F 15"},
+		{in: "K02FF", s: "K02FF", want: "io 0 bit 004F 15"},
+		{in: "V00FF", s: "V00FF", want: "io 0 bit 005F 15"},
+		{in: "T01FF", s: "T01FF", want: "io 0 bit 007F 15"},
+		{in: "C0000", s: "C0000", want: "io 0 bit 0060 0"},
+		{in: "L07FF", s: "L07FF", want: "io 0 bit 00FF 15"},
+		{in: "X07FF", s: "X07FF", want: "io 0 bit 017F 15"},
+		{in: "Y0000", s: "Y0000", want: "io 0 bit 0100 0"},
+		{in: "M07FF", s: "M07FF", want: "io 0 bit 01FF 15"},
+		// 基本字设备的上下限
+		{in: "S03FF", s: "S03FF", want: "io 0 word 05FF 0"},
+		{in: "N01FF", s: "N01FF", want: "io 0 word 07FF 0"},
+		{in: "R07FF", s: "R07FF", want: "io 0 word 0FFF 0"},
+		{in: "D0000", s: "D0000", want: "io 0 word 1000 0"},
+		{in: "D2FFF", s: "D2FFF", want: "io 0 word 3FFF 0"},
+		{in: "B1FFF", s: "B1FFF", want: "io 0 word 7FFF 0"},
+		{in: "PRG7FFF", s: "PRG7FFF", want: "sequential program 0 word 7FFF 0"},
+		// 位号
+		{in: "M0013", s: "M0013", want: "io 0 bit 0181 3"},
+		{in: "M0010.3", s: "M0013", want: "io 0 bit 0181 3"},
+		{in: "m0010.f", s: "M001F", want: "io 0 bit 0181 15"},
+		{in: "D0100.3", s: "D0100.3", want: "io 0 bit 1100 3"},
+		{in: " D0100.F ", s: "D0100.F", want: "io 0 bit 1100 15"},
+		// 字与字节
+		{in: "M001W", s: "M001W", want: "io 0 word 0181 0"},
+		{in: "M07FW", s: "M07FW", want: "io 0 word 01FF 0"},
+		{in: "M001L", s: "M001L", want: "io 0 byte 0181 false"},
+		{in: "M001H", s: "M001H", want: "io 0 byte 0181 true"},
+		{in: "D0100W", s: "D0100", want: "io 0 word 1100 0"},
+		{in: "D0100L", s: "D0100L", want: "io 0 byte 1100 false"},
+		{in: "D0100H", s: "D0100H", want: "io 0 byte 1100 true"},
+		// 程序号
+		{in: "P1-D0100", s: "P1-D0100", want: "data expansion 1 word 1100 0"},
+		{in: "p3-M0013", s: "P3-M0013", want: "data expansion 3 bit 0181 3"},
+		{in: "P2-PRG0010", s: "P2-PRG0010", want: "program expansion 2 word 0010 0"},
+		// 扩展区域
+		{in: "EP0FFF", s: "EP0FFF", want: "data expansion 0 bit 00FF 15"},
+		{in: "EM1FFF", s: "EM1FFF", want: "data expansion 0 bit 07FF 15"},
+		{in: "ES07FF", s: "ES07FF", want: "data expansion 0 word 0FFF 0"},
+		{in: "EN0000", s: "EN0000", want: "data expansion 0 word 1000 0"},
+		{in: "H07FF", s: "H07FF", want: "data expansion 0 word 1FFF 0"},
+		{in: "GXYFFFF", s: "GXYFFFF", want: "data expansion 7 bit 0FFF 15"},
+		{in: "GX0010", s: "GX0010", want: "data expansion 7 bit 0001 0"},
+		// U 的区域边界
+		{in: "U00000", s: "U00000", want: "data expansion 8 word 0000 0"},
+		{in: "U07FFF", s: "U07FFF", want: "data expansion 8 word 7FFF 0"},
+		{in: "U08000", s: "U08000", want: "data expansion 9 word 0000 0"},
+		{in: "U10000", s: "U10000", want: "data expansion 10 word 0000 0"},
+		{in: "U1FFFF", s: "U1FFFF", want: "data expansion 11 word 7FFF 0"},
+		{in: "U08000H", s: "U08000H", want: "data expansion 9 byte 0000 true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			a, err := ParseAddress(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := fmt.Sprintf("%v %v %v %04X ", a.Family, a.No, a.Unit, a.Word)
+			if a.Unit == UnitByte {
+				got += fmt.Sprint(a.High)
+			} else {
+				got += fmt.Sprint(a.Bit)
+			}
+			if got != tt.want {
+				t.Errorf("ParseAddress(%v) = %v, want %v", tt.in, got, tt.want)
+			}
+			if a.String() != tt.s {
+				t.Errorf("String() = %v, want %v", a.String(), tt.s)
+			}
+			// 规范化的地址解析结果相同
+			b, err := ParseAddress(a.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *b != *a {
+				t.Errorf("ParseAddress(%v) = %+v, want %+v", a.String(), *b, *a)
+			}
+		})
+	}
+}
+
+func TestParseAddressErrors(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"Q0100",
+		"D",
+		"D0100X",
+		"D0100.",
+		"D0100.10",
+		"D0100.G",
+		// 超过上限
+		"P0200",
+		"K0300",
+		"V0100",
+		"T0200",
+		"L0800",
+		"X0800",
+		"M0800",
+		"M080W",
+		"M080L",
+		"S0400",
+		"N0200",
+		"R0800",
+		"D3000",
+		"B2000",
+		"PRG8000",
+		"EP1000",
+		"ES0800",
+		"H0800",
+		"GXY10000",
+		"U20000",
+		// 点号前的编号必须以0结尾
+		"M0011.3",
+		// 程序号 1 - 3
+		"P0-D0100",
+		"P4-D0100",
+		// 扩展区域没有程序号
+		"P1-EX0000",
+		"P1-U00000",
+		// 顺序程序只有字访问
+		"PRG0010L",
+		"PRG0010.1",
+	} {
+		if a, err := ParseAddress(in); err == nil {
+			t.Errorf("ParseAddress(%q) = %v, want error", in, a)
+		}
+	}
+}
+
+func TestAddressOffset(t *testing.T) {
+	tests := []struct {
+		in   string
+		n    int
+		want string
+	}{
+		{in: "D0100", n: 2, want: "D0102"},
+		{in: "D0100L", n: 1, want: "D0100H"},
+		{in: "D0100H", n: 1, want: "D0101L"},
+		{in: "M0017", n: 9, want: "M0020"},
+		{in: "D0100.F", n: 1, want: "D0101.0"},
+		{in: "U07FFF", n: 1, want: "U08000"},
+		{in: "U07FFFH", n: 1, want: "U08000L"},
+	}
+	for _, tt := range tests {
+		a, err := ParseAddress(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := a.Offset(tt.n).String(); got != tt.want {
+			t.Errorf("%v offset %v = %v, want %v", tt.in, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestBytesInFrame(t *testing.T) {
+	tests := []struct {
+		in       string
+		quantity int
+		max      int
+		want     int
+	}{
+		{in: "D0100L", quantity: 10, max: 0x200, want: 10},
+		{in: "D0100L", quantity: 0x300, max: 0x200, want: 0x200},
+		{in: "D0100H", quantity: 0x300, max: 0x200, want: 0x1FF},
+		{in: "D0100H", quantity: 0x300, max: 0x1FF, want: 0x1FF},
+		// U 的区域 08 到 U07FFF 为止
+		{in: "U07FFEL", quantity: 6, max: 0x200, want: 4},
+		{in: "U07FFEH", quantity: 6, max: 0x200, want: 3},
+		{in: "U07FFFH", quantity: 6, max: 0x200, want: 1},
+		{in: "U08000L", quantity: 6, max: 0x200, want: 6},
+	}
+	for _, tt := range tests {
+		a, err := ParseAddress(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := a.bytesInFrame(tt.quantity, tt.max); got != tt.want {
+			t.Errorf("%v bytesInFrame(%#x, %#x) = %#x, want %#x", tt.in, tt.quantity, tt.max, got, tt.want)
+		}
+	}
+}
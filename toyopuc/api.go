@@ -1,5 +1,10 @@
 package toyopuc
 
+import (
+	"context"
+	"time"
+)
+
 type Client interface {
 	// 程序顺序
 	// 程序顺序 字读出
@@ -67,6 +72,86 @@ type Client interface {
 
 	// 数据扩展 多点读出
 	ReadDataExpansionMultipoint(numBit, numByte, numWord byte, bitNo []byte, bitAddr []uint16, bytesNo []byte, bytesAddr []uint16, wordNo []byte, wordAddr []uint16) (results []byte, err error)
-	// TODO
 	// 数据扩展 多点写入
+	// 位 1 ON 0 OFF
+	// 字 CDAB
+	WriteDataExpansionMultipoint(numBit, numByte, numWord byte, bitNo []byte, bitAddr []uint16, bitValue []byte, bytesNo []byte, bytesAddr []uint16, bytesValue []byte, wordNo []byte, wordAddr []uint16, wordValue []uint16) (err error)
+
+	// PC10 扩展模式
+	// 32位地址 见 PC10Address
+	// PC10 块读出 字节单位
+	// CDAB
+	ReadPC10Block(address uint32, quantity uint16) (results []byte, err error)
+	// PC10 块写入 字节单位
+	// CDAB
+	WritePC10Block(address uint32, value []byte) (err error)
+	// PC10 多点读出 位为位地址，字节、字为字节地址
+	// 位 每字节8位 + 字节 + 字 CDAB
+	ReadPC10Multipoint(bitAddr, byteAddr, wordAddr []uint32) (results []byte, err error)
+	// PC10 多点写入
+	// 位 1 ON 0 OFF，字 CDAB
+	WritePC10Multipoint(bitAddr []uint32, bitValue []byte, byteAddr []uint32, byteValue []byte, wordAddr []uint32, wordValue []uint16) (err error)
+
+	// 文件寄存器 FR
+	// FR 字地址 0 - 0x1FFFFF，超过一帧时分割为多帧
+	// FR 读出
+	ReadFR(address uint32, quantity int) (results []uint16, err error)
+	// FR 写入 只写入 RAM，断电保持需要 CommitFR
+	WriteFR(address uint32, value []uint16) (err error)
+	// FR 登录 将包含地址范围的块写入闪存并等待完成
+	CommitFR(address uint32, quantity int) (err error)
+
+	// CPU
+	// CPU 状态读出 运行/停止、报警以及异常标志
+	ReadCPUStatus() (status *CPUStatus, err error)
+	// 远程运行
+	RunCPU() (err error)
+	// 远程停止
+	StopCPU() (err error)
+	// 时钟读出 PLC 的时钟没有时区，视为 WithLocation 设置的时区 (默认本地时间)
+	ReadClock() (t time.Time, err error)
+	// 时钟写入 按 WithLocation 设置的时区写入，精度为1秒
+	WriteClock(t time.Time) (err error)
+	// 将 PLC 的时钟设为本机时间 返回同步前的偏差 (PLC - 本机)
+	SyncClock() (drift time.Duration, err error)
+
+	// 按设备地址访问
+	// 按设备地址读出 如 D0100 P2-M0010 EX0000
+	// 根据设备区域自动选择功能码以及 字/字节/位 访问
+	// 字 CDAB，位 每位一个字节 1 ON 0 OFF
+	Read(address string, quantity uint16) (results []byte, err error)
+	// 按设备地址写入
+	// value 格式与 Read 相同
+	// 字设备的位 (D0100.3) 读出所在的字修改后写回，不是原子操作
+	// 期间 PLC 或其他客户端写入同一字的其他位会被覆盖，需要时使用位设备
+	Write(address string, value []byte) (err error)
+
+	// 按结构体标签读出 如 toyopuc:"D0100,int32,cdab" toyopuc:"M0010.3"
+	// v 为结构体指针
+	ReadStruct(v interface{}) (err error)
+	// 按结构体标签写入
+	// 字设备的位字段与 Write 相同，不是原子操作
+	WriteStruct(v interface{}) (err error)
+
+	// 批量读出 分散的地址合并为尽量少的帧
+	// 返回值与 tags 一一对应，格式与 Read 相同
+	ReadTags(tags []Tag) (results [][]byte, err error)
+	// 按 PlanRead 生成的计划批量读出
+	ExecutePlan(plan *ReadPlan) (results [][]byte, err error)
+	// 订阅 每隔 interval 批量读出，只通知变化的值
+	// handler 为nil时通过 Subscription.C 通知
+	Subscribe(tags []Tag, interval time.Duration, handler func(Update)) (sub *Subscription, err error)
+
+	// 返回使用 ctx 的客户端 与原客户端共用连接
+	// 全部读写方法在 ctx 取消或超过期限时中断并返回 ctx 的错误
+	// 分多帧的读写在帧之间检查 ctx
+	// TCP、UDP、串口均支持中断，传输层没有实现 ContextTransporter 时只在发送前检查 ctx
+	// ctx 为nil时等同于 context.Background()
+	WithContext(ctx context.Context) Client
+	// 返回使用重试策略的客户端 与原客户端共用连接
+	// 如 WithRetryPolicy(NewBackoffRetry(3))，为nil时不重试
+	WithRetryPolicy(policy RetryPolicy) Client
+	// 返回按 loc 解释 PLC 时钟的客户端 与原客户端共用连接
+	// PLC 与本机不在同一时区时使用，为nil时为本地时间
+	WithLocation(loc *time.Location) Client
 }
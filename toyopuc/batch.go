@@ -0,0 +1,489 @@
+package toyopuc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// 相邻地址间隙不超过该字数时合并为块读出
+	planMaxGap = 16
+	// 孤立的点不超过该点数时使用多点读出
+	planMaxSparsePoints = 8
+	// I/O寄存器 多点读出 (0x22 0x24 0x26) 的最大点数
+	planMaxIOPoints = 0x80
+	// 数据扩展 多点读出 (0x98) 的最大点数与数据字节数
+	planMaxExpansionPoints = 176
+	planMaxExpansionData   = 128
+)
+
+// Tag 批量读出的点
+type Tag struct {
+	// 设备地址 如 D0100 M0010 P2-D0100
+	Address string
+	// 字/字节/位 的个数，0 视为 1
+	Quantity uint16
+}
+
+// ReadPlan 批量读出计划
+// 将分散的地址合并为尽量少的帧，密集的地址使用块读出 (0x18 0x1C 0x90 0x94)，
+// 稀疏的地址使用多点读出 (0x22 0x24 0x26 0x98)
+type ReadPlan struct {
+	tags   []*planTag
+	frames []*planFrame
+}
+
+// PlanRead 生成批量读出计划
+func PlanRead(tags []Tag) (plan *ReadPlan, err error) {
+	addrs := make([]*Address, len(tags))
+	quantities := make([]uint16, len(tags))
+	for k, t := range tags {
+		if addrs[k], err = ParseAddress(t.Address); err != nil {
+			return
+		}
+		quantities[k] = t.Quantity
+	}
+	return planRead(addrs, quantities)
+}
+
+// Len 帧数
+func (p *ReadPlan) Len() int {
+	return len(p.frames)
+}
+
+// String 每帧的功能码与点数
+func (p *ReadPlan) String() string {
+	var sb strings.Builder
+	for k, f := range p.frames {
+		if k > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(f.String())
+	}
+	return sb.String()
+}
+
+// ReadTags 批量读出
+// 返回值与 tags 一一对应，格式与 Read 相同
+func (toyopuc *client) ReadTags(tags []Tag) (results [][]byte, err error) {
+	plan, err := PlanRead(tags)
+	if err != nil {
+		return
+	}
+	return toyopuc.ExecutePlan(plan)
+}
+
+// ExecutePlan 按计划批量读出
+// 计划可以重复使用
+func (toyopuc *client) ExecutePlan(plan *ReadPlan) (results [][]byte, err error) {
+	view := newPlanView()
+	for _, f := range plan.frames {
+		if err = toyopuc.executeFrame(f, view); err != nil {
+			return
+		}
+	}
+	results = make([][]byte, len(plan.tags))
+	for k, t := range plan.tags {
+		results[k] = t.extract(view)
+	}
+	return
+}
+
+// planKey 指令族与区域号
+type planKey struct {
+	family Family
+	no     byte
+}
+
+// planTag 计划中的一个点
+type planTag struct {
+	addr     *Address
+	quantity uint16
+	key      planKey
+	// 覆盖的字地址 [start, end)
+	start, end uint32
+}
+
+// sparse 能否使用多点读出，以及多点读出的点数
+func (t *planTag) sparse() (points int, ok bool) {
+	if t.key.family != FamilyIO && t.key.family != FamilyDataExpansion {
+		return
+	}
+	switch {
+	case t.addr.Unit == UnitWord, t.addr.Unit == UnitByte, isBitDevice(t.addr):
+		points = int(t.quantity)
+	default:
+		// 字设备的位 读出所在的字
+		points = int(t.end - t.start)
+	}
+	return points, points <= planMaxSparsePoints
+}
+
+// extract 从读出的数据中取出该点的值
+func (t *planTag) extract(view *planView) []byte {
+	results := make([]byte, t.quantity)
+	switch {
+	case t.addr.Unit == UnitWord:
+		results = make([]byte, int(t.quantity)*2)
+		for k := 0; k < int(t.quantity); k++ {
+			binary.LittleEndian.PutUint16(results[k*2:], view.word(t.key, t.addr.Word+uint16(k)))
+		}
+	case t.addr.Unit == UnitByte:
+		for k := range results {
+			results[k] = view.byte(t.key, t.addr.ByteAddress()+uint16(k))
+		}
+	case isBitDevice(t.addr):
+		bitAddr, _ := t.addr.BitAddress()
+		for k := range results {
+			results[k] = view.bit(t.key, bitAddr+uint16(k))
+		}
+	default:
+		for k := range results {
+			bit := int(t.addr.Bit) + k
+			results[k] = byte(view.word(t.key, t.addr.Word+uint16(bit/16))>>(bit%16)) & 1
+		}
+	}
+	return results
+}
+
+// 帧类型
+const (
+	frameBlock = iota
+	frameMultipoint
+)
+
+// planFrame 计划中的一帧
+type planFrame struct {
+	kind int
+	key  planKey
+	// 块读出
+	start, quantity uint16
+	// 多点读出 I/O寄存器只使用其中一种，数据扩展混合
+	bitNo    []byte
+	bitAddr  []uint16
+	bytesNo  []byte
+	byteAddr []uint16
+	wordNo   []byte
+	wordAddr []uint16
+}
+
+// String 功能码与点数
+func (f *planFrame) String() string {
+	switch {
+	case f.kind == frameBlock:
+		return fmt.Sprintf("%v no %v block %#04x+%v", f.key.family, f.key.no, f.start, f.quantity)
+	case f.key.family == FamilyIO:
+		return fmt.Sprintf("io multipoint bit %v byte %v word %v", len(f.bitAddr), len(f.byteAddr), len(f.wordAddr))
+	}
+	return fmt.Sprintf("data expansion multipoint bit %v byte %v word %v", len(f.bitAddr), len(f.byteAddr), len(f.wordAddr))
+}
+
+// points 多点读出的点数
+func (f *planFrame) points() int {
+	return len(f.bitAddr) + len(f.byteAddr) + len(f.wordAddr)
+}
+
+// dataQuantity 数据扩展多点读出的数据字节数
+func (f *planFrame) dataQuantity() int {
+	return (len(f.bitAddr)+7)/8 + len(f.byteAddr) + len(f.wordAddr)*2
+}
+
+// add 将点加入多点读出帧
+func (f *planFrame) add(t *planTag) {
+	no := t.key.no
+	switch {
+	case t.addr.Unit == UnitWord:
+		for k := uint16(0); k < t.quantity; k++ {
+			f.wordNo = append(f.wordNo, no)
+			f.wordAddr = append(f.wordAddr, t.addr.Word+k)
+		}
+	case t.addr.Unit == UnitByte:
+		for k := uint16(0); k < t.quantity; k++ {
+			f.bytesNo = append(f.bytesNo, no)
+			f.byteAddr = append(f.byteAddr, t.addr.ByteAddress()+k)
+		}
+	case isBitDevice(t.addr):
+		bitAddr, _ := t.addr.BitAddress()
+		for k := uint16(0); k < t.quantity; k++ {
+			f.bitNo = append(f.bitNo, no)
+			f.bitAddr = append(f.bitAddr, bitAddr+k)
+		}
+	default:
+		for w := t.start; w < t.end; w++ {
+			f.wordNo = append(f.wordNo, no)
+			f.wordAddr = append(f.wordAddr, uint16(w))
+		}
+	}
+}
+
+// fits 点能否加入数据扩展多点读出帧
+func (f *planFrame) fits(t *planTag) bool {
+	next := &planFrame{}
+	next.add(t)
+	points := f.points() + next.points()
+	data := (len(f.bitAddr)+len(next.bitAddr)+7)/8 + len(f.byteAddr) + len(next.byteAddr) + (len(f.wordAddr)+len(next.wordAddr))*2
+	return points <= planMaxExpansionPoints && data <= planMaxExpansionData
+}
+
+// planRead 生成批量读出计划
+func planRead(addrs []*Address, quantities []uint16) (plan *ReadPlan, err error) {
+	plan = &ReadPlan{}
+	for k, a := range addrs {
+		t := &planTag{addr: a, quantity: quantities[k], key: planKey{family: a.Family, no: a.No}}
+		if t.quantity == 0 {
+			t.quantity = 1
+		}
+		switch {
+		case a.Unit == UnitWord:
+			t.start, t.end = uint32(a.Word), uint32(a.Word)+uint32(t.quantity)
+		case a.Unit == UnitByte:
+			b := uint32(a.ByteAddress())
+			t.start, t.end = b/2, (b+uint32(t.quantity)+1)/2
+		case isBitDevice(a):
+			b, _ := a.BitAddress()
+			t.start, t.end = uint32(b)/16, (uint32(b)+uint32(t.quantity)+15)/16
+		default:
+			t.start, t.end = uint32(a.Word), uint32(a.Word)+(uint32(a.Bit)+uint32(t.quantity)+15)/16
+		}
+		if t.end > 0x10000 {
+			err = fmt.Errorf("toyopuc: address '%v' quantity '%v' is out of range", a, t.quantity)
+			return
+		}
+		plan.tags = append(plan.tags, t)
+	}
+
+	// 按 指令族、区域号、地址 排序后聚类
+	sorted := make([]*planTag, len(plan.tags))
+	copy(sorted, plan.tags)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.key != b.key {
+			if a.key.family != b.key.family {
+				return a.key.family < b.key.family
+			}
+			return a.key.no < b.key.no
+		}
+		return a.start < b.start
+	})
+	var clusters [][]*planTag
+	var end uint32
+	for _, t := range sorted {
+		n := len(clusters)
+		if n > 0 {
+			last := clusters[n-1]
+			first := last[0]
+			if first.key == t.key && t.start <= end+planMaxGap && maxUint32(end, t.end)-first.start <= frameMaxReadWords {
+				clusters[n-1] = append(last, t)
+				end = maxUint32(end, t.end)
+				continue
+			}
+		}
+		clusters = append(clusters, []*planTag{t})
+		end = t.end
+	}
+
+	// 孤立的点使用多点读出，其他使用块读出
+	var ioSparse [3][]*planTag // 位 字节 字
+	var expansionSparse []*planTag
+	for _, c := range clusters {
+		if len(c) == 1 {
+			t := c[0]
+			if _, ok := t.sparse(); ok {
+				if t.key.family == FamilyDataExpansion {
+					expansionSparse = append(expansionSparse, t)
+					continue
+				}
+				switch {
+				case t.addr.Unit == UnitByte:
+					ioSparse[1] = append(ioSparse[1], t)
+				case isBitDevice(t.addr):
+					ioSparse[0] = append(ioSparse[0], t)
+				default:
+					ioSparse[2] = append(ioSparse[2], t)
+				}
+				continue
+			}
+		}
+		start, end := c[0].start, c[0].end
+		for _, t := range c[1:] {
+			end = maxUint32(end, t.end)
+		}
+		// 超过一帧时分割
+		for s := start; s < end; s += frameMaxReadWords {
+			q := end - s
+			if q > frameMaxReadWords {
+				q = frameMaxReadWords
+			}
+			plan.frames = append(plan.frames, &planFrame{kind: frameBlock, key: c[0].key, start: uint16(s), quantity: uint16(q)})
+		}
+	}
+	for _, list := range ioSparse {
+		var f *planFrame
+		for _, t := range list {
+			points, _ := t.sparse()
+			if f == nil || f.points()+points > planMaxIOPoints {
+				f = &planFrame{kind: frameMultipoint, key: planKey{family: FamilyIO}}
+				plan.frames = append(plan.frames, f)
+			}
+			f.add(t)
+		}
+	}
+	var f *planFrame
+	for _, t := range expansionSparse {
+		if f == nil || !f.fits(t) {
+			f = &planFrame{kind: frameMultipoint, key: planKey{family: FamilyDataExpansion}}
+			plan.frames = append(plan.frames, f)
+		}
+		f.add(t)
+	}
+	return
+}
+
+// executeFrame 执行一帧，结果写入 view
+func (toyopuc *client) executeFrame(f *planFrame, view *planView) (err error) {
+	var data []byte
+	if f.kind == frameBlock {
+		a := &Address{Family: f.key.family, No: f.key.no, Unit: UnitWord, Word: f.start}
+		if data, err = toyopuc.readWord(a, f.quantity); err != nil {
+			return
+		}
+		words := DecodeUint16s(data)
+		for k, v := range words {
+			view.setWord(f.key, f.start+uint16(k), v)
+		}
+		return
+	}
+	if f.key.family == FamilyIO {
+		switch {
+		case len(f.bitAddr) > 0:
+			var bits []bool
+			if bits, err = toyopuc.ReadIOMultipointBit(f.bitAddr); err != nil {
+				return
+			}
+			if err = multipointLength(len(bits), len(f.bitAddr)); err != nil {
+				return
+			}
+			for k, v := range bits {
+				view.setBit(f.key, f.bitAddr[k], boolToByte(v))
+			}
+		case len(f.byteAddr) > 0:
+			if data, err = toyopuc.ReadIOMultipointByte(f.byteAddr); err != nil {
+				return
+			}
+			if err = multipointLength(len(data), len(f.byteAddr)); err != nil {
+				return
+			}
+			for k, v := range data {
+				view.setByte(f.key, f.byteAddr[k], v)
+			}
+		case len(f.wordAddr) > 0:
+			if data, err = toyopuc.ReadIOMultipointWord(f.wordAddr); err != nil {
+				return
+			}
+			if err = multipointLength(len(data), len(f.wordAddr)*2); err != nil {
+				return
+			}
+			for k, v := range DecodeUint16s(data) {
+				view.setWord(f.key, f.wordAddr[k], v)
+			}
+		}
+		return
+	}
+	data, err = toyopuc.ReadDataExpansionMultipoint(byte(len(f.bitAddr)), byte(len(f.byteAddr)), byte(len(f.wordAddr)), f.bitNo, f.bitAddr, f.bytesNo, f.byteAddr, f.wordNo, f.wordAddr)
+	if err != nil {
+		return
+	}
+	bitBytes := (len(f.bitAddr) + 7) / 8
+	if err = multipointLength(len(data), f.dataQuantity()); err != nil {
+		return
+	}
+	for k, v := range unpackBits(data, len(f.bitAddr)) {
+		view.setBit(planKey{family: FamilyDataExpansion, no: f.bitNo[k]}, f.bitAddr[k], v)
+	}
+	for k, v := range data[bitBytes : bitBytes+len(f.byteAddr)] {
+		view.setByte(planKey{family: FamilyDataExpansion, no: f.bytesNo[k]}, f.byteAddr[k], v)
+	}
+	words := DecodeUint16s(data[bitBytes+len(f.byteAddr):])
+	for k := range f.wordAddr {
+		view.setWord(planKey{family: FamilyDataExpansion, no: f.wordNo[k]}, f.wordAddr[k], words[k])
+	}
+	return
+}
+
+// multipointLength 多点读出响应的数据长度必须与请求的点一致
+func multipointLength(n, expected int) error {
+	if n != expected {
+		return fmt.Errorf("%w: multipoint response data size '%v' does not match expected '%v'", ErrLength, n, expected)
+	}
+	return nil
+}
+
+// planView 读出结果 按 指令族、区域号 记录 字/字节/位
+type planView struct {
+	words map[planKey]map[uint16]uint16
+	bytes map[planKey]map[uint16]byte
+	bits  map[planKey]map[uint16]byte
+}
+
+func newPlanView() *planView {
+	return &planView{
+		words: make(map[planKey]map[uint16]uint16),
+		bytes: make(map[planKey]map[uint16]byte),
+		bits:  make(map[planKey]map[uint16]byte),
+	}
+}
+
+func (v *planView) setWord(key planKey, addr uint16, value uint16) {
+	if v.words[key] == nil {
+		v.words[key] = make(map[uint16]uint16)
+	}
+	v.words[key][addr] = value
+}
+
+func (v *planView) setByte(key planKey, addr uint16, value byte) {
+	if v.bytes[key] == nil {
+		v.bytes[key] = make(map[uint16]byte)
+	}
+	v.bytes[key][addr] = value
+}
+
+func (v *planView) setBit(key planKey, addr uint16, value byte) {
+	if v.bits[key] == nil {
+		v.bits[key] = make(map[uint16]byte)
+	}
+	v.bits[key][addr] = value
+}
+
+// word 字 来自块读出或多点字读出
+func (v *planView) word(key planKey, addr uint16) uint16 {
+	return v.words[key][addr]
+}
+
+// byte 字节 优先多点字节读出，否则取所在的字
+func (v *planView) byte(key planKey, addr uint16) byte {
+	if b, ok := v.bytes[key][addr]; ok {
+		return b
+	}
+	w := v.word(key, addr/2)
+	if addr%2 == 1 {
+		return byte(w >> 8)
+	}
+	return byte(w)
+}
+
+// bit 位 优先多点位读出，否则取所在的字
+func (v *planView) bit(key planKey, addr uint16) byte {
+	if b, ok := v.bits[key][addr]; ok {
+		return b
+	}
+	return byte(v.word(key, addr/16)>>(addr%16)) & 1
+}
+
+func maxUint32(a, b uint32) uint32 {
+	if a > b {
+		return a
+	}
+	return b
+}
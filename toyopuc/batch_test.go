@@ -0,0 +1,104 @@
+package toyopuc
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPlanRead(t *testing.T) {
+	tests := []struct {
+		name string
+		tags []Tag
+		want []string
+	}{
+		{
+			name: "scattered",
+			tags: []Tag{{Address: "D0200"}, {Address: "D0100"}, {Address: "D0110"}},
+			want: []string{
+				"io no 0 block 0x1100+17",
+				"io multipoint bit 0 byte 0 word 1",
+			},
+		},
+		{
+			name: "gap at threshold",
+			tags: []Tag{{Address: "D0100"}, {Address: "D0111"}},
+			want: []string{"io no 0 block 0x1100+18"},
+		},
+		{
+			name: "gap over threshold",
+			tags: []Tag{{Address: "D0100"}, {Address: "D0112"}},
+			want: []string{"io multipoint bit 0 byte 0 word 2"},
+		},
+		{
+			name: "dense tag is not sparse",
+			tags: []Tag{{Address: "D0100", Quantity: 9}},
+			want: []string{"io no 0 block 0x1100+9"},
+		},
+		{
+			name: "mixed families",
+			tags: []Tag{
+				{Address: "D0100"},
+				{Address: "M0010"},
+				{Address: "D0300H"},
+				{Address: "P2-D0100", Quantity: 2},
+				{Address: "P1-M0013"},
+				{Address: "PRG0010"},
+				{Address: "U08000", Quantity: 20},
+			},
+			want: []string{
+				"sequential program no 0 block 0x0010+1",
+				"data expansion no 9 block 0x0000+20",
+				"io multipoint bit 1 byte 0 word 0",
+				"io multipoint bit 0 byte 1 word 0",
+				"io multipoint bit 0 byte 0 word 1",
+				"data expansion multipoint bit 1 byte 0 word 2",
+			},
+		},
+		{
+			name: "split over frame limit",
+			tags: []Tag{{Address: "D0000"}, {Address: "D0200", Quantity: 0x200}},
+			want: []string{
+				"io no 0 block 0x1200+253",
+				"io no 0 block 0x12fd+253",
+				"io no 0 block 0x13fa+6",
+				"io multipoint bit 0 byte 0 word 1",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := PlanRead(tt.tags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := plan.String(); got != strings.Join(tt.want, "\n") {
+				t.Errorf("PlanRead(%v) =\n%v\nwant\n%v", tt.tags, got, strings.Join(tt.want, "\n"))
+			}
+			if plan.Len() != len(tt.want) {
+				t.Errorf("Len() = %v, want %v", plan.Len(), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestPlanReadInvalidAddress(t *testing.T) {
+	tags := []Tag{{Address: "D0100"}, {Address: "Q0100"}}
+	if _, err := PlanRead(tags); err == nil {
+		t.Errorf("PlanRead(%v) succeeded", tags)
+	}
+}
+
+func TestExecutePlanShortResponse(t *testing.T) {
+	client := NewClient2(&tcpPackager{RequestFT: RequestFTByte, ResponseFTByte: ResponseFTByte}, shortTransporter{})
+	for _, tags := range [][]Tag{
+		{{Address: "D0100"}, {Address: "D0200"}},
+		{{Address: "D0100L"}, {Address: "D0200L"}, {Address: "D0300L"}},
+		{{Address: "M0000"}, {Address: "M0200"}, {Address: "M0400"}},
+		{{Address: "P1-D0100"}, {Address: "P2-D0100"}},
+	} {
+		if _, err := client.ReadTags(tags); !errors.Is(err, ErrLength) {
+			t.Errorf("ReadTags(%v) error = %v, want %v", tags, err, ErrLength)
+		}
+	}
+}
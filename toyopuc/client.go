@@ -1,8 +1,10 @@
 package toyopuc
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
+	"time"
 )
 
 // ClientHandler is the interface that groups the Packager and Transporter methods.
@@ -14,6 +16,12 @@ type ClientHandler interface {
 type client struct {
 	packager    Packager
 	transporter Transporter
+	// WithContext 设置 为nil时不检查
+	ctx context.Context
+	// WithRetryPolicy 设置 为nil时不重试
+	retry RetryPolicy
+	// WithLocation 设置 为nil时为本地时间
+	location *time.Location
 }
 
 // NewClient creates a new toyopuc client with given backend handler.
@@ -26,6 +34,17 @@ func NewClient2(packager Packager, transporter Transporter) Client {
 	return &client{packager: packager, transporter: transporter}
 }
 
+// WithContext returns a shallow copy of the client which sends with ctx.
+// A nil ctx is treated as context.Background().
+func (toyopuc *client) WithContext(ctx context.Context) Client {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	c := *toyopuc
+	c.ctx = ctx
+	return &c
+}
+
 // ReadSequentialProgramWord
 // 顺序程序 读字
 //  Function code         : 1 byte (0x18)
@@ -43,9 +62,8 @@ func (toyopuc *client) ReadSequentialProgramWord(address, quantity uint16) (resu
 	if err != nil {
 		return
 	}
-	// TODO
-	// []byte to []uint16
 	// CDAB
+	// 使用 DecodeUint16s 等转换为数值
 	results = response.Data
 	return
 }
@@ -88,9 +106,8 @@ func (toyopuc *client) ReadIOWord(address, quantity uint16) (results []byte, err
 	if err != nil {
 		return
 	}
-	// TODO
-	// []byte to []uint16
 	// CDAB
+	// 使用 DecodeUint16s 等转换为数值
 	results = response.Data
 	return
 }
@@ -150,11 +167,10 @@ func (toyopuc *client) WriteIOByte(address uint16, value []byte) (err error) {
 		FunctionCode: FunIOWriteByte,
 		Data:         dataBlockSuffixByte(value, address),
 	}
-	r, err := toyopuc.send(&request)
+	_, err = toyopuc.send(&request)
 	if err != nil {
 		return
 	}
-	fmt.Println(r)
 	return
 }
 
@@ -186,11 +202,10 @@ func (toyopuc *client) WriteIOBit(address uint16, value byte) (err error) {
 		FunctionCode: FunIOWriteBit,
 		Data:         dataBlockSuffixBit(value, address),
 	}
-	r, err := toyopuc.send(&request)
+	_, err = toyopuc.send(&request)
 	if err != nil {
 		return
 	}
-	fmt.Println(r)
 	return
 }
 
@@ -212,9 +227,8 @@ func (toyopuc *client) ReadIOMultipointWord(address []uint16) (results []byte, e
 	if err != nil {
 		return
 	}
-	// TODO
-	// []byte to []uint16
 	// CDAB
+	// 使用 DecodeUint16s 等转换为数值
 	results = response.Data
 	return
 }
@@ -362,9 +376,8 @@ func (toyopuc *client) ReadProgramExpansionWord(no byte, address, quantity uint1
 	if err != nil {
 		return
 	}
-	// TODO
-	// []byte to []uint16
 	// CDAB
+	// 使用 DecodeUint16s 等转换为数值
 	results = response.Data
 	return
 }
@@ -406,9 +419,8 @@ func (toyopuc *client) ReadDataExpansionWord(no byte, address, quantity uint16)
 	if err != nil {
 		return
 	}
-	// TODO
-	// []byte to []uint16
 	// CDAB
+	// 使用 DecodeUint16s 等转换为数值
 	results = response.Data
 	return
 }
@@ -468,11 +480,10 @@ func (toyopuc *client) WriteDataExpansionByte(no byte, address uint16, value []b
 		FunctionCode: FunDataExpansionWriteByte,
 		Data:         dataBlockExpansionSuffixByte(no, value, address),
 	}
-	r, err := toyopuc.send(&request)
+	_, err = toyopuc.send(&request)
 	if err != nil {
 		return
 	}
-	fmt.Println(r)
 	return
 }
 
@@ -480,12 +491,13 @@ func (toyopuc *client) WriteDataExpansionByte(no byte, address uint16, value []b
 // 数据扩展 读多点
 //  Function code         : 1 byte (0x98)
 func (toyopuc *client) ReadDataExpansionMultipoint(numBit, numByte, numWord byte, bitNo []byte, bitAddr []uint16, bytesNo []byte, bytesAddr []uint16, wordNo []byte, wordAddr []uint16) (results []byte, err error) {
-	quantity := numBit + numByte + numWord
+	quantity := int(numBit) + int(numByte) + int(numWord)
 	if quantity < 1 || quantity > 176 {
 		err = fmt.Errorf("toyopuc: address quantity '%v' must be between '%v' and '%v',", quantity, 1, 176)
 		return
 	}
-	dataQuantity := numBit/8 + numByte + numWord*2
+	// 位数据每8位一个字节
+	dataQuantity := (int(numBit)+7)/8 + int(numByte) + int(numWord)*2
 	if dataQuantity < 1 || dataQuantity > 128 {
 		err = fmt.Errorf("toyopuc: data quantity '%v' must be between '%v' and '%v',", dataQuantity, 1, 128)
 		return
@@ -502,17 +514,177 @@ func (toyopuc *client) ReadDataExpansionMultipoint(numBit, numByte, numWord byte
 	return
 }
 
+// WriteDataExpansionMultipoint
+// 数据扩展 写多点
+//  Function code         : 1 byte (0x99)
+func (toyopuc *client) WriteDataExpansionMultipoint(numBit, numByte, numWord byte, bitNo []byte, bitAddr []uint16, bitValue []byte, bytesNo []byte, bytesAddr []uint16, bytesValue []byte, wordNo []byte, wordAddr []uint16, wordValue []uint16) (err error) {
+	// 点数与地址、值的数量必须一致
+	if err = multipointQuantity(numBit, bitNo, len(bitAddr), len(bitValue)); err != nil {
+		return
+	}
+	if err = multipointQuantity(numByte, bytesNo, len(bytesAddr), len(bytesValue)); err != nil {
+		return
+	}
+	if err = multipointQuantity(numWord, wordNo, len(wordAddr), len(wordValue)); err != nil {
+		return
+	}
+	quantity := int(numBit) + int(numByte) + int(numWord)
+	if quantity < 1 || quantity > 176 {
+		err = fmt.Errorf("toyopuc: address quantity '%v' must be between '%v' and '%v',", quantity, 1, 176)
+		return
+	}
+	dataQuantity := (int(numBit)+7)/8 + int(numByte) + int(numWord)*2
+	if dataQuantity < 1 || dataQuantity > 128 {
+		err = fmt.Errorf("toyopuc: data quantity '%v' must be between '%v' and '%v',", dataQuantity, 1, 128)
+		return
+	}
+	request := ProtocolDataUnit{
+		FunctionCode: FunDataExpansionWriteMultipoint,
+		Data:         dataBlockExpansionSuffixMultipointValue(numBit, numByte, numWord, bitNo, bitAddr, bitValue, bytesNo, bytesAddr, bytesValue, wordNo, wordAddr, wordValue),
+	}
+	_, err = toyopuc.send(&request)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// ReadPC10Block
+// PC10 块读出 字节单位
+//  Function code         : 1 byte (0xC2)
+//  Address               : 4 bytes 区域号<<24 | 字节地址
+//  Quantity              : 2 bytes 字节数
+func (toyopuc *client) ReadPC10Block(address uint32, quantity uint16) (results []byte, err error) {
+	// 长度校验
+	if quantity < 1 || quantity > 0x400 {
+		err = fmt.Errorf("toyopuc: quantity '%v' must be between '%v' and '%v',", quantity, 1, 0x400)
+		return
+	}
+	request := ProtocolDataUnit{
+		FunctionCode: FunPC10ReadBlock,
+		Data:         dataBlockExpansionPC10(address, quantity),
+	}
+	response, err := toyopuc.send(&request)
+	if err != nil {
+		return
+	}
+	if len(response.Data) != int(quantity) {
+		err = fmt.Errorf("%w: response data size '%v' does not match expected '%v'", ErrLength, len(response.Data), quantity)
+		return
+	}
+	// 字数据 CDAB
+	results = response.Data
+	return
+}
+
+// WritePC10Block
+// PC10 块写入 字节单位
+//  Function code         : 1 byte (0xC3)
+func (toyopuc *client) WritePC10Block(address uint32, value []byte) (err error) {
+	quantity := len(value)
+	if quantity < 1 || quantity > 0x400 {
+		err = fmt.Errorf("toyopuc: quantity '%v' must be between '%v' and '%v',", quantity, 1, 0x400)
+		return
+	}
+	request := ProtocolDataUnit{
+		FunctionCode: FunPC10WriteBlock,
+		Data:         dataBlockExpansionSuffixPC10(value, address),
+	}
+	_, err = toyopuc.send(&request)
+	return
+}
+
+// ReadPC10Multipoint
+// PC10 多点读出 位地址、字节地址、字 (字节地址，必须为偶数)
+//  Function code         : 1 byte (0xC4)
+// 响应: 位 (每字节8位 低位在前) + 字节 + 字 (CDAB)
+func (toyopuc *client) ReadPC10Multipoint(bitAddr, byteAddr, wordAddr []uint32) (results []byte, err error) {
+	if err = pc10MultipointQuantity(len(bitAddr), len(byteAddr), len(wordAddr)); err != nil {
+		return
+	}
+	request := ProtocolDataUnit{
+		FunctionCode: FunPC10ReadMultipoint,
+		Data:         dataBlockExpansionSuffixMultipointPC10(bitAddr, byteAddr, wordAddr),
+	}
+	response, err := toyopuc.send(&request)
+	if err != nil {
+		return
+	}
+	results = response.Data
+	return
+}
+
+// WritePC10Multipoint
+// PC10 多点写入
+//  Function code         : 1 byte (0xC5)
+// 位 1 ON 0 OFF，字 CDAB
+func (toyopuc *client) WritePC10Multipoint(bitAddr []uint32, bitValue []byte, byteAddr []uint32, byteValue []byte, wordAddr []uint32, wordValue []uint16) (err error) {
+	if len(bitAddr) != len(bitValue) || len(byteAddr) != len(byteValue) || len(wordAddr) != len(wordValue) {
+		err = fmt.Errorf("toyopuc: the quantity of addresses and values must be equal, bit: '%v' '%v', byte: '%v' '%v', word: '%v' '%v'",
+			len(bitAddr), len(bitValue), len(byteAddr), len(byteValue), len(wordAddr), len(wordValue))
+		return
+	}
+	if err = pc10MultipointQuantity(len(bitAddr), len(byteAddr), len(wordAddr)); err != nil {
+		return
+	}
+	request := ProtocolDataUnit{
+		FunctionCode: FunPC10WriteMultipoint,
+		Data:         dataBlockExpansionSuffixMultipointValuePC10(bitAddr, bitValue, byteAddr, byteValue, wordAddr, wordValue),
+	}
+	_, err = toyopuc.send(&request)
+	return
+}
+
 // Helpers
 
+// pc10MultipointQuantity 校验 PC10 多点读写的点数与数据字节数
+func pc10MultipointQuantity(numBit, numByte, numWord int) (err error) {
+	quantity := numBit + numByte + numWord
+	if numBit > 0xFF || numByte > 0xFF || numWord > 0xFF || quantity < 1 || quantity > PC10MaxPoints {
+		err = fmt.Errorf("toyopuc: address quantity '%v' must be between '%v' and '%v',", quantity, 1, PC10MaxPoints)
+		return
+	}
+	dataQuantity := (numBit+7)/8 + numByte + numWord*2
+	if dataQuantity > PC10MaxData {
+		err = fmt.Errorf("toyopuc: data quantity '%v' must be between '%v' and '%v',", dataQuantity, 1, PC10MaxData)
+	}
+	return
+}
+
+// multipointQuantity 校验多点写入中 点数、程序号、地址、值 的数量是否一致
+func multipointQuantity(num byte, no []byte, quantityAddr, quantityVal int) (err error) {
+	if int(num) != len(no) || int(num) != quantityAddr || int(num) != quantityVal {
+		err = fmt.Errorf("toyopuc: the quantity of numbers, addresses and values must be equal to '%v', number quantity: '%v' ,address quantity: '%v' ,value quantity: '%v'", num, len(no), quantityAddr, quantityVal)
+	}
+	return
+}
+
 // send sends request and checks possible exception in the response.
-// 发送请求并检查响应中可能出现的异常
+// 发送请求并检查响应中可能出现的异常 失败时按重试策略重发
 func (toyopuc *client) send(request *ProtocolDataUnit) (response *ProtocolDataUnit, err error) {
+	for attempt := 1; ; attempt++ {
+		if response, err = toyopuc.sendOnce(request); err == nil || toyopuc.retry == nil {
+			return
+		}
+		wait, ok := toyopuc.retry.Retry(attempt, isWriteRequest(request), err)
+		if !ok {
+			return
+		}
+		if err = toyopuc.sleep(wait); err != nil {
+			return
+		}
+	}
+}
+
+// sendOnce 发送一次
+func (toyopuc *client) sendOnce(request *ProtocolDataUnit) (response *ProtocolDataUnit, err error) {
 	aduRequest, err := toyopuc.packager.Encode(request)
 	if err != nil {
 		return
 	}
-	aduResponse, err := toyopuc.transporter.Send(aduRequest)
+	aduResponse, err := toyopuc.sendADU(aduRequest)
 	if err != nil {
+		err = timeoutError(err)
 		return
 	}
 	// 校验
@@ -523,19 +695,33 @@ func (toyopuc *client) send(request *ProtocolDataUnit) (response *ProtocolDataUn
 	if err != nil {
 		return
 	}
-	// Check correct function code returned (exception)
-	if response.FunctionCode != request.FunctionCode {
-		err = fmt.Errorf("toyopuc: function code error")
-
-	}
 	// Check error code
 	if response.Response != 0x00 {
 		err = responseError(response)
 		return
 	}
+	// Check correct function code returned (exception)
+	if response.FunctionCode != request.FunctionCode {
+		err = fmt.Errorf("%w: response '%#x' for request '%#x'", ErrFunctionCodeMismatch, response.FunctionCode, request.FunctionCode)
+		return
+	}
 	return
 }
 
+// sendADU 有 ctx 时使用 SendContext
+func (toyopuc *client) sendADU(aduRequest []byte) (aduResponse []byte, err error) {
+	if toyopuc.ctx == nil {
+		return toyopuc.transporter.Send(aduRequest)
+	}
+	if t, ok := toyopuc.transporter.(ContextTransporter); ok {
+		return t.SendContext(toyopuc.ctx, aduRequest)
+	}
+	if err = toyopuc.ctx.Err(); err != nil {
+		return
+	}
+	return toyopuc.transporter.Send(aduRequest)
+}
+
 // dataBlock creates a sequence of uint16 data.
 // 数据块创建uint16数据序列 address + quantity ([]byte)
 // 顺序程序以及IO寄存器 读字用
@@ -680,11 +866,108 @@ func dataBlockExpansionSuffixMultipoint(numBit, numByte, numWord byte, bitNo []b
 	return data
 }
 
+// dataBlockExpansionSuffixMultipointValue 创建一个数据序列 no + address + value ([]byte)
+// 数据扩展 写多点
+//  位: no + address + value(1 byte)
+//  字节: no + address + value(1 byte)
+//  字: no + address + value(2 bytes CDAB)
+func dataBlockExpansionSuffixMultipointValue(numBit, numByte, numWord byte, bitNo []byte, bitAddr []uint16, bitValue []byte, bytesNo []byte, bytesAddr []uint16, bytesValue []byte, wordNo []byte, wordAddr []uint16, wordValue []uint16) []byte {
+	// 编码指令 CDAB
+	data := make([]byte, 3+4*len(bitNo)+4*len(bytesNo)+5*len(wordNo))
+	data[0] = numBit
+	data[1] = numByte
+	data[2] = numWord
+	i := 3
+	for k, v := range bitNo {
+		data[i] = v
+		binary.LittleEndian.PutUint16(data[i+1:], bitAddr[k])
+		data[i+3] = bitValue[k]
+		i += 4
+	}
+	for k, v := range bytesNo {
+		data[i] = v
+		binary.LittleEndian.PutUint16(data[i+1:], bytesAddr[k])
+		data[i+3] = bytesValue[k]
+		i += 4
+	}
+	for k, v := range wordNo {
+		data[i] = v
+		binary.LittleEndian.PutUint16(data[i+1:], wordAddr[k])
+		binary.LittleEndian.PutUint16(data[i+3:], wordValue[k])
+		i += 5
+	}
+	return data
+}
+
+// dataBlockExpansionPC10 创建数据序列 address (4 bytes) + quantity
+// PC10 块读出用
+func dataBlockExpansionPC10(address uint32, quantity uint16) []byte {
+	data := make([]byte, 6)
+	binary.LittleEndian.PutUint32(data[0:], address)
+	binary.LittleEndian.PutUint16(data[4:], quantity)
+	return data
+}
+
+// dataBlockExpansionSuffixPC10 创建数据序列 address (4 bytes) + value ([]byte)
+// PC10 块写入用
+func dataBlockExpansionSuffixPC10(suffix []byte, address uint32) []byte {
+	data := make([]byte, 4+len(suffix))
+	binary.LittleEndian.PutUint32(data[0:], address)
+	copy(data[4:], suffix)
+	return data
+}
+
+// dataBlockExpansionSuffixMultipointPC10 创建数据序列 点数 + address (4 bytes)...
+// PC10 读多点
+func dataBlockExpansionSuffixMultipointPC10(bitAddr, byteAddr, wordAddr []uint32) []byte {
+	data := make([]byte, 3, 3+4*(len(bitAddr)+len(byteAddr)+len(wordAddr)))
+	data[0] = byte(len(bitAddr))
+	data[1] = byte(len(byteAddr))
+	data[2] = byte(len(wordAddr))
+	var b [4]byte
+	for _, list := range [][]uint32{bitAddr, byteAddr, wordAddr} {
+		for _, v := range list {
+			binary.LittleEndian.PutUint32(b[:], v)
+			data = append(data, b[:]...)
+		}
+	}
+	return data
+}
+
+// dataBlockExpansionSuffixMultipointValuePC10 创建数据序列 点数 + address (4 bytes) + value...
+// PC10 写多点
+//  位: address + value(1 byte)
+//  字节: address + value(1 byte)
+//  字: address + value(2 bytes CDAB)
+func dataBlockExpansionSuffixMultipointValuePC10(bitAddr []uint32, bitValue []byte, byteAddr []uint32, byteValue []byte, wordAddr []uint32, wordValue []uint16) []byte {
+	data := make([]byte, 3+5*len(bitAddr)+5*len(byteAddr)+6*len(wordAddr))
+	data[0] = byte(len(bitAddr))
+	data[1] = byte(len(byteAddr))
+	data[2] = byte(len(wordAddr))
+	i := 3
+	for k, v := range bitAddr {
+		binary.LittleEndian.PutUint32(data[i:], v)
+		data[i+4] = bitValue[k]
+		i += 5
+	}
+	for k, v := range byteAddr {
+		binary.LittleEndian.PutUint32(data[i:], v)
+		data[i+4] = byteValue[k]
+		i += 5
+	}
+	for k, v := range wordAddr {
+		binary.LittleEndian.PutUint32(data[i:], v)
+		binary.LittleEndian.PutUint16(data[i+4:], wordValue[k])
+		i += 6
+	}
+	return data
+}
+
 // 错误
 func responseError(response *ProtocolDataUnit) error {
-	toyopucError := &toyopucError{FunctionCode: response.FunctionCode}
+	exceptionError := &ExceptionError{FunctionCode: response.FunctionCode}
 	if response.Response != 0 {
-		toyopucError.ExceptionCode = response.Response
+		exceptionError.ExceptionCode = response.Response
 	}
-	return toyopucError
+	return exceptionError
 }
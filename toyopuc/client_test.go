@@ -0,0 +1,97 @@
+package toyopuc
+
+import (
+	"bytes"
+	"testing"
+)
+
+// recordTransporter 记录请求帧 响应只有指令代码
+type recordTransporter struct {
+	requests [][]byte
+}
+
+func (r *recordTransporter) Send(aduRequest []byte) (aduResponse []byte, err error) {
+	r.requests = append(r.requests, append([]byte(nil), aduRequest...))
+	return []byte{ResponseFTByte, 0x00, 0x01, 0x00, aduRequest[tcpHeaderSize]}, nil
+}
+
+func newRecordClient() (*recordTransporter, Client) {
+	transporter := &recordTransporter{}
+	return transporter, NewClient2(&tcpPackager{RequestFT: RequestFTByte, ResponseFTByte: ResponseFTByte}, transporter)
+}
+
+func TestWriteDataExpansionMultipoint(t *testing.T) {
+	transporter, client := newRecordClient()
+	err := client.WriteDataExpansionMultipoint(1, 1, 1,
+		[]byte{0x01}, []uint16{0x0123}, []byte{0x01},
+		[]byte{0x02}, []uint16{0x0456}, []byte{0xAB},
+		[]byte{0x03}, []uint16{0x0789}, []uint16{0x1234})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{
+		RequestFTByte, 0x00, 0x11, 0x00, FunDataExpansionWriteMultipoint,
+		0x01, 0x01, 0x01,
+		0x01, 0x23, 0x01, 0x01, // 位: No + 地址 + 值
+		0x02, 0x56, 0x04, 0xAB, // 字节
+		0x03, 0x89, 0x07, 0x34, 0x12, // 字 CDAB
+	}
+	if len(transporter.requests) != 1 || !bytes.Equal(transporter.requests[0], want) {
+		t.Errorf("request = % x, want % x", transporter.requests, want)
+	}
+}
+
+// multipoint 生成 n 个点的 No、地址和值
+func multipoint(n int) (no []byte, addr []uint16, value []byte, words []uint16) {
+	no = make([]byte, n)
+	addr = make([]uint16, n)
+	value = make([]byte, n)
+	words = make([]uint16, n)
+	for k := range no {
+		no[k] = 0x01
+		addr[k] = uint16(k)
+	}
+	return
+}
+
+func TestDataExpansionMultipointLimit(t *testing.T) {
+	tests := []struct {
+		name                     string
+		numBit, numByte, numWord int
+		ok                       bool
+	}{
+		{name: "max addresses", numBit: 176, ok: true},
+		{name: "too many addresses", numBit: 170, numByte: 7},
+		{name: "quantity overflows byte", numBit: 200, numByte: 60},
+		{name: "max data", numWord: 64, ok: true},
+		{name: "too much data", numWord: 65},
+		// 不足 8 位也占一个字节
+		{name: "max data with bits", numBit: 8, numByte: 127, ok: true},
+		{name: "partial bit byte over limit", numBit: 9, numByte: 127},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bitNo, bitAddr, bitValue, _ := multipoint(tt.numBit)
+			byteNo, byteAddr, byteValue, _ := multipoint(tt.numByte)
+			wordNo, wordAddr, _, wordValue := multipoint(tt.numWord)
+
+			transporter, client := newRecordClient()
+			_, err := client.ReadDataExpansionMultipoint(byte(tt.numBit), byte(tt.numByte), byte(tt.numWord), bitNo, bitAddr, byteNo, byteAddr, wordNo, wordAddr)
+			if (err == nil) != tt.ok {
+				t.Errorf("ReadDataExpansionMultipoint error = %v, want ok %v", err, tt.ok)
+			}
+			err = client.WriteDataExpansionMultipoint(byte(tt.numBit), byte(tt.numByte), byte(tt.numWord), bitNo, bitAddr, bitValue, byteNo, byteAddr, byteValue, wordNo, wordAddr, wordValue)
+			if (err == nil) != tt.ok {
+				t.Errorf("WriteDataExpansionMultipoint error = %v, want ok %v", err, tt.ok)
+			}
+			// 超出限制的请求不发送
+			want := 0
+			if tt.ok {
+				want = 2
+			}
+			if len(transporter.requests) != want {
+				t.Errorf("sent %v requests, want %v", len(transporter.requests), want)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package toyopuc
+
+import (
+	"fmt"
+	"time"
+)
+
+// 时钟数据的字节数
+const clockSize = 7
+
+// DecodeClock 时钟数据 转 time.Time
+// 秒 分 时 日 月 年 (00 - 99 为 2000 - 2099) 星期 (0 为星期日)，均为 BCD 码
+// PLC 的时钟没有时区，使用 loc
+func DecodeClock(data []byte, loc *time.Location) (t time.Time, err error) {
+	if len(data) != clockSize {
+		err = fmt.Errorf("%w: clock size '%v' does not match expected '%v'", ErrLength, len(data), clockSize)
+		return
+	}
+	var v [clockSize]int
+	for k, b := range data {
+		var n uint16
+		if n, err = bcdToUint16(uint16(b)); err != nil {
+			return
+		}
+		v[k] = int(n)
+	}
+	sec, min, hour, day, month, year := v[0], v[1], v[2], v[3], v[4], v[5]
+	if sec > 59 || min > 59 || hour > 23 || day < 1 || day > 31 || month < 1 || month > 12 {
+		err = fmt.Errorf("toyopuc: clock '% X' is not a valid time", data)
+		return
+	}
+	t = time.Date(2000+year, time.Month(month), day, hour, min, sec, 0, loc)
+	// 不存在的日期 (如 02-31) 被 time.Date 顺延到下个月
+	if t.Day() != day || t.Month() != time.Month(month) {
+		err = fmt.Errorf("toyopuc: clock '% X' is not a valid date", data)
+		t = time.Time{}
+	}
+	return
+}
+
+// EncodeClock time.Time 转 时钟数据 不足1秒的部分舍去
+func EncodeClock(t time.Time) (data []byte, err error) {
+	if t.Year() < 2000 || t.Year() > 2099 {
+		err = fmt.Errorf("toyopuc: clock year '%v' must be between '%v' and '%v'", t.Year(), 2000, 2099)
+		return
+	}
+	data = make([]byte, clockSize)
+	for k, n := range []int{t.Second(), t.Minute(), t.Hour(), t.Day(), int(t.Month()), t.Year() - 2000, int(t.Weekday())} {
+		v, _ := uint16ToBCD(uint16(n))
+		data[k] = byte(v)
+	}
+	return
+}
+
+// WithLocation returns a shallow copy of the client which reads and writes the PLC clock in loc.
+func (toyopuc *client) WithLocation(loc *time.Location) Client {
+	c := *toyopuc
+	c.location = loc
+	return &c
+}
+
+// clockLocation PLC 时钟的时区
+func (toyopuc *client) clockLocation() *time.Location {
+	if toyopuc.location == nil {
+		return time.Local
+	}
+	return toyopuc.location
+}
+
+// ReadClock
+// 时钟读出 PLC 的时钟视为 WithLocation 的时区 (默认本地时间)
+//  Function code         : 1 byte (0x32)
+//  Sub command           : 2 bytes (0x70 0x00)
+func (toyopuc *client) ReadClock() (t time.Time, err error) {
+	data, err := toyopuc.command(SubCommandReadClock, nil)
+	if err != nil {
+		return
+	}
+	return DecodeClock(data, toyopuc.clockLocation())
+}
+
+// WriteClock
+// 时钟写入 按 t 在 WithLocation 的时区 (默认本地时间) 的时刻写入，不足1秒的部分舍去
+//  Function code         : 1 byte (0x32)
+//  Sub command           : 2 bytes (0x71 0x00)
+//  Data                  : 7 bytes 秒 分 时 日 月 年 星期 (BCD)
+func (toyopuc *client) WriteClock(t time.Time) (err error) {
+	data, err := EncodeClock(t.In(toyopuc.clockLocation()))
+	if err != nil {
+		return
+	}
+	_, err = toyopuc.command(SubCommandWriteClock, data)
+	return
+}
+
+// SyncClock 将 PLC 的时钟设为本机时间 返回同步前的偏差 (PLC - 本机)
+// 偏差按请求的中间时刻计算，精度受时钟1秒的分辨率限制
+// 写入前等待到本机时间的整秒，使写入的时间没有舍去的部分
+func (toyopuc *client) SyncClock() (drift time.Duration, err error) {
+	start := time.Now()
+	plc, err := toyopuc.ReadClock()
+	if err != nil {
+		return
+	}
+	host := start.Add(time.Since(start) / 2)
+	drift = plc.Sub(host.Truncate(time.Second))
+
+	now := time.Now()
+	if err = toyopuc.sleep(now.Truncate(time.Second).Add(time.Second).Sub(now)); err != nil {
+		return
+	}
+	err = toyopuc.WriteClock(time.Now().Add(time.Millisecond).Truncate(time.Second))
+	return
+}
@@ -0,0 +1,86 @@
+package toyopuc
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestEncodeClock(t *testing.T) {
+	tests := []struct {
+		time time.Time
+		want []byte
+		ok   bool
+	}{
+		// 2024-02-29 星期四
+		{time: time.Date(2024, 2, 29, 23, 59, 58, 900, time.UTC), want: []byte{0x58, 0x59, 0x23, 0x29, 0x02, 0x24, 0x04}, ok: true},
+		{time: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), want: []byte{0x00, 0x00, 0x00, 0x01, 0x01, 0x00, 0x06}, ok: true},
+		{time: time.Date(2099, 12, 31, 12, 34, 56, 0, time.UTC), want: []byte{0x56, 0x34, 0x12, 0x31, 0x12, 0x99, 0x04}, ok: true},
+		{time: time.Date(1999, 12, 31, 23, 59, 59, 0, time.UTC)},
+		{time: time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := EncodeClock(tt.time)
+		if !tt.ok {
+			if err == nil {
+				t.Errorf("EncodeClock(%v) succeeded", tt.time)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("EncodeClock(%v) error = %v", tt.time, err)
+			continue
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("EncodeClock(%v) = % x, want % x", tt.time, got, tt.want)
+		}
+		// 不足1秒的部分舍去
+		back, err := DecodeClock(got, time.UTC)
+		if err != nil {
+			t.Errorf("DecodeClock(% x) error = %v", got, err)
+			continue
+		}
+		if want := tt.time.Truncate(time.Second); !back.Equal(want) {
+			t.Errorf("DecodeClock(% x) = %v, want %v", got, back, want)
+		}
+	}
+}
+
+func TestDecodeClock(t *testing.T) {
+	loc := time.FixedZone("JST", 9*60*60)
+	tests := []struct {
+		name string
+		data []byte
+		want time.Time
+		ok   bool
+	}{
+		{name: "valid", data: []byte{0x05, 0x04, 0x03, 0x02, 0x01, 0x25, 0x04}, want: time.Date(2025, 1, 2, 3, 4, 5, 0, loc), ok: true},
+		{name: "leap day", data: []byte{0x00, 0x00, 0x00, 0x29, 0x02, 0x24, 0x04}, want: time.Date(2024, 2, 29, 0, 0, 0, 0, loc), ok: true},
+		{name: "february 29 not leap", data: []byte{0x00, 0x00, 0x00, 0x29, 0x02, 0x23, 0x03}},
+		{name: "february 31", data: []byte{0x00, 0x00, 0x00, 0x31, 0x02, 0x24, 0x06}},
+		{name: "april 31", data: []byte{0x00, 0x00, 0x00, 0x31, 0x04, 0x24, 0x03}},
+		{name: "invalid bcd", data: []byte{0x0A, 0x00, 0x00, 0x01, 0x01, 0x24, 0x01}},
+		{name: "second 60", data: []byte{0x60, 0x00, 0x00, 0x01, 0x01, 0x24, 0x01}},
+		{name: "hour 24", data: []byte{0x00, 0x00, 0x24, 0x01, 0x01, 0x24, 0x01}},
+		{name: "day 0", data: []byte{0x00, 0x00, 0x00, 0x00, 0x01, 0x24, 0x01}},
+		{name: "month 13", data: []byte{0x00, 0x00, 0x00, 0x01, 0x13, 0x24, 0x01}},
+		{name: "short", data: []byte{0x00, 0x00, 0x00, 0x01, 0x01, 0x24}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeClock(tt.data, loc)
+			if !tt.ok {
+				if err == nil {
+					t.Errorf("DecodeClock(% x) = %v, want error", tt.data, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(tt.want) || got.Location() != loc {
+				t.Errorf("DecodeClock(% x) = %v, want %v", tt.data, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package toyopuc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// WordOrder 32位数据在两个连续字中的字序
+type WordOrder byte
+
+const (
+	// CDAB 低位字在前 (TOYOPUC 默认)
+	CDAB WordOrder = iota
+	// ABCD 高位字在前
+	ABCD
+)
+
+// String 字序名称
+func (o WordOrder) String() string {
+	switch o {
+	case CDAB:
+		return "cdab"
+	case ABCD:
+		return "abcd"
+	}
+	return "unknown"
+}
+
+// ParseWordOrder 解析字序名称 cdab abcd
+func ParseWordOrder(s string) (order WordOrder, err error) {
+	switch s {
+	case "cdab", "CDAB":
+		order = CDAB
+	case "abcd", "ABCD":
+		order = ABCD
+	default:
+		err = fmt.Errorf("toyopuc: unknown word order '%v'", s)
+	}
+	return
+}
+
+// DataType 值的数据类型 结构体标签与命令行共用
+type DataType string
+
+const (
+	// 位
+	TypeBool DataType = "bool"
+	// 字节
+	TypeUint8 DataType = "uint8"
+	// 一个字
+	TypeUint16 DataType = "uint16"
+	TypeInt16  DataType = "int16"
+	// 两个字 按字序
+	TypeUint32  DataType = "uint32"
+	TypeInt32   DataType = "int32"
+	TypeFloat32 DataType = "float32"
+	// 4位BCD码
+	TypeBCD DataType = "bcd"
+	// ASCII字符串 每字两个字符
+	TypeString DataType = "string"
+)
+
+// ParseDataType 解析数据类型名称
+func ParseDataType(s string) (typ DataType, err error) {
+	switch typ = DataType(s); typ {
+	case TypeBool, TypeUint8, TypeUint16, TypeInt16, TypeUint32, TypeInt32, TypeFloat32, TypeBCD, TypeString:
+	default:
+		typ, err = "", fmt.Errorf("toyopuc: unknown type '%v'", s)
+	}
+	return
+}
+
+// 解码
+// 输入为字读出的结果 每字两个字节 CDAB
+
+// DecodeUint16s []byte 转 []uint16
+func DecodeUint16s(data []byte) []uint16 {
+	words := make([]uint16, len(data)/2)
+	for k := range words {
+		words[k] = binary.LittleEndian.Uint16(data[k*2:])
+	}
+	return words
+}
+
+// DecodeInt16s []byte 转 []int16
+func DecodeInt16s(data []byte) []int16 {
+	words := DecodeUint16s(data)
+	values := make([]int16, len(words))
+	for k, v := range words {
+		values[k] = int16(v)
+	}
+	return values
+}
+
+// DecodeUint32s []byte 转 []uint32，每个值占两个连续的字
+// 字数为奇数时返回 ErrLength
+func DecodeUint32s(data []byte, order WordOrder) (values []uint32, err error) {
+	words := DecodeUint16s(data)
+	if len(words)%2 != 0 {
+		err = fmt.Errorf("%w: '%v' words cannot be decoded as 32-bit values", ErrLength, len(words))
+		return
+	}
+	values = make([]uint32, len(words)/2)
+	for k := range values {
+		lo, hi := words[k*2], words[k*2+1]
+		if order == ABCD {
+			lo, hi = hi, lo
+		}
+		values[k] = uint32(hi)<<16 | uint32(lo)
+	}
+	return
+}
+
+// DecodeInt32s []byte 转 []int32，每个值占两个连续的字
+// 字数为奇数时返回 ErrLength
+func DecodeInt32s(data []byte, order WordOrder) (values []int32, err error) {
+	raw, err := DecodeUint32s(data, order)
+	if err != nil {
+		return
+	}
+	values = make([]int32, len(raw))
+	for k, v := range raw {
+		values[k] = int32(v)
+	}
+	return
+}
+
+// DecodeFloat32s []byte 转 []float32，每个值占两个连续的字
+// 字数为奇数时返回 ErrLength
+func DecodeFloat32s(data []byte, order WordOrder) (values []float32, err error) {
+	raw, err := DecodeUint32s(data, order)
+	if err != nil {
+		return
+	}
+	values = make([]float32, len(raw))
+	for k, v := range raw {
+		values[k] = math.Float32frombits(v)
+	}
+	return
+}
+
+// DecodeBCDs []byte 转 []uint16，每个字为4位BCD码 (0 - 9999)
+func DecodeBCDs(data []byte) (values []uint16, err error) {
+	words := DecodeUint16s(data)
+	values = make([]uint16, len(words))
+	for k, v := range words {
+		if values[k], err = bcdToUint16(v); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// DecodeString []byte 转 ASCII字符串
+// 每字低位字节在前，遇到 0x00 结束
+func DecodeString(data []byte) (s string, err error) {
+	end := len(data)
+	for k, v := range data {
+		if v == 0 {
+			end = k
+			break
+		}
+		if v > 0x7F {
+			err = fmt.Errorf("toyopuc: byte '%#x' at '%v' is not ASCII", v, k)
+			return
+		}
+	}
+	s = string(data[:end])
+	return
+}
+
+// 编码
+// 输出为字写入方法使用的 []uint16
+
+// WordBytes []uint16 转 []byte CDAB，用于 Write
+func WordBytes(value []uint16) []byte {
+	data := make([]byte, 2*len(value))
+	for k, v := range value {
+		binary.LittleEndian.PutUint16(data[k*2:], v)
+	}
+	return data
+}
+
+// EncodeInt16s []int16 转 []uint16
+func EncodeInt16s(value []int16) []uint16 {
+	words := make([]uint16, len(value))
+	for k, v := range value {
+		words[k] = uint16(v)
+	}
+	return words
+}
+
+// EncodeUint32s []uint32 转 []uint16，每个值占两个连续的字
+func EncodeUint32s(value []uint32, order WordOrder) []uint16 {
+	words := make([]uint16, 2*len(value))
+	for k, v := range value {
+		lo, hi := uint16(v), uint16(v>>16)
+		if order == ABCD {
+			lo, hi = hi, lo
+		}
+		words[k*2] = lo
+		words[k*2+1] = hi
+	}
+	return words
+}
+
+// EncodeInt32s []int32 转 []uint16，每个值占两个连续的字
+func EncodeInt32s(value []int32, order WordOrder) []uint16 {
+	raw := make([]uint32, len(value))
+	for k, v := range value {
+		raw[k] = uint32(v)
+	}
+	return EncodeUint32s(raw, order)
+}
+
+// EncodeFloat32s []float32 转 []uint16，每个值占两个连续的字
+func EncodeFloat32s(value []float32, order WordOrder) []uint16 {
+	raw := make([]uint32, len(value))
+	for k, v := range value {
+		raw[k] = math.Float32bits(v)
+	}
+	return EncodeUint32s(raw, order)
+}
+
+// EncodeBCDs []uint16 (0 - 9999) 转 4位BCD码
+func EncodeBCDs(value []uint16) (words []uint16, err error) {
+	words = make([]uint16, len(value))
+	for k, v := range value {
+		if words[k], err = uint16ToBCD(v); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// EncodeString ASCII字符串 转 []uint16
+// 每字低位字节在前，不足 words 个字时以 0x00 填充
+func EncodeString(s string, words int) (value []uint16, err error) {
+	if len(s) > words*2 {
+		err = fmt.Errorf("toyopuc: string length '%v' must not greater than '%v'", len(s), words*2)
+		return
+	}
+	data := make([]byte, words*2)
+	for k := 0; k < len(s); k++ {
+		if s[k] > 0x7F {
+			err = fmt.Errorf("toyopuc: byte '%#x' at '%v' is not ASCII", s[k], k)
+			return
+		}
+		data[k] = s[k]
+	}
+	value = DecodeUint16s(data)
+	return
+}
+
+// bcdToUint16 4位BCD码 转 数值
+func bcdToUint16(v uint16) (n uint16, err error) {
+	for shift := 12; shift >= 0; shift -= 4 {
+		digit := v >> uint(shift) & 0x0F
+		if digit > 9 {
+			err = fmt.Errorf("toyopuc: '%#04x' is not a valid BCD value", v)
+			return
+		}
+		n = n*10 + digit
+	}
+	return
+}
+
+// uint16ToBCD 数值 转 4位BCD码
+func uint16ToBCD(n uint16) (v uint16, err error) {
+	if n > 9999 {
+		err = fmt.Errorf("toyopuc: '%v' must be between '%v' and '%v' for BCD", n, 0, 9999)
+		return
+	}
+	for shift := 0; shift < 16; shift += 4 {
+		v |= n % 10 << uint(shift)
+		n /= 10
+	}
+	return
+}
@@ -0,0 +1,196 @@
+package toyopuc
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"testing"
+)
+
+func equalWords(a, b []uint16) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k := range a {
+		if a[k] != b[k] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBCD(t *testing.T) {
+	tests := []struct {
+		value uint16
+		word  uint16
+	}{
+		{value: 0, word: 0x0000},
+		{value: 9, word: 0x0009},
+		{value: 10, word: 0x0010},
+		{value: 1234, word: 0x1234},
+		{value: 9999, word: 0x9999},
+	}
+	for _, tt := range tests {
+		words, err := EncodeBCDs([]uint16{tt.value})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if words[0] != tt.word {
+			t.Errorf("EncodeBCDs(%v) = %04x, want %04x", tt.value, words[0], tt.word)
+		}
+		values, err := DecodeBCDs(WordBytes(words))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if values[0] != tt.value {
+			t.Errorf("DecodeBCDs(%04x) = %v, want %v", tt.word, values[0], tt.value)
+		}
+	}
+	if _, err := EncodeBCDs([]uint16{1, 10000}); err == nil {
+		t.Error("EncodeBCDs(10000) succeeded")
+	}
+	// 每一位的无效值
+	for _, word := range []uint16{0x000A, 0x00B0, 0x0C00, 0xD000, 0xFFFF} {
+		if _, err := DecodeBCDs(WordBytes([]uint16{0x1234, word})); err == nil {
+			t.Errorf("DecodeBCDs(%04x) succeeded", word)
+		}
+	}
+}
+
+func TestWordOrder(t *testing.T) {
+	tests := []struct {
+		order WordOrder
+		// 0x12345678 -2 1.5
+		words []uint16
+	}{
+		{order: CDAB, words: []uint16{0x5678, 0x1234, 0xFFFE, 0xFFFF, 0x0000, 0x3FC0}},
+		{order: ABCD, words: []uint16{0x1234, 0x5678, 0xFFFF, 0xFFFE, 0x3FC0, 0x0000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.order.String(), func(t *testing.T) {
+			if got := EncodeUint32s([]uint32{0x12345678}, tt.order); !equalWords(got, tt.words[0:2]) {
+				t.Errorf("EncodeUint32s = %04x, want %04x", got, tt.words[0:2])
+			}
+			if got := EncodeInt32s([]int32{-2}, tt.order); !equalWords(got, tt.words[2:4]) {
+				t.Errorf("EncodeInt32s = %04x, want %04x", got, tt.words[2:4])
+			}
+			if got := EncodeFloat32s([]float32{1.5}, tt.order); !equalWords(got, tt.words[4:6]) {
+				t.Errorf("EncodeFloat32s = %04x, want %04x", got, tt.words[4:6])
+			}
+			data := WordBytes(tt.words)
+			if got, err := DecodeUint32s(data[0:4], tt.order); err != nil || len(got) != 1 || got[0] != 0x12345678 {
+				t.Errorf("DecodeUint32s = %x, %v, want %x", got, err, 0x12345678)
+			}
+			if got, err := DecodeInt32s(data[4:8], tt.order); err != nil || len(got) != 1 || got[0] != -2 {
+				t.Errorf("DecodeInt32s = %v, %v, want %v", got, err, -2)
+			}
+			if got, err := DecodeFloat32s(data[8:12], tt.order); err != nil || len(got) != 1 || got[0] != 1.5 {
+				t.Errorf("DecodeFloat32s = %v, %v, want %v", got, err, 1.5)
+			}
+			order, err := ParseWordOrder(tt.order.String())
+			if err != nil || order != tt.order {
+				t.Errorf("ParseWordOrder(%v) = %v, %v", tt.order, order, err)
+			}
+		})
+	}
+	if _, err := ParseWordOrder("badc"); err == nil {
+		t.Error("ParseWordOrder(badc) succeeded")
+	}
+}
+
+func TestFloat32RoundTrip(t *testing.T) {
+	values := []float32{0, -0.25, math.MaxFloat32, math.SmallestNonzeroFloat32, float32(math.Inf(-1))}
+	for _, order := range []WordOrder{CDAB, ABCD} {
+		got, err := DecodeFloat32s(WordBytes(EncodeFloat32s(values, order)), order)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k := range values {
+			if got[k] != values[k] {
+				t.Errorf("%v: value %v = %v, want %v", order, k, got[k], values[k])
+			}
+		}
+	}
+}
+
+func TestDecode32OddWords(t *testing.T) {
+	// 不完整的值不能忽略
+	data := make([]byte, 6)
+	if _, err := DecodeUint32s(data, CDAB); !errors.Is(err, ErrLength) {
+		t.Errorf("DecodeUint32s of 3 words error = %v, want %v", err, ErrLength)
+	}
+	if _, err := DecodeInt32s(data, CDAB); !errors.Is(err, ErrLength) {
+		t.Errorf("DecodeInt32s of 3 words error = %v, want %v", err, ErrLength)
+	}
+	if _, err := DecodeFloat32s(data, CDAB); !errors.Is(err, ErrLength) {
+		t.Errorf("DecodeFloat32s of 3 words error = %v, want %v", err, ErrLength)
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		s     string
+		words int
+		want  []uint16
+	}{
+		{s: "AB", words: 1, want: []uint16{0x4241}},
+		{s: "ABC", words: 2, want: []uint16{0x4241, 0x0043}},
+		{s: "A", words: 3, want: []uint16{0x0041, 0x0000, 0x0000}},
+		{s: "", words: 1, want: []uint16{0x0000}},
+	}
+	for _, tt := range tests {
+		got, err := EncodeString(tt.s, tt.words)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equalWords(got, tt.want) {
+			t.Errorf("EncodeString(%q, %v) = %04x, want %04x", tt.s, tt.words, got, tt.want)
+		}
+		s, err := DecodeString(WordBytes(got))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != tt.s {
+			t.Errorf("DecodeString(%04x) = %q, want %q", got, s, tt.s)
+		}
+	}
+	if _, err := EncodeString("ABC", 1); err == nil {
+		t.Error("EncodeString of 3 bytes into 1 word succeeded")
+	}
+	if _, err := EncodeString("A\xe9", 1); err == nil {
+		t.Error("EncodeString of non-ASCII succeeded")
+	}
+	if _, err := DecodeString([]byte{0x41, 0x80}); err == nil {
+		t.Error("DecodeString of non-ASCII succeeded")
+	}
+	// 0x00 之后的数据忽略
+	if s, err := DecodeString([]byte{0x41, 0x00, 0x80, 0x42}); err != nil || s != "A" {
+		t.Errorf("DecodeString = %q, %v, want %q", s, err, "A")
+	}
+}
+
+func TestWordBytes(t *testing.T) {
+	data := WordBytes([]uint16{0x1234, 0xABCD})
+	if !bytes.Equal(data, []byte{0x34, 0x12, 0xCD, 0xAB}) {
+		t.Errorf("WordBytes = % x", data)
+	}
+	if got := DecodeInt16s(data[2:]); len(got) != 1 || got[0] != -0x5433 {
+		t.Errorf("DecodeInt16s = %v, want %v", got, -0x5433)
+	}
+	if got := EncodeInt16s([]int16{-1, 1}); !equalWords(got, []uint16{0xFFFF, 0x0001}) {
+		t.Errorf("EncodeInt16s = %04x", got)
+	}
+}
+
+func TestParseDataType(t *testing.T) {
+	for _, s := range []string{"bool", "uint8", "uint16", "int16", "uint32", "int32", "float32", "bcd", "string"} {
+		if typ, err := ParseDataType(s); err != nil || string(typ) != s {
+			t.Errorf("ParseDataType(%v) = %v, %v", s, typ, err)
+		}
+	}
+	for _, s := range []string{"", "hex", "UINT16", "int64"} {
+		if typ, err := ParseDataType(s); err == nil {
+			t.Errorf("ParseDataType(%q) = %v, want error", s, typ)
+		}
+	}
+}
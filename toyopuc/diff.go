@@ -0,0 +1,232 @@
+package toyopuc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Change 两个快照之间变化的一个字
+type Change struct {
+	// 设备地址 如 D0100 M001W P2-D0200 不属于任何设备时为 区域名:字地址
+	Address string
+	// 快照区域名
+	Area   string
+	Family Family
+	No     byte
+	Word   uint16
+	Old    uint16
+	New    uint16
+	// 变化的位 如 M0013 D0100.3 不包含忽略的位
+	Bits []string
+}
+
+// SnapshotDiff 快照比较结果
+type SnapshotDiff struct {
+	// 按区域与字地址排列
+	Changes []Change
+	// 只在其中一个快照中的区域
+	Missing []string
+	// 两个快照中字地址范围不同的区域 只比较了重叠的部分
+	Resized []AreaResize
+}
+
+// AreaResize 两个快照中字地址范围不同的区域
+type AreaResize struct {
+	Area string
+	// 字地址范围 [Start, Start+Words)
+	OldStart, NewStart uint16
+	OldWords, NewWords int
+}
+
+// String 区域名与两个字地址范围
+func (r AreaResize) String() string {
+	return fmt.Sprintf("%v %04X+%v words, %04X+%v words", r.Area, r.OldStart, r.OldWords, r.NewStart, r.NewWords)
+}
+
+// DiffOptions 比较选项
+type DiffOptions struct {
+	// 忽略的设备或地址
+	//  T C N          整个设备 无程序号前缀时包含 P1- P2- P3-
+	//  P2-N           程序2 的设备
+	//  D0100..D01FF   地址范围 按字忽略
+	//  D0100 M0013    单个字、字节或位
+	// 地址与地址范围同样 无程序号前缀时包含 P1- P2- P3-
+	Ignore []string
+	// 只比较这些区域 为空时比较全部区域 可以包含 FR 块 FR00 - FR3F
+	Areas []string
+}
+
+// ignoreRule 忽略规则
+type ignoreRule struct {
+	// 整个设备
+	device  *device
+	program byte
+	// 地址范围
+	family     Family
+	no         byte
+	start, end uint16
+	mask       uint16
+	// 无程序号前缀的基本设备 同时匹配 P1- P2- P3-
+	programs bool
+}
+
+// parseIgnore 解析忽略的设备或地址
+func parseIgnore(s string) (rule *ignoreRule, err error) {
+	text := strings.ToUpper(strings.TrimSpace(s))
+	name := text
+	var program byte
+	if len(name) > 3 && name[0] == 'P' && name[2] == '-' && name[1] >= '1' && name[1] <= '3' {
+		program = name[1] - '0'
+		name = name[3:]
+	}
+	if d := lookupDevice(name); d != nil {
+		if d.ext && program != 0 {
+			return nil, fmt.Errorf("toyopuc: ignore '%v' device '%v' cannot be used with a program number", s, d.name)
+		}
+		return &ignoreRule{device: d, program: program}, nil
+	}
+	parts := strings.SplitN(text, "..", 2)
+	a, err := ParseAddress(parts[0])
+	if err != nil {
+		return
+	}
+	rule = &ignoreRule{family: a.Family, no: a.No, start: a.Word, end: a.Word, mask: 0xFFFF, programs: a.Program == 0}
+	if len(parts) == 2 {
+		var b *Address
+		if b, err = ParseAddress(parts[1]); err != nil {
+			return
+		}
+		if b.Family != a.Family || b.No != a.No || b.Word < a.Word {
+			return nil, fmt.Errorf("toyopuc: ignore '%v' is not a range in one area", s)
+		}
+		rule.end = b.Word
+		return
+	}
+	switch {
+	case a.Unit == UnitBit:
+		rule.mask = 1 << a.Bit
+	case a.Unit == UnitByte && a.High:
+		rule.mask = 0xFF00
+	case a.Unit == UnitByte:
+		rule.mask = 0x00FF
+	}
+	return
+}
+
+// ignored 忽略的位
+func (r *ignoreRule) ignored(family Family, no byte, word uint16) uint16 {
+	if r.device != nil {
+		if !r.device.contains(family, no, word) {
+			return 0
+		}
+		if r.program != 0 && no != r.program {
+			return 0
+		}
+		return 0xFFFF
+	}
+	if r.programs && no >= 1 && no <= 3 {
+		// 程序1 - 3 的基本设备与程序
+		switch {
+		case r.family == FamilyIO && family == FamilyDataExpansion:
+			family, no = FamilyIO, 0
+		case r.family == FamilySequentialProgram && family == FamilyProgramExpansion:
+			family, no = FamilySequentialProgram, 0
+		}
+	}
+	if family != r.family || no != r.no || word < r.start || word > r.end {
+		return 0
+	}
+	return r.mask
+}
+
+// DiffSnapshots 比较两个快照 返回变化的字与位
+// 快照可以来自 ReadSnapshot 或 Backup (在线读出)
+func DiffSnapshots(before, after *Snapshot, options *DiffOptions) (diff *SnapshotDiff, err error) {
+	if options == nil {
+		options = &DiffOptions{}
+	}
+	match, err := areaFilter(options.Areas, true)
+	if err != nil {
+		return
+	}
+	rules := make([]*ignoreRule, 0, len(options.Ignore))
+	for _, s := range options.Ignore {
+		var r *ignoreRule
+		if r, err = parseIgnore(s); err != nil {
+			return
+		}
+		rules = append(rules, r)
+	}
+	diff = &SnapshotDiff{}
+	for _, a := range before.Areas {
+		if !match(a.Name) {
+			continue
+		}
+		b := findArea(after, a.Family, a.No)
+		if b == nil {
+			diff.Missing = append(diff.Missing, a.Name)
+			continue
+		}
+		if a.Start != b.Start || len(a.Words) != len(b.Words) {
+			diff.Resized = append(diff.Resized, AreaResize{Area: a.Name, OldStart: a.Start, NewStart: b.Start, OldWords: len(a.Words), NewWords: len(b.Words)})
+		}
+		// 比较两个区域重叠的字地址
+		start, end := maxInt(int(a.Start), int(b.Start)), minInt(int(a.Start)+len(a.Words), int(b.Start)+len(b.Words))
+		for w := start; w < end; w++ {
+			word := uint16(w)
+			x, y := a.Words[w-int(a.Start)], b.Words[w-int(b.Start)]
+			if x == y {
+				continue
+			}
+			var mask uint16
+			for _, r := range rules {
+				mask |= r.ignored(a.Family, a.No, word)
+			}
+			changed := (x ^ y) &^ mask
+			if changed == 0 {
+				continue
+			}
+			diff.Changes = append(diff.Changes, newChange(a, word, x, y, changed))
+		}
+	}
+	for _, b := range after.Areas {
+		if match(b.Name) && findArea(before, b.Family, b.No) == nil {
+			diff.Missing = append(diff.Missing, b.Name)
+		}
+	}
+	return
+}
+
+// newChange 变化的字 changed 为变化且未忽略的位
+func newChange(area *SnapshotArea, word, x, y, changed uint16) Change {
+	c := Change{Area: area.Name, Family: area.Family, No: area.No, Word: word, Old: x, New: y}
+	addr := addressOf(area.Family, area.No, word)
+	if addr == nil {
+		c.Address = fmt.Sprintf("%v:%04X", area.Name, word)
+	} else {
+		c.Address = addr.String()
+	}
+	for bit := byte(0); bit < 16; bit++ {
+		if changed&(1<<bit) == 0 {
+			continue
+		}
+		if addr == nil {
+			c.Bits = append(c.Bits, fmt.Sprintf("%v.%X", c.Address, bit))
+			continue
+		}
+		b := *addr
+		b.Unit, b.Bit = UnitBit, bit
+		c.Bits = append(c.Bits, b.String())
+	}
+	return c
+}
+
+// findArea 按指令族与区域号查找
+func findArea(s *Snapshot, family Family, no byte) *SnapshotArea {
+	for _, a := range s.Areas {
+		if a.Family == family && a.No == no {
+			return a
+		}
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package toyopuc
+
+import (
+	"strings"
+	"testing"
+)
+
+// diffSnapshots 内容相同的两个快照 区域 IO P1 P2
+func diffSnapshots() (before, after *Snapshot) {
+	before, after = &Snapshot{}, &Snapshot{}
+	for _, s := range []*Snapshot{before, after} {
+		s.Areas = []*SnapshotArea{
+			{Name: "IO", Family: FamilyIO, Words: make([]uint16, 0x8000)},
+			{Name: "P1", Family: FamilyDataExpansion, No: 1, Words: make([]uint16, 0x8000)},
+			{Name: "P2", Family: FamilyDataExpansion, No: 2, Words: make([]uint16, 0x8000)},
+		}
+	}
+	return
+}
+
+// wordChange 区域中改变的一个字
+type wordChange struct {
+	area  string
+	word  uint16
+	value uint16
+}
+
+// change 改变快照区域中的一个字
+func change(s *Snapshot, area string, word, value uint16) {
+	s.Area(area).Words[word] = value
+}
+
+func TestDiffSnapshotsIgnore(t *testing.T) {
+	tests := []struct {
+		name    string
+		ignore  []string
+		changes []wordChange
+		want    []string
+	}{
+		{
+			name:    "device in all programs",
+			ignore:  []string{"T"},
+			changes: []wordChange{{"IO", 0x0060, 1}, {"P2", 0x0061, 1}, {"IO", 0x0100, 1}},
+			want:    []string{"X000W"},
+		},
+		{
+			name:    "device with program prefix",
+			ignore:  []string{"p2-n"},
+			changes: []wordChange{{"IO", 0x0600, 1}, {"P1", 0x0600, 1}, {"P2", 0x0600, 1}},
+			want:    []string{"N0000", "P1-N0000"},
+		},
+		{
+			name:    "range in all programs",
+			ignore:  []string{"D0100..D01FF"},
+			changes: []wordChange{{"IO", 0x1150, 1}, {"P1", 0x11FF, 1}, {"P2", 0x1200, 1}},
+			want:    []string{"P2-D0200"},
+		},
+		{
+			name:    "range with program prefix",
+			ignore:  []string{"P1-D0100..P1-D01FF"},
+			changes: []wordChange{{"IO", 0x1150, 1}, {"P1", 0x1150, 1}},
+			want:    []string{"D0150"},
+		},
+		{
+			name:    "single word in all programs",
+			ignore:  []string{"D0100"},
+			changes: []wordChange{{"IO", 0x1100, 1}, {"P2", 0x1100, 1}, {"P2", 0x1101, 1}},
+			want:    []string{"P2-D0101"},
+		},
+		{
+			name:    "bit mask",
+			ignore:  []string{"D0100.3"},
+			changes: []wordChange{{"IO", 0x1100, 0x0008}, {"P1", 0x1100, 0x0018}},
+			want:    []string{"P1-D0100"},
+		},
+		{
+			name:    "byte mask",
+			ignore:  []string{"D0200H", "M001L"},
+			changes: []wordChange{{"IO", 0x1200, 0xFF00}, {"P2", 0x1200, 0xFF01}, {"IO", 0x0181, 0x0100}},
+			want:    []string{"M001W", "P2-D0200"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, after := diffSnapshots()
+			for _, c := range tt.changes {
+				change(after, c.area, c.word, c.value)
+			}
+			diff, err := DiffSnapshots(before, after, &DiffOptions{Ignore: tt.ignore})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, c := range diff.Changes {
+				got = append(got, c.Address)
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("changes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffSnapshotsInvalidIgnore(t *testing.T) {
+	for _, ignore := range []string{"Q", "P2-U", "D0200..D0100", "D0100..P1-D0200"} {
+		before, after := diffSnapshots()
+		if _, err := DiffSnapshots(before, after, &DiffOptions{Ignore: []string{ignore}}); err == nil {
+			t.Errorf("DiffSnapshots with ignore '%v' succeeded", ignore)
+		}
+	}
+}
+
+func TestDiffSnapshotsBits(t *testing.T) {
+	before, after := diffSnapshots()
+	change(after, "IO", 0x0181, 0x8001)
+	change(after, "IO", 0x1100, 0x0009)
+	change(after, "P1", 0x1100, 0x0010)
+	diff, err := DiffSnapshots(before, after, &DiffOptions{Ignore: []string{"D0100.0"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"M001W M0010 M001F",
+		"D0100 D0100.3",
+		"P1-D0100 P1-D0100.4",
+	}
+	if len(diff.Changes) != len(want) {
+		t.Fatalf("%v changes, want %v", len(diff.Changes), len(want))
+	}
+	for k, c := range diff.Changes {
+		if got := c.Address + " " + strings.Join(c.Bits, " "); got != want[k] {
+			t.Errorf("change %v = %v, want %v", k, got, want[k])
+		}
+	}
+	if c := diff.Changes[0]; c.Old != 0 || c.New != 0x8001 || c.Area != "IO" || c.Word != 0x0181 {
+		t.Errorf("change 0 = %+v", c)
+	}
+}
+
+func TestDiffSnapshotsAreas(t *testing.T) {
+	before, after := diffSnapshots()
+	before.Areas = append(before.Areas, &SnapshotArea{Name: "EXT", Family: FamilyDataExpansion, Words: make([]uint16, 0x2000)})
+	after.Areas = append(after.Areas, &SnapshotArea{Name: "GXY", Family: FamilyDataExpansion, No: 7, Words: make([]uint16, 0x1000)})
+	after.Area("P2").Words = after.Area("P2").Words[:0x1000]
+	change(after, "IO", 0x1100, 1)
+	change(before, "P2", 0x2000, 1)
+
+	diff, err := DiffSnapshots(before, after, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(diff.Missing, " "); got != "EXT GXY" {
+		t.Errorf("Missing = %v, want %v", got, "EXT GXY")
+	}
+	if len(diff.Resized) != 1 || diff.Resized[0].Area != "P2" || diff.Resized[0].OldWords != 0x8000 || diff.Resized[0].NewWords != 0x1000 {
+		t.Errorf("Resized = %v, want P2 0x8000 and 0x1000 words", diff.Resized)
+	}
+	if len(diff.Changes) != 1 || diff.Changes[0].Address != "D0100" {
+		t.Errorf("Changes = %+v, want D0100", diff.Changes)
+	}
+
+	// 区域过滤
+	if diff, err = DiffSnapshots(before, after, &DiffOptions{Areas: []string{"p1", "EXT"}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Changes) != 0 || strings.Join(diff.Missing, " ") != "EXT" {
+		t.Errorf("filtered diff = %+v, want only EXT missing", diff)
+	}
+
+	// FR 块 (fr-export 的快照) 也可以过滤
+	before.Areas = append(before.Areas, &SnapshotArea{Name: "FR01", Family: FamilyDataExpansion, No: PC10AreaFR + 1, Words: make([]uint16, 4)})
+	after.Areas = append(after.Areas, &SnapshotArea{Name: "FR01", Family: FamilyDataExpansion, No: PC10AreaFR + 1, Words: []uint16{0, 0, 7, 0}})
+	if diff, err = DiffSnapshots(before, after, &DiffOptions{Areas: []string{"fr01"}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Changes) != 1 || diff.Changes[0].Area != "FR01" || diff.Changes[0].Word != 2 {
+		t.Errorf("FR01 changes = %+v, want word 2", diff.Changes)
+	}
+	if _, err = DiffSnapshots(before, after, &DiffOptions{Areas: []string{"FR40"}}); err == nil {
+		t.Error("DiffSnapshots with area FR40 succeeded")
+	}
+}
@@ -0,0 +1,144 @@
+package toyopuc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+)
+
+// 通信错误
+// 可用 errors.Is 判断，均为可重试的错误
+var (
+	// 帧格式错误 FT、起始符、校验和、站号等
+	ErrInvalidFrame = errors.New("toyopuc: invalid frame")
+	// 长度错误
+	ErrLength = errors.New("toyopuc: invalid length")
+	// 响应的功能码与请求不一致
+	ErrFunctionCodeMismatch = errors.New("toyopuc: function code mismatch")
+	// 等待响应超时 具体的错误为 *TimeoutError
+	ErrTimeout = errors.New("toyopuc: timeout")
+)
+
+// 错误码
+// errors.Is(err, ErrAddressNotInRange) 只比较错误码
+var (
+	ErrHardwareAbnormalityOfCPU                    = &ExceptionError{ExceptionCode: ExceptionCodeHardwareAbnormalityOfCPU}
+	ErrIllegalENQ                                  = &ExceptionError{ExceptionCode: ExceptionCodeIllegalENQ}
+	ErrAbnormalTransmissionQuantity                = &ExceptionError{ExceptionCode: ExceptionCodeAbnormalTransmissionQuantity}
+	ErrIllegalCommandCode                          = &ExceptionError{ExceptionCode: ExceptionCodeIllegalCommandCode}
+	ErrIllegalSubcommandCode                       = &ExceptionError{ExceptionCode: ExceptionCodeIllegalSubcommandCode}
+	ErrIllegalDataByteInCommandFormat              = &ExceptionError{ExceptionCode: ExceptionCodeIllegalDataByteInCommandFormat}
+	ErrIllegalNumberOfFunctionCallOperands         = &ExceptionError{ExceptionCode: ExceptionCodeIllegalNumberOfFunctionCallOperands}
+	ErrWriteForbiddenInArea                        = &ExceptionError{ExceptionCode: ExceptionCodeWriteForbiddenInArea}
+	ErrDisableCommandWithStopDuration              = &ExceptionError{ExceptionCode: ExceptionCodeDisableCommandWithStopDuration}
+	ErrDebugFunctionWithNotDebugMode               = &ExceptionError{ExceptionCode: ExceptionCodeDebugFunctionWithNotDebugMode}
+	ErrNoAccessByAccessProhibitionSetting          = &ExceptionError{ExceptionCode: ExceptionCodeNoAccessByAccessProhibitionSetting}
+	ErrCannotExecWithoutPermission                 = &ExceptionError{ExceptionCode: ExceptionCodeCannotExecWithoutPermission}
+	ErrCannotExecWithoutPermissionByOtherDeviceSet = &ExceptionError{ExceptionCode: ExceptionCodeCannotExecWithoutPermissionByOtherDeviceSet}
+	ErrNoResetAfterWriteIOParams                   = &ExceptionError{ExceptionCode: ExceptionCodeNoResetAfterWriteIOParams}
+	ErrUnenforceableCommandWithSeriousFault        = &ExceptionError{ExceptionCode: ExceptionCodeUnenforceableCommandWithSeriousFault}
+	ErrConflictWithOtherCommand                    = &ExceptionError{ExceptionCode: ExceptionCodeConflictWithOtherCommand}
+	ErrConnotExecWithReset                         = &ExceptionError{ExceptionCode: ExceptionCodeConnotExecWithReset}
+	ErrConnotExecWithStopStatus                    = &ExceptionError{ExceptionCode: ExceptionCodeConnotExecWithStopStatus}
+	ErrAddressNotInRange                           = &ExceptionError{ExceptionCode: ExceptionCodeAddressNotInRange}
+	ErrNumOutOfRange                               = &ExceptionError{ExceptionCode: ExceptionCodeNumOutOfRange}
+	ErrDataOtherThanSpecified                      = &ExceptionError{ExceptionCode: ExceptionCodeDataOtherThanSpecified}
+	ErrErrorInOperandFunctionCall                  = &ExceptionError{ExceptionCode: ExceptionCodeErrorInOperandFunctionCall}
+	ErrCommandWithOutTimerCounter                  = &ExceptionError{ExceptionCode: ExceptionCodeCommandWithOutTimerCounter}
+	ErrNoAnswer                                    = &ExceptionError{ExceptionCode: ExceptionCodeNoAnswer}
+	ErrCommandNotUsed                              = &ExceptionError{ExceptionCode: ExceptionCodeCommandNotUsed}
+	ErrDataModeNoAnswer                            = &ExceptionError{ExceptionCode: ExceptionCodeDataModeNoAnswer}
+	ErrCommandCannotProceed                        = &ExceptionError{ExceptionCode: ExceptionCodeCommandCannotProceed}
+)
+
+// Is 错误码相同时匹配 target 的功能码为 0 时不比较功能码
+func (e *ExceptionError) Is(target error) bool {
+	t, ok := target.(*ExceptionError)
+	if !ok {
+		return false
+	}
+	return t.ExceptionCode == e.ExceptionCode && (t.FunctionCode == 0 || t.FunctionCode == e.FunctionCode)
+}
+
+// Retriable 是否可以重试
+// 与其他指令冲突、复位中、中继的链接模块无响应可以重试，其他错误码重试也不会成功
+// ENQ 错误与传送数量异常是请求本身的问题，重发相同的请求结果相同
+func (e *ExceptionError) Retriable() bool {
+	switch e.ExceptionCode {
+	case ExceptionCodeConflictWithOtherCommand,
+		ExceptionCodeConnotExecWithReset,
+		ExceptionCodeNoAnswer,
+		ExceptionCodeDataModeNoAnswer,
+		ExceptionCodeCommandCannotProceed:
+		return true
+	}
+	return false
+}
+
+// TimeoutError 等待响应超时
+// errors.Is(err, ErrTimeout) 为 true，Err 为传输层的错误
+type TimeoutError struct {
+	Err error
+}
+
+func (e *TimeoutError) Error() string {
+	return ErrTimeout.Error() + ": " + e.Err.Error()
+}
+
+// Unwrap returns the transport error.
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Is 匹配 ErrTimeout
+func (e *TimeoutError) Is(target error) bool {
+	return target == ErrTimeout
+}
+
+// Timeout implements net.Error.
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// Retriable 超时可以重试
+func (e *TimeoutError) Retriable() bool {
+	return true
+}
+
+// IsRetriable 错误是否可以重试
+//
+//	可重试: 超时、帧错误、长度错误、功能码不一致、连接断开 (EOF、ECONNRESET、EPIPE)、可重试的错误码
+//	不可重试: 参数错误、地址错误、其他错误码、ctx 取消或超过期限、
+//	         其他网络错误 (拒绝连接、DNS 解析失败、权限不足等)，重试也不会成功
+func IsRetriable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var r interface{ Retriable() bool }
+	if errors.As(err, &r) {
+		return r.Retriable()
+	}
+	if errors.Is(err, ErrInvalidFrame) || errors.Is(err, ErrLength) || errors.Is(err, ErrFunctionCodeMismatch) {
+		return true
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var netError net.Error
+	return errors.As(err, &netError) && netError.Timeout()
+}
+
+// timeoutError 传输层的超时转为 *TimeoutError
+func timeoutError(err error) error {
+	var netError net.Error
+	if errors.As(err, &netError) && netError.Timeout() {
+		return &TimeoutError{Err: err}
+	}
+	return err
+}
@@ -0,0 +1,49 @@
+package toyopuc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestIsRetriable(t *testing.T) {
+	opError := func(op string, err error) error {
+		return &net.OpError{Op: op, Net: "tcp", Err: err}
+	}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "timeout", err: &TimeoutError{Err: opError("read", os.ErrDeadlineExceeded)}, want: true},
+		{name: "dial timeout", err: opError("dial", os.ErrDeadlineExceeded), want: true},
+		{name: "reset", err: opError("read", os.NewSyscallError("read", syscall.ECONNRESET)), want: true},
+		{name: "broken pipe", err: opError("write", os.NewSyscallError("write", syscall.EPIPE)), want: true},
+		{name: "eof", err: io.EOF, want: true},
+		{name: "invalid frame", err: fmt.Errorf("%w: FT '0x0'", ErrInvalidFrame), want: true},
+		{name: "retriable exception", err: &ExceptionError{ExceptionCode: ExceptionCodeConflictWithOtherCommand}, want: true},
+		{name: "reset", err: &ExceptionError{ExceptionCode: ExceptionCodeConnotExecWithReset}, want: true},
+		{name: "relay no answer", err: fmt.Errorf("relay: %w", &ExceptionError{ExceptionCode: ExceptionCodeNoAnswer}), want: true},
+		{name: "data mode no answer", err: &ExceptionError{ExceptionCode: ExceptionCodeDataModeNoAnswer}, want: true},
+		{name: "cannot proceed", err: &ExceptionError{ExceptionCode: ExceptionCodeCommandCannotProceed}, want: true},
+		{name: "exception", err: &ExceptionError{ExceptionCode: ExceptionCodeAddressNotInRange}, want: false},
+		{name: "illegal enq", err: &ExceptionError{ExceptionCode: ExceptionCodeIllegalENQ}, want: false},
+		{name: "abnormal transmission quantity", err: &ExceptionError{ExceptionCode: ExceptionCodeAbnormalTransmissionQuantity}, want: false},
+		{name: "connection refused", err: opError("dial", os.NewSyscallError("connect", syscall.ECONNREFUSED)), want: false},
+		{name: "dns", err: opError("dial", &net.DNSError{Err: "no such host", Name: "plc"}), want: false},
+		{name: "permission", err: opError("dial", os.NewSyscallError("socket", syscall.EACCES)), want: false},
+		{name: "canceled", err: context.Canceled, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetriable(tt.err); got != tt.want {
+				t.Errorf("IsRetriable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package toyopuc
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 文件寄存器 FR (PC10)
+// FR 以 PC10 块读写 (0xC2 0xC3) 访问，每块为一个区域
+// 地址为 PC10Address(PC10AreaFR+块号, 块内字地址*2)，一帧不能跨越块
+// 写入只改变 RAM，需要 FR 登录 (0xCA) 按块写入闪存
+const (
+	// FR 的字数
+	FRWords = 0x200000
+	// 登录的单位 每块的字数
+	FRBlockWords = 0x8000
+	// 块数 块号 0 - 0x3F
+	FRBlocks = FRWords / FRBlockWords
+)
+
+// FR 登录的等待
+const (
+	// 读出 CPU 状态的间隔
+	frCommitInterval = 50 * time.Millisecond
+	// 一块的最长时间
+	frCommitTimeout = 10 * time.Second
+	// 登录命令响应后 CPU 开始写入 (UnderWritingFlashRegister 置位) 前可能有延迟
+	// 在此期间没有看到写入中时不视为完成
+	frCommitGrace = 500 * time.Millisecond
+)
+
+// ErrFRCommit FR 登录时闪存写入异常 (CPU 状态 AbnormalWriteFlashRegister)
+// 登录命令本身的错误为 *ExceptionError，如 ErrConflictWithOtherCommand (其他登录进行中)
+var ErrFRCommit = errors.New("toyopuc: fr write to flash failed")
+
+// frRange 校验 FR 字地址范围
+func frRange(address uint32, quantity int) (err error) {
+	if quantity < 1 || int(address)+quantity > FRWords {
+		err = fmt.Errorf("toyopuc: fr address '%06X' quantity '%v' must be within '%06X'", address, quantity, FRWords)
+	}
+	return
+}
+
+// frAddress FR 字地址的 PC10 地址 区域号 0x40 + 块号，块内字节地址
+func frAddress(address uint32) uint32 {
+	return PC10Address(PC10AreaFR+byte(address/FRBlockWords), address%FRBlockWords*2)
+}
+
+// frWordsInFrame 一帧能访问的字数 不超过 max，不跨越块
+func frWordsInFrame(address uint32, quantity, max int) int {
+	return minInt(minInt(quantity, max), FRBlockWords-int(address%FRBlockWords))
+}
+
+// frFrameWords 一帧的最大读出/写入字数
+// PC10 块写入的地址为4字节 比数据扩展多1字节
+func frFrameWords(client Client) (read, write int) {
+	read, write = frameBytes(client)
+	return read / 2, (write - 2) / 2
+}
+
+// ReadFR
+// FR 读出 字地址 超过一帧时分割为多帧
+//  Function code         : 1 byte (0xC2)
+func (toyopuc *client) ReadFR(address uint32, quantity int) (results []uint16, err error) {
+	if err = frRange(address, quantity); err != nil {
+		return
+	}
+	max, _ := frFrameWords(toyopuc)
+	results = make([]uint16, 0, quantity)
+	for done := 0; done < quantity; {
+		n := frWordsInFrame(address+uint32(done), quantity-done, max)
+		var data []byte
+		if data, err = toyopuc.ReadPC10Block(frAddress(address+uint32(done)), uint16(n*2)); err != nil {
+			return nil, err
+		}
+		results = append(results, DecodeUint16s(data)...)
+		done += n
+	}
+	return
+}
+
+// WriteFR
+// FR 写入 字地址 超过一帧时分割为多帧
+// 只写入 RAM，断电保持需要 CommitFR
+//  Function code         : 1 byte (0xC3)
+func (toyopuc *client) WriteFR(address uint32, value []uint16) (err error) {
+	if err = frRange(address, len(value)); err != nil {
+		return
+	}
+	_, max := frFrameWords(toyopuc)
+	for done := 0; done < len(value); {
+		n := frWordsInFrame(address+uint32(done), len(value)-done, max)
+		if err = toyopuc.WritePC10Block(frAddress(address+uint32(done)), WordBytes(value[done:done+n])); err != nil {
+			return
+		}
+		done += n
+	}
+	return
+}
+
+// CommitFR
+// FR 登录 包含 address - address+quantity-1 的每一块依次登录
+// 每块发送登录命令后读出 CPU 状态，等待 UnderWritingFlashRegister 置位后清除
+//  Function code         : 1 byte (0xCA)
+//  Data                  : 1 byte FR 区域号 (0x40 + 块号)
+func (toyopuc *client) CommitFR(address uint32, quantity int) (err error) {
+	if err = frRange(address, quantity); err != nil {
+		return
+	}
+	first, last := address/FRBlockWords, (address+uint32(quantity)-1)/FRBlockWords
+	for block := first; block <= last; block++ {
+		if err = toyopuc.commitFRBlock(byte(block)); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// commitFRBlock 登录一块并等待完成
+func (toyopuc *client) commitFRBlock(block byte) (err error) {
+	request := ProtocolDataUnit{
+		FunctionCode: FunRegisterFR,
+		Data:         []byte{PC10AreaFR + block},
+	}
+	if _, err = toyopuc.send(&request); err != nil {
+		return fmt.Errorf("toyopuc: fr block '%02X' registration: %w", block, err)
+	}
+	now := time.Now()
+	deadline, grace := now.Add(frCommitTimeout), now.Add(frCommitGrace)
+	started := false
+	for {
+		var status *CPUStatus
+		if status, err = toyopuc.ReadCPUStatus(); err != nil {
+			return
+		}
+		// 看到写入中之后清除，或超过 frCommitGrace 仍未开始 (已瞬间完成) 时结束
+		if status.UnderWritingFlashRegister {
+			started = true
+		} else if started || time.Now().After(grace) {
+			if status.AbnormalWriteFlashRegister {
+				return fmt.Errorf("%w: block '%02X'", ErrFRCommit, block)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w: fr block '%02X' registration did not finish in '%v'", ErrTimeout, block, frCommitTimeout)
+		}
+		if err = toyopuc.sleep(frCommitInterval); err != nil {
+			return
+		}
+	}
+}
+
+// FROptions FR 导出/导入选项
+type FROptions struct {
+	// 只导出/导入这些块 (0 - 0x3F) 为空时全部块
+	Blocks []int
+	// 导入时只写入 RAM 不登录
+	NoCommit bool
+	// 每帧读出/写入后调用 done 为该块已完成的字数
+	Progress func(area string, done, total int)
+}
+
+// frAreaName FR 块在快照中的区域名 FR00 - FR3F
+func frAreaName(block int) string {
+	return fmt.Sprintf("FR%02X", block)
+}
+
+// isFRArea 快照区域是否为 FR 块 (数据扩展 no 0x40 - 0x7F)
+func isFRArea(family Family, no byte) bool {
+	return family == FamilyDataExpansion && no >= PC10AreaFR && no < PC10AreaFR+FRBlocks
+}
+
+// blockFilter 块号过滤 blocks 为空时全部块
+func blockFilter(blocks []int) (match func(block int) bool, err error) {
+	if len(blocks) == 0 {
+		return func(int) bool { return true }, nil
+	}
+	set := make(map[int]bool)
+	for _, b := range blocks {
+		if b < 0 || b >= FRBlocks {
+			return nil, fmt.Errorf("toyopuc: fr block '%v' must be between '%v' and '%v'", b, 0, FRBlocks-1)
+		}
+		set[b] = true
+	}
+	return func(block int) bool { return set[block] }, nil
+}
+
+// ExportFR 读出 FR 到快照
+// 每块为一个区域 名称 FR00 - FR3F (数据扩展 no 0x40 - 0x7F)，可以用 WriteTo 写入快照文件
+func ExportFR(client Client, options *FROptions) (snapshot *Snapshot, err error) {
+	if options == nil {
+		options = &FROptions{}
+	}
+	match, err := blockFilter(options.Blocks)
+	if err != nil {
+		return
+	}
+	max, _ := frFrameWords(client)
+	s := &Snapshot{Time: time.Now()}
+	for block := 0; block < FRBlocks; block++ {
+		if !match(block) {
+			continue
+		}
+		name := frAreaName(block)
+		area := &SnapshotArea{Name: name, Family: FamilyDataExpansion, No: PC10AreaFR + byte(block), Words: make([]uint16, 0, FRBlockWords)}
+		start := uint32(block * FRBlockWords)
+		for done := 0; done < FRBlockWords; {
+			n := minInt(FRBlockWords-done, max)
+			var words []uint16
+			if words, err = client.ReadFR(start+uint32(done), n); err != nil {
+				err = fmt.Errorf("toyopuc: export fr block '%v' at address '%06X': %w", name, int(start)+done, err)
+				return
+			}
+			area.Words = append(area.Words, words...)
+			done += n
+			if options.Progress != nil {
+				options.Progress(name, done, FRBlockWords)
+			}
+		}
+		s.Areas = append(s.Areas, area)
+	}
+	snapshot = s
+	return
+}
+
+// ImportFR 将快照中的 FR 块写回 PLC 并逐块登录 (NoCommit 时不登录)
+// 只导入 FR 区域，快照中的其他区域使用 Restore
+func ImportFR(client Client, snapshot *Snapshot, options *FROptions) (err error) {
+	if options == nil {
+		options = &FROptions{}
+	}
+	match, err := blockFilter(options.Blocks)
+	if err != nil {
+		return
+	}
+	_, max := frFrameWords(client)
+	for _, area := range snapshot.Areas {
+		if !isFRArea(area.Family, area.No) {
+			continue
+		}
+		block := int(area.No - PC10AreaFR)
+		if !match(block) {
+			continue
+		}
+		total := len(area.Words)
+		if int(area.Start)+total > FRBlockWords {
+			return fmt.Errorf("toyopuc: snapshot area '%v' size '%v' exceeds fr block size '%v'", area.Name, total, FRBlockWords)
+		}
+		if total == 0 {
+			continue
+		}
+		start := uint32(block*FRBlockWords) + uint32(area.Start)
+		for done := 0; done < total; {
+			n := minInt(total-done, max)
+			if err = client.WriteFR(start+uint32(done), area.Words[done:done+n]); err != nil {
+				return fmt.Errorf("toyopuc: import fr block '%v' at address '%06X': %w", area.Name, int(start)+done, err)
+			}
+			done += n
+			if options.Progress != nil {
+				options.Progress(area.Name, done, total)
+			}
+		}
+		if !options.NoCommit {
+			if err = client.CommitFR(start, total); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
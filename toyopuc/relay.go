@@ -0,0 +1,127 @@
+package toyopuc
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// 中继每一级增加的字节数 link 1 + station 2 + 内部帧的头 4 + 指令 1
+const relayHopOverhead = 3 + tcpHeaderSize + 1
+
+// RelayHop 中继的一级 经由链接模块到达的站
+type RelayHop struct {
+	// 链接号
+	Link byte
+	// 站号
+	Station uint16
+}
+
+// RelayPackager implements Packager interface.
+// 将请求封装为中继命令 (0x60)，经由网关 CPU 的链接模块 (FL-net 等) 发送到远程 CPU
+// 多级中继时 Hops[0] 为直接连接的 CPU 的链接模块，最后一级为目标 CPU
+//  CMD: 1 byte (0x60)
+//  Link: 1 byte
+//  Station: 2 bytes
+//  内部帧: FT RC LL LH CMD Data (与 TCP 帧相同)
+// 响应的链接号、站号与请求相同，内部帧为目标 CPU 的响应
+// 中继失败时外层响应的 RC 为错误码 (0x66 0x70 0x72 0x73)，返回 FunctionCode 为 0x60 的 ExceptionError
+// 目标 CPU 的错误响应原样返回为 ExceptionError，内部帧只有头时 FunctionCode 为0
+type RelayPackager struct {
+	// 外层的通信层
+	Packager Packager
+	Hops     []RelayHop
+
+	inner tcpPackager
+}
+
+// NewRelayPackager allocates a new RelayPackager which relays through hops.
+func NewRelayPackager(packager Packager, hops ...RelayHop) *RelayPackager {
+	return &RelayPackager{
+		Packager: packager,
+		Hops:     append([]RelayHop(nil), hops...),
+		inner:    tcpPackager{RequestFT: RequestFTByte, ResponseFTByte: ResponseFTByte},
+	}
+}
+
+// RelayClient creates client which relays through hops over the handler.
+func RelayClient(handler ClientHandler, hops ...RelayHop) Client {
+	return NewClient2(NewRelayPackager(handler, hops...), handler)
+}
+
+// overhead 中继增加的字节数
+func (toyopuc *RelayPackager) overhead() int {
+	n := len(toyopuc.Hops) * relayHopOverhead
+	if r, ok := toyopuc.Packager.(*RelayPackager); ok {
+		n += r.overhead()
+	}
+	return n
+}
+
+// Encode 从最后一级开始逐级封装为中继命令
+func (toyopuc *RelayPackager) Encode(pdu *ProtocolDataUnit) (adu []byte, err error) {
+	if len(toyopuc.Hops) == 0 {
+		err = fmt.Errorf("toyopuc: relay has no hops")
+		return
+	}
+	for k := len(toyopuc.Hops) - 1; k >= 0; k-- {
+		var frame []byte
+		if frame, err = toyopuc.inner.Encode(pdu); err != nil {
+			return
+		}
+		hop := toyopuc.Hops[k]
+		data := make([]byte, 3, 3+len(frame))
+		data[0] = hop.Link
+		binary.LittleEndian.PutUint16(data[1:], hop.Station)
+		pdu = &ProtocolDataUnit{FunctionCode: FunRelay, Data: append(data, frame...)}
+	}
+	return toyopuc.Packager.Encode(pdu)
+}
+
+// Verify 校验外层的帧 内部帧在 Decode 时校验
+func (toyopuc *RelayPackager) Verify(aduRequest []byte, aduResponse []byte) (err error) {
+	return toyopuc.Packager.Verify(aduRequest, aduResponse)
+}
+
+// Decode 逐级取出内部帧 返回目标 CPU 的响应
+// 某一级中继失败时返回该级的响应 (FunctionCode 0x60，Response 为错误码)
+func (toyopuc *RelayPackager) Decode(adu []byte) (pdu *ProtocolDataUnit, err error) {
+	if pdu, err = toyopuc.Packager.Decode(adu); err != nil {
+		return
+	}
+	for _, hop := range toyopuc.Hops {
+		if pdu.Response != 0x00 {
+			return
+		}
+		if pdu.FunctionCode != FunRelay {
+			err = fmt.Errorf("%w: response '%#x' for relay request '%#x'", ErrFunctionCodeMismatch, pdu.FunctionCode, FunRelay)
+			return
+		}
+		data := pdu.Data
+		// 目标 CPU 的错误响应可以只有头 (FT RC LL LH) 没有 CMD
+		min := 3 + tcpHeaderSize + 1
+		if len(data) >= 3+tcpHeaderSize && data[3+1] != 0x00 {
+			min = 3 + tcpHeaderSize
+		}
+		if len(data) < min {
+			err = fmt.Errorf("%w: relay response data size '%v' is less than expected '%v'", ErrLength, len(data), min)
+			return
+		}
+		if link, station := data[0], binary.LittleEndian.Uint16(data[1:]); link != hop.Link || station != hop.Station {
+			err = fmt.Errorf("%w: relay response from link '%v' station '%v', expected link '%v' station '%v'", ErrInvalidFrame, link, station, hop.Link, hop.Station)
+			return
+		}
+		frame := data[3:]
+		if err = toyopuc.inner.Verify(nil, frame); err != nil {
+			return
+		}
+		// 只有头的错误响应 功能码未知为0
+		if len(frame) == tcpHeaderSize {
+			pdu = &ProtocolDataUnit{Response: frame[1]}
+			return
+		}
+		if pdu, err = toyopuc.inner.Decode(frame); err != nil {
+			return
+		}
+	}
+	return
+}
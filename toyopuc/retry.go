@@ -0,0 +1,128 @@
+package toyopuc
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	retryBackoff    = 100 * time.Millisecond
+	retryMaxBackoff = 2 * time.Second
+	retryJitter     = 0.2
+)
+
+// RetryPolicy 重试策略
+type RetryPolicy interface {
+	// Retry 第 attempt 次 (从 1 开始) 发送失败后调用
+	// 返回 ok 为 true 时等待 wait 后重发
+	// write 为写入指令 重复执行可能有副作用
+	Retry(attempt int, write bool, err error) (wait time.Duration, ok bool)
+}
+
+// BackoffRetry 指数退避的重试策略
+// 按 IsRetriable 判断错误是否可以重试
+type BackoffRetry struct {
+	// 最多发送的次数 包含第一次 小于 2 时不重试
+	MaxAttempts int
+	// 第一次重试前的等待时间 之后每次加倍
+	Backoff time.Duration
+	// 等待时间的最大值 0 为不限
+	MaxBackoff time.Duration
+	// 随机增加的等待时间的比例 0 - 1
+	// 多个客户端同时失败时错开重试
+	Jitter float64
+	// 写入指令也重试
+	// 写入在 PLC 已执行但响应丢失时会被再次执行
+	RetryWrites bool
+	// 错误是否可以重试 为nil时使用 IsRetriable
+	Retriable func(err error) bool
+}
+
+// NewBackoffRetry 创建默认的退避策略
+// 等待 100ms 起每次加倍 最多 2s，随机增加 20%，写入不重试
+func NewBackoffRetry(maxAttempts int) *BackoffRetry {
+	return &BackoffRetry{
+		MaxAttempts: maxAttempts,
+		Backoff:     retryBackoff,
+		MaxBackoff:  retryMaxBackoff,
+		Jitter:      retryJitter,
+	}
+}
+
+// Retry implements RetryPolicy.
+func (p *BackoffRetry) Retry(attempt int, write bool, err error) (wait time.Duration, ok bool) {
+	if attempt >= p.MaxAttempts || (write && !p.RetryWrites) {
+		return
+	}
+	retriable := p.Retriable
+	if retriable == nil {
+		retriable = IsRetriable
+	}
+	if !retriable(err) {
+		return
+	}
+	wait = p.Backoff
+	for k := 1; k < attempt; k++ {
+		wait *= 2
+		if p.MaxBackoff > 0 && wait >= p.MaxBackoff {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+	if p.Jitter > 0 {
+		wait += time.Duration(rand.Float64() * p.Jitter * float64(wait))
+	}
+	return wait, true
+}
+
+// WithRetryPolicy returns a shallow copy of the client which retries with policy.
+func (toyopuc *client) WithRetryPolicy(policy RetryPolicy) Client {
+	c := *toyopuc
+	c.retry = policy
+	return &c
+}
+
+// sleep 等待重试 ctx 取消时返回 ctx 的错误
+func (toyopuc *client) sleep(wait time.Duration) error {
+	if toyopuc.ctx == nil {
+		time.Sleep(wait)
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-toyopuc.ctx.Done():
+		return toyopuc.ctx.Err()
+	}
+}
+
+// isWriteFunction 是否为写入指令
+func isWriteFunction(functionCode byte) bool {
+	switch functionCode {
+	case FunSequentialProgramWriteWord,
+		FunIOWriteWord,
+		FunIOWriteByte,
+		FunIOWriteBit,
+		FunIOWriteMultipointWord,
+		FunIOWriteMultipointByte,
+		FunIOWriteMultipointBit,
+		FunProgramExpansionWriteWord,
+		FunDateExpansionWriteWord,
+		FunDataExpansionWriteByte,
+		FunDataExpansionWriteMultipoint,
+		FunPC10WriteBlock,
+		FunPC10WriteMultipoint,
+		FunRegisterFR:
+		return true
+	}
+	return false
+}
+
+// isWriteRequest 是否为写入指令或改变 PLC 状态的命令 重复执行可能有副作用
+func isWriteRequest(request *ProtocolDataUnit) bool {
+	return isWriteFunction(request.FunctionCode) || isWriteCommand(request)
+}
@@ -0,0 +1,151 @@
+package toyopuc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackoffRetry(t *testing.T) {
+	exception := &ExceptionError{ExceptionCode: ExceptionCodeAddressNotInRange}
+	tests := []struct {
+		name    string
+		policy  BackoffRetry
+		attempt int
+		write   bool
+		err     error
+		wait    time.Duration
+		ok      bool
+	}{
+		{name: "attempt 1", policy: BackoffRetry{MaxAttempts: 10, Backoff: 100 * time.Millisecond}, attempt: 1, err: io.EOF, wait: 100 * time.Millisecond, ok: true},
+		{name: "attempt 2", policy: BackoffRetry{MaxAttempts: 10, Backoff: 100 * time.Millisecond}, attempt: 2, err: io.EOF, wait: 200 * time.Millisecond, ok: true},
+		{name: "attempt 4", policy: BackoffRetry{MaxAttempts: 10, Backoff: 100 * time.Millisecond}, attempt: 4, err: io.EOF, wait: 800 * time.Millisecond, ok: true},
+		{name: "below max backoff", policy: BackoffRetry{MaxAttempts: 10, Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}, attempt: 4, err: io.EOF, wait: 800 * time.Millisecond, ok: true},
+		{name: "max backoff", policy: BackoffRetry{MaxAttempts: 10, Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}, attempt: 5, err: io.EOF, wait: time.Second, ok: true},
+		{name: "max backoff no overflow", policy: BackoffRetry{MaxAttempts: 100, Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}, attempt: 80, err: io.EOF, wait: time.Second, ok: true},
+		{name: "last attempt", policy: BackoffRetry{MaxAttempts: 3, Backoff: 100 * time.Millisecond}, attempt: 3, err: io.EOF},
+		{name: "single attempt", policy: BackoffRetry{MaxAttempts: 1, Backoff: 100 * time.Millisecond}, attempt: 1, err: io.EOF},
+		{name: "not retriable", policy: BackoffRetry{MaxAttempts: 3, Backoff: 100 * time.Millisecond}, attempt: 1, err: exception},
+		{name: "write", policy: BackoffRetry{MaxAttempts: 3, Backoff: 100 * time.Millisecond}, attempt: 1, write: true, err: io.EOF},
+		{name: "retry writes", policy: BackoffRetry{MaxAttempts: 3, Backoff: 100 * time.Millisecond, RetryWrites: true}, attempt: 1, write: true, err: io.EOF, wait: 100 * time.Millisecond, ok: true},
+		{name: "custom retriable", policy: BackoffRetry{MaxAttempts: 3, Backoff: 100 * time.Millisecond, Retriable: func(err error) bool { return err == exception }}, attempt: 1, err: exception, wait: 100 * time.Millisecond, ok: true},
+		{name: "custom not retriable", policy: BackoffRetry{MaxAttempts: 3, Backoff: 100 * time.Millisecond, Retriable: func(err error) bool { return err == exception }}, attempt: 1, err: io.EOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wait, ok := tt.policy.Retry(tt.attempt, tt.write, tt.err)
+			if wait != tt.wait || ok != tt.ok {
+				t.Errorf("Retry(%v, %v, %v) = %v, %v, want %v, %v", tt.attempt, tt.write, tt.err, wait, ok, tt.wait, tt.ok)
+			}
+		})
+	}
+}
+
+func TestBackoffRetryJitter(t *testing.T) {
+	policy := NewBackoffRetry(10)
+	tests := []struct {
+		attempt int
+		wait    time.Duration
+	}{
+		{attempt: 1, wait: retryBackoff},
+		{attempt: 3, wait: 4 * retryBackoff},
+		{attempt: 9, wait: retryMaxBackoff},
+	}
+	for _, tt := range tests {
+		max := tt.wait + time.Duration(retryJitter*float64(tt.wait))
+		for k := 0; k < 1000; k++ {
+			wait, ok := policy.Retry(tt.attempt, false, io.EOF)
+			if !ok || wait < tt.wait || wait > max {
+				t.Fatalf("Retry(%v) = %v, %v, want between %v and %v", tt.attempt, wait, ok, tt.wait, max)
+			}
+		}
+	}
+}
+
+func TestIsWriteRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		request *ProtocolDataUnit
+		want    bool
+	}{
+		{name: "read word", request: &ProtocolDataUnit{FunctionCode: FunIOReadWord}},
+		{name: "write word", request: &ProtocolDataUnit{FunctionCode: FunIOWriteWord}, want: true},
+		{name: "write multipoint", request: &ProtocolDataUnit{FunctionCode: FunDataExpansionWriteMultipoint}, want: true},
+		{name: "pc10 read", request: &ProtocolDataUnit{FunctionCode: FunPC10ReadBlock}},
+		{name: "pc10 write", request: &ProtocolDataUnit{FunctionCode: FunPC10WriteBlock}, want: true},
+		{name: "register fr", request: &ProtocolDataUnit{FunctionCode: FunRegisterFR}, want: true},
+		{name: "cpu status", request: &ProtocolDataUnit{FunctionCode: FunCommand, Data: dataBlock(SubCommandReadCPUStatus)}},
+		{name: "run stop", request: &ProtocolDataUnit{FunctionCode: FunCommand, Data: dataBlock(SubCommandRunStop, 0)}, want: true},
+		{name: "read clock", request: &ProtocolDataUnit{FunctionCode: FunCommand, Data: dataBlock(SubCommandReadClock)}},
+		{name: "write clock", request: &ProtocolDataUnit{FunctionCode: FunCommand, Data: dataBlock(SubCommandWriteClock)}, want: true},
+		{name: "command without sub command", request: &ProtocolDataUnit{FunctionCode: FunCommand}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isWriteRequest(tt.request); got != tt.want {
+				t.Errorf("isWriteRequest(%#x % x) = %v, want %v", tt.request.FunctionCode, tt.request.Data, got, tt.want)
+			}
+		})
+	}
+}
+
+// failTransporter 每次发送都返回 EOF 并计数
+type failTransporter struct {
+	sent int32
+}
+
+func (f *failTransporter) Send(aduRequest []byte) (aduResponse []byte, err error) {
+	atomic.AddInt32(&f.sent, 1)
+	return nil, io.EOF
+}
+
+func TestRetryWrites(t *testing.T) {
+	policy := &BackoffRetry{MaxAttempts: 3, Backoff: time.Millisecond}
+	tests := []struct {
+		name string
+		send func(c Client) error
+		want int32
+	}{
+		{name: "read", send: func(c Client) error { _, err := c.Read("D0100", 1); return err }, want: 3},
+		{name: "write", send: func(c Client) error { return c.Write("D0100", []byte{0, 0}) }, want: 1},
+		{name: "read clock", send: func(c Client) error { _, err := c.ReadClock(); return err }, want: 3},
+		{name: "write clock", send: func(c Client) error { return c.WriteClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)) }, want: 1},
+		{name: "run", send: func(c Client) error { return c.RunCPU() }, want: 1},
+		{name: "stop", send: func(c Client) error { return c.StopCPU() }, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transporter := &failTransporter{}
+			client := NewClient2(&tcpPackager{RequestFT: RequestFTByte, ResponseFTByte: ResponseFTByte}, transporter).WithRetryPolicy(policy)
+			if err := tt.send(client); !errors.Is(err, io.EOF) {
+				t.Fatalf("error = %v, want %v", err, io.EOF)
+			}
+			if transporter.sent != tt.want {
+				t.Errorf("sent %v times, want %v", transporter.sent, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryCanceledWhileSleeping(t *testing.T) {
+	transporter := &failTransporter{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewClient2(&tcpPackager{RequestFT: RequestFTByte, ResponseFTByte: ResponseFTByte}, transporter).
+		WithRetryPolicy(&BackoffRetry{MaxAttempts: 3, Backoff: 10 * time.Second}).
+		WithContext(ctx)
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	if _, err := client.Read("D0100", 1); !errors.Is(err, context.Canceled) {
+		t.Fatalf("error = %v, want %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("cancel took %v", elapsed)
+	}
+	if sent := atomic.LoadInt32(&transporter.sent); sent != 1 {
+		t.Errorf("sent %v times, want %v", sent, 1)
+	}
+}
@@ -0,0 +1,117 @@
+//go:build linux
+// +build linux
+
+package toyopuc
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// 波特率
+var baudRates = map[int]uint32{
+	1200:   syscall.B1200,
+	2400:   syscall.B2400,
+	4800:   syscall.B4800,
+	9600:   syscall.B9600,
+	19200:  syscall.B19200,
+	38400:  syscall.B38400,
+	57600:  syscall.B57600,
+	115200: syscall.B115200,
+}
+
+// 数据位
+var dataBits = map[int]uint32{
+	7: syscall.CS7,
+	8: syscall.CS8,
+}
+
+// struct serial_rs485 (linux/serial.h)
+const (
+	ioctlTIOCSRS485  = 0x542F
+	rs485Enabled     = 0x01
+	rs485RTSOnSend   = 0x02
+	rs485ConfigWords = 8
+)
+
+// openSerial 打开串口并设置为原始模式
+// 以非阻塞方式打开，*os.File 支持读写超时
+func openSerial(c *SerialConfig) (port io.ReadWriteCloser, err error) {
+	termios, err := newTermios(c)
+	if err != nil {
+		return
+	}
+	fd, err := syscall.Open(c.Address, syscall.O_RDWR|syscall.O_NOCTTY|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0666)
+	if err != nil {
+		err = fmt.Errorf("toyopuc: open '%v': %v", c.Address, err)
+		return
+	}
+	if err = ioctl(fd, syscall.TCSETS, uintptr(unsafe.Pointer(termios))); err != nil {
+		syscall.Close(fd)
+		err = fmt.Errorf("toyopuc: configure '%v': %v", c.Address, err)
+		return
+	}
+	if c.RS485 {
+		var rs485 [rs485ConfigWords]uint32
+		rs485[0] = rs485Enabled | rs485RTSOnSend
+		if err = ioctl(fd, ioctlTIOCSRS485, uintptr(unsafe.Pointer(&rs485))); err != nil {
+			syscall.Close(fd)
+			err = fmt.Errorf("toyopuc: enable RS-485 on '%v': %v", c.Address, err)
+			return
+		}
+	}
+	port = os.NewFile(uintptr(fd), c.Address)
+	return
+}
+
+// newTermios 原始模式 无回显 无流控
+func newTermios(c *SerialConfig) (termios *syscall.Termios, err error) {
+	termios = &syscall.Termios{}
+	speed, ok := baudRates[c.BaudRate]
+	if !ok {
+		err = fmt.Errorf("toyopuc: unsupported baud rate '%v'", c.BaudRate)
+		return
+	}
+	termios.Cflag = syscall.CREAD | syscall.CLOCAL | speed
+	size, ok := dataBits[c.DataBits]
+	if !ok {
+		err = fmt.Errorf("toyopuc: unsupported data bits '%v'", c.DataBits)
+		return
+	}
+	termios.Cflag |= size
+	switch c.StopBits {
+	case 1:
+	case 2:
+		termios.Cflag |= syscall.CSTOPB
+	default:
+		err = fmt.Errorf("toyopuc: unsupported stop bits '%v'", c.StopBits)
+		return
+	}
+	switch c.Parity {
+	case "N", "":
+		termios.Iflag = syscall.IGNPAR
+	case "E":
+		termios.Cflag |= syscall.PARENB
+		termios.Iflag = syscall.INPCK
+	case "O":
+		termios.Cflag |= syscall.PARENB | syscall.PARODD
+		termios.Iflag = syscall.INPCK
+	default:
+		err = fmt.Errorf("toyopuc: unsupported parity '%v'", c.Parity)
+		return
+	}
+	termios.Cc[syscall.VMIN] = 1
+	termios.Cc[syscall.VTIME] = 0
+	return
+}
+
+func ioctl(fd int, request, arg uintptr) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), request, arg)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+//go:build linux
+// +build linux
+
+package toyopuc_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	"toyopuc/toyopuc"
+	"toyopuc/toyopuc/sim"
+)
+
+// openPTY 打开 pty 主端，返回主端与从端的设备路径
+// 主端以非阻塞方式打开，Close 可以中断阻塞的读取
+func openPTY(t *testing.T) (master *os.File, slave string) {
+	t.Helper()
+	fd, err := syscall.Open("/dev/ptmx", syscall.O_RDWR|syscall.O_NOCTTY|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		t.Skipf("pty is not available: %v", err)
+	}
+	var unlock int32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); errno != 0 {
+		syscall.Close(fd)
+		t.Skipf("unlockpt: %v", errno)
+	}
+	var n uint32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n))); errno != 0 {
+		syscall.Close(fd)
+		t.Skipf("ptsname: %v", errno)
+	}
+	master = os.NewFile(uintptr(fd), "/dev/ptmx")
+	t.Cleanup(func() { master.Close() })
+	return master, fmt.Sprintf("/dev/pts/%d", n)
+}
+
+// servePTY 在 pty 主端模拟 PLC
+// 每个请求帧交给 respond，返回的响应帧写回主端，返回nil时不响应
+func servePTY(master *os.File, requests chan<- []byte, respond func(station byte, pdu *toyopuc.ProtocolDataUnit) []byte) {
+	go func() {
+		r := bufio.NewReader(master)
+		for {
+			frame, err := r.ReadBytes('\r')
+			if err != nil {
+				return
+			}
+			if requests != nil {
+				requests <- frame
+			}
+			if frame[0] != '(' || len(frame) < 7 {
+				continue
+			}
+			body := make([]byte, (len(frame)-4)/2)
+			if _, err = hex.Decode(body, frame[1:len(frame)-3]); err != nil || len(body) < 2 {
+				continue
+			}
+			pdu := &toyopuc.ProtocolDataUnit{FunctionCode: body[1], Data: body[2:]}
+			if response := respond(body[0], pdu); response != nil {
+				master.Write(response)
+			}
+		}
+	}()
+}
+
+// encodeResponse 组装响应帧 ) 站号 RC CMD 数据 SUM CR
+func encodeResponse(station byte, pdu *toyopuc.ProtocolDataUnit) []byte {
+	body := append([]byte{station, pdu.Response, pdu.FunctionCode}, pdu.Data...)
+	text := []byte(fmt.Sprintf("%X", body))
+	return []byte(fmt.Sprintf(")%s%02X\r", text, checksum(text)))
+}
+
+func checksum(b []byte) (sum byte) {
+	for _, c := range b {
+		sum += c
+	}
+	return
+}
+
+// newSerialClient 连接到 pty 从端的客户端
+func newSerialClient(t *testing.T, slave string, station byte) toyopuc.Client {
+	handler := toyopuc.NewSerialClientHandler(slave, station)
+	handler.Timeout = 200 * time.Millisecond
+	t.Cleanup(func() { handler.Close() })
+	return toyopuc.NewClient(handler)
+}
+
+func TestSerialEncode(t *testing.T) {
+	master, slave := openPTY(t)
+	requests := make(chan []byte, 1)
+	servePTY(master, requests, func(station byte, pdu *toyopuc.ProtocolDataUnit) []byte {
+		pdu.Data = []byte{0x34, 0x12}
+		return encodeResponse(station, pdu)
+	})
+	client := newSerialClient(t, slave, 0x01)
+
+	results, err := client.ReadIOWord(0x0100, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(results, []byte{0x34, 0x12}) {
+		t.Errorf("ReadIOWord = % x, want % x", results, []byte{0x34, 0x12})
+	}
+	// 站号 01 CMD 1C 地址 0100 字数 0001 SUM CR
+	want := "(011C00010100" + fmt.Sprintf("%02X", checksum([]byte("011C00010100"))) + "\r"
+	if got := string(<-requests); got != want {
+		t.Errorf("request = %q, want %q", got, want)
+	}
+}
+
+func TestSerialSimulator(t *testing.T) {
+	master, slave := openPTY(t)
+	s := sim.NewServer()
+	servePTY(master, nil, func(station byte, pdu *toyopuc.ProtocolDataUnit) []byte {
+		return encodeResponse(station, s.Handle(pdu))
+	})
+	client := newSerialClient(t, slave, 0x03)
+
+	tests := []struct {
+		address string
+		value   []byte
+		// 字访问的数量为字数
+		quantity uint16
+	}{
+		{address: "D0100", value: []byte{0x34, 0x12, 0x78, 0x56}, quantity: 2},
+		{address: "M0013", value: []byte{1, 0, 1}, quantity: 3},
+		{address: "U08000", value: []byte{0xEF, 0xBE}, quantity: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			if err := client.Write(tt.address, tt.value); err != nil {
+				t.Fatal(err)
+			}
+			got, err := client.Read(tt.address, tt.quantity)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.value) {
+				t.Errorf("Read(%v) = % x, want % x", tt.address, got, tt.value)
+			}
+		})
+	}
+	if w, _ := s.Memory.Get("D0100", 2); w[0] != 0x1234 || w[1] != 0x5678 {
+		t.Errorf("D0100 = %04x, want %04x", w, []uint16{0x1234, 0x5678})
+	}
+	// 错误码
+	if _, err := client.ReadDataExpansionWord(0x05, 0, 1); !errors.Is(err, toyopuc.ErrAddressNotInRange) {
+		t.Errorf("error = %v, want %v", err, toyopuc.ErrAddressNotInRange)
+	}
+}
+
+func TestSerialErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		respond func(station byte, pdu *toyopuc.ProtocolDataUnit) []byte
+		want    error
+	}{
+		{
+			name: "checksum",
+			respond: func(station byte, pdu *toyopuc.ProtocolDataUnit) []byte {
+				frame := encodeResponse(station, pdu)
+				frame[len(frame)-2] ^= 0x01
+				return frame
+			},
+			want: toyopuc.ErrInvalidFrame,
+		},
+		{
+			name: "station",
+			respond: func(station byte, pdu *toyopuc.ProtocolDataUnit) []byte {
+				return encodeResponse(station+1, pdu)
+			},
+			want: toyopuc.ErrInvalidFrame,
+		},
+		{
+			name: "timeout",
+			respond: func(station byte, pdu *toyopuc.ProtocolDataUnit) []byte {
+				return nil
+			},
+			want: toyopuc.ErrTimeout,
+		},
+		{
+			name: "incomplete",
+			respond: func(station byte, pdu *toyopuc.ProtocolDataUnit) []byte {
+				frame := encodeResponse(station, pdu)
+				return frame[:len(frame)-1]
+			},
+			want: toyopuc.ErrTimeout,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			master, slave := openPTY(t)
+			servePTY(master, nil, tt.respond)
+			client := newSerialClient(t, slave, 0x01)
+			if err := client.WriteIOWord(0x0100, []uint16{1}); !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSerialContext(t *testing.T) {
+	master, slave := openPTY(t)
+	servePTY(master, nil, func(station byte, pdu *toyopuc.ProtocolDataUnit) []byte {
+		return nil
+	})
+	handler := toyopuc.NewSerialClientHandler(slave, 0x01)
+	defer handler.Close()
+	client := toyopuc.NewClient(handler)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	if _, err := client.WithContext(ctx).ReadIOWord(0x0100, 1); !errors.Is(err, context.Canceled) {
+		t.Fatalf("error = %v, want %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("cancel took %v", elapsed)
+	}
+}
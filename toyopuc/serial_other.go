@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package toyopuc
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+)
+
+// openSerial 目前只支持 Linux
+// 其他平台可使用 NewClient2 配合自定义 Transporter
+func openSerial(c *SerialConfig) (port io.ReadWriteCloser, err error) {
+	err = fmt.Errorf("toyopuc: serial port '%v' is not supported on '%v'", c.Address, runtime.GOOS)
+	return
+}
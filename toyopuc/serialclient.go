@@ -0,0 +1,349 @@
+package toyopuc
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// 串口计算机链接 ASCII 帧
+	serialRequestStart  = '('
+	serialResponseStart = ')'
+	serialEnd           = '\r'
+	// ( 站号 RC CMD SUM CR
+	serialMinLength = 1 + 2 + 2 + 2 + 2 + 1
+	// 数据按 ASCII 十六进制传送 长度为二进制的两倍
+	serialMaxLength = 1 + 2*tcpMaxLength + 1
+
+	serialBaudRate    = 9600
+	serialDataBits    = 8
+	serialStopBits    = 1
+	serialParity      = "E"
+	serialTimeout     = 5 * time.Second
+	serialIdleTimeout = 60 * time.Second
+)
+
+// SerialConfig 串口配置
+type SerialConfig struct {
+	// Device path (/dev/ttyS0 /dev/ttyUSB0)
+	Address string
+	// Baud rate (default 9600)
+	BaudRate int
+	// Data bits: 7 or 8 (default 8)
+	DataBits int
+	// Stop bits: 1 or 2 (default 1)
+	StopBits int
+	// Parity: N - None, E - Even, O - Odd (default E)
+	Parity string
+	// RS-485 收发方向由驱动切换 (TIOCSRS485)
+	// 硬件自动切换的转换器不需要设置
+	RS485 bool
+}
+
+// SerialClientHandler implements Packager and Transporter interface.
+// 串口 RS-232C/RS-485 计算机链接
+type SerialClientHandler struct {
+	serialPackager
+	serialTransporter
+}
+
+// NewSerialClientHandler allocates a new SerialClientHandler.
+// station 为 CPU 或链接模块的站号
+func NewSerialClientHandler(address string, station byte) *SerialClientHandler {
+	h := &SerialClientHandler{}
+	h.Address = address
+	h.BaudRate = serialBaudRate
+	h.DataBits = serialDataBits
+	h.StopBits = serialStopBits
+	h.Parity = serialParity
+	h.Timeout = serialTimeout
+	h.IdleTimeout = serialIdleTimeout
+	h.Station = station
+	return h
+}
+
+// SerialClient creates serial client with default handler and given device and station.
+func SerialClient(address string, station byte) Client {
+	handler := NewSerialClientHandler(address, station)
+	return NewClient(handler)
+}
+
+// serialPackager implements Packager interface.
+// PDU 与 TCP 帧相同，每个字节转为两个 ASCII 十六进制字符
+type serialPackager struct {
+	// 站号
+	Station byte
+}
+
+// Encode 编码 组装通信报文
+//  (: 1 byte 0x28
+//  站号: 2 bytes ASCII
+//  CMD: 2 bytes ASCII // 指令代码
+//  Data: 2n bytes ASCII // 数据 字节顺序与 TCP 相同
+//  SUM: 2 bytes ASCII // 站号至数据的 ASCII 码之和的低位字节
+//  CR: 1 byte 0x0D
+func (toyopuc *serialPackager) Encode(pdu *ProtocolDataUnit) (adu []byte, err error) {
+	length := 1 + 2*(2+len(pdu.Data)) + 2 + 1
+	if length > serialMaxLength {
+		err = fmt.Errorf("toyopuc: length of data '%v' must not be bigger than '%v'", length, serialMaxLength)
+		return
+	}
+	body := make([]byte, 0, 2+len(pdu.Data))
+	body = append(body, toyopuc.Station, pdu.FunctionCode)
+	body = append(body, pdu.Data...)
+
+	adu = make([]byte, length)
+	adu[0] = serialRequestStart
+	writeHex(adu[1:], body)
+	writeHex(adu[length-3:], []byte{checksum(adu[1 : length-3])})
+	adu[length-1] = serialEnd
+	return
+}
+
+// Verify 校验确认 起始符、结束符、站号与校验和
+func (toyopuc *serialPackager) Verify(aduRequest []byte, aduResponse []byte) (err error) {
+	length := len(aduResponse)
+	if length < serialMinLength || length%2 != 0 {
+		err = fmt.Errorf("%w: response length '%v'", ErrLength, length)
+		return
+	}
+	if aduResponse[0] != serialResponseStart || aduResponse[length-1] != serialEnd {
+		err = fmt.Errorf("%w: response '%q'", ErrInvalidFrame, aduResponse)
+		return
+	}
+	sum, err := readHex(aduResponse[length-3 : length-1])
+	if err != nil {
+		return
+	}
+	if sum[0] != checksum(aduResponse[1:length-3]) {
+		err = fmt.Errorf("%w: response checksum '%#x' does not match '%#x'", ErrInvalidFrame, sum[0], checksum(aduResponse[1:length-3]))
+		return
+	}
+	station, err := readHex(aduResponse[1:3])
+	if err != nil {
+		return
+	}
+	if station[0] != toyopuc.Station {
+		err = fmt.Errorf("%w: response station '%v' does not match request '%v'", ErrInvalidFrame, station[0], toyopuc.Station)
+		return
+	}
+	return
+}
+
+// Decode 解码
+//  ): 1 byte 0x29
+//  站号: 2 bytes ASCII
+//  RC: 2 bytes ASCII // 0x00 正常 ，其他为不正常
+//  CMD: 2 bytes ASCII // 指令代码
+//  Data: 2n bytes ASCII // 数据
+//  SUM: 2 bytes ASCII
+//  CR: 1 byte 0x0D
+func (toyopuc *serialPackager) Decode(adu []byte) (pdu *ProtocolDataUnit, err error) {
+	body, err := readHex(adu[1 : len(adu)-3])
+	if err != nil {
+		return
+	}
+	pdu = &ProtocolDataUnit{}
+	pdu.Response = body[1]
+	pdu.FunctionCode = body[2]
+	if len(body) > 3 {
+		pdu.Data = body[3:]
+	}
+	return
+}
+
+// checksum ASCII 码之和的低位字节
+func checksum(b []byte) (sum byte) {
+	for _, c := range b {
+		sum += c
+	}
+	return
+}
+
+// writeHex 大写 ASCII 十六进制
+func writeHex(dst []byte, src []byte) {
+	const digits = "0123456789ABCDEF"
+	for k, b := range src {
+		dst[2*k] = digits[b>>4]
+		dst[2*k+1] = digits[b&0x0F]
+	}
+}
+
+func readHex(src []byte) (dst []byte, err error) {
+	dst = make([]byte, len(src)/2)
+	if _, err = hex.Decode(dst, src); err != nil {
+		err = fmt.Errorf("%w: response '%q' is not hex", ErrInvalidFrame, src)
+	}
+	return
+}
+
+// serialTransporter implements Transporter interface.
+type serialTransporter struct {
+	SerialConfig
+	// Read & Write timeout
+	Timeout time.Duration
+	// Idle timeout to close the port
+	IdleTimeout time.Duration
+	// Transmission logger
+	Logger *log.Logger
+
+	// 请求的发送权 等待时可以被 ctx 中断
+	sending      sendLock
+	mu           sync.Mutex
+	port         io.ReadWriteCloser
+	closeTimer   *time.Timer
+	lastActivity time.Time
+}
+
+// deadliner 支持超时的串口 (*os.File)
+type deadliner interface {
+	SetDeadline(t time.Time) error
+}
+
+// Send 发送请求并读到 CR 为止
+func (toyopuc *serialTransporter) Send(aduRequest []byte) (aduResponse []byte, err error) {
+	return toyopuc.SendContext(context.Background(), aduRequest)
+}
+
+// SendContext 与 Send 相同，ctx 取消或超过期限时中断正在进行的读写
+// 只有支持超时的串口 (*os.File) 可以中断读写，其他只在等待发送权时中断
+// 中断后关闭串口，丢弃不完整的帧
+func (toyopuc *serialTransporter) SendContext(ctx context.Context, aduRequest []byte) (aduResponse []byte, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	if err = toyopuc.sending.lock(ctx); err != nil {
+		return
+	}
+	defer toyopuc.sending.unlock()
+	toyopuc.mu.Lock()
+	defer toyopuc.mu.Unlock()
+
+	// Open the port if not opened
+	if err = toyopuc.connect(); err != nil {
+		return
+	}
+	// Set timer to close when idle
+	toyopuc.lastActivity = time.Now()
+	toyopuc.startCloseTimer()
+	// Set write and read timeout
+	// ctx 的期限更早时使用 ctx 的期限
+	if d, ok := toyopuc.port.(deadliner); ok {
+		var timeout time.Time
+		if toyopuc.Timeout > 0 {
+			timeout = toyopuc.lastActivity.Add(toyopuc.Timeout)
+		}
+		if deadline, ok := ctx.Deadline(); ok && (timeout.IsZero() || deadline.Before(timeout)) {
+			timeout = deadline
+		}
+		if err = d.SetDeadline(timeout); err != nil {
+			return
+		}
+		defer interruptOnDone(ctx, d.SetDeadline)()
+	}
+	// Send data
+	toyopuc.logf("toyopuc: sending %q", aduRequest)
+	if _, err = toyopuc.port.Write(aduRequest); err != nil {
+		toyopuc.close()
+		err = contextError(ctx, err)
+		return
+	}
+	// 读取到结束符 CR
+	var data [serialMaxLength]byte
+	length := 0
+	for {
+		var n int
+		if n, err = toyopuc.port.Read(data[length:]); err != nil {
+			// 超时后丢弃不完整的帧 重新打开串口
+			toyopuc.close()
+			err = contextError(ctx, err)
+			return
+		}
+		length += n
+		if length > 0 && data[length-1] == serialEnd {
+			break
+		}
+		if length >= serialMaxLength {
+			toyopuc.close()
+			err = fmt.Errorf("%w: response length must not greater than '%v'", ErrLength, serialMaxLength)
+			return
+		}
+	}
+	aduResponse = data[:length]
+	toyopuc.logf("toyopuc: received %q\n", aduResponse)
+	return
+}
+
+// Connect opens the serial port.
+// Connect and Close are exported so that multiple requests can be done with one session
+func (toyopuc *serialTransporter) Connect() error {
+	toyopuc.mu.Lock()
+	defer toyopuc.mu.Unlock()
+
+	return toyopuc.connect()
+}
+
+func (toyopuc *serialTransporter) connect() error {
+	if toyopuc.port == nil {
+		port, err := openSerial(&toyopuc.SerialConfig)
+		if err != nil {
+			return err
+		}
+		toyopuc.port = port
+	}
+	return nil
+}
+
+func (toyopuc *serialTransporter) startCloseTimer() {
+	if toyopuc.IdleTimeout <= 0 {
+		return
+	}
+	if toyopuc.closeTimer == nil {
+		toyopuc.closeTimer = time.AfterFunc(toyopuc.IdleTimeout, toyopuc.closeIdle)
+	} else {
+		toyopuc.closeTimer.Reset(toyopuc.IdleTimeout)
+	}
+}
+
+// Close closes the serial port.
+func (toyopuc *serialTransporter) Close() error {
+	toyopuc.mu.Lock()
+	defer toyopuc.mu.Unlock()
+
+	return toyopuc.close()
+}
+
+func (toyopuc *serialTransporter) logf(format string, v ...interface{}) {
+	if toyopuc.Logger != nil {
+		toyopuc.Logger.Printf(format, v...)
+	}
+}
+
+// close closes the serial port. Caller must hold the mutex before calling this method.
+func (toyopuc *serialTransporter) close() (err error) {
+	if toyopuc.port != nil {
+		err = toyopuc.port.Close()
+		toyopuc.port = nil
+	}
+	return
+}
+
+// closeIdle closes the port if last activity is passed behind IdleTimeout.
+func (toyopuc *serialTransporter) closeIdle() {
+	toyopuc.mu.Lock()
+	defer toyopuc.mu.Unlock()
+
+	if toyopuc.IdleTimeout <= 0 {
+		return
+	}
+	idle := time.Since(toyopuc.lastActivity)
+	if idle >= toyopuc.IdleTimeout {
+		toyopuc.logf("toyopuc: closing serial port due to idle timeout: %v", idle)
+		toyopuc.close()
+	}
+}
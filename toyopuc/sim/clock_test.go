@@ -0,0 +1,65 @@
+package sim
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+	s, client := newTestClient(t)
+	want := time.Date(2024, 2, 29, 12, 34, 56, 0, time.Local)
+	if err := client.WriteClock(want.Add(500 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if d := s.Clock().Sub(want); d < 0 || d > time.Second {
+		t.Errorf("server clock = %v, want %v", s.Clock(), want)
+	}
+	got, err := client.ReadClock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := got.Sub(want); d < 0 || d > time.Second {
+		t.Errorf("ReadClock = %v, want %v", got, want)
+	}
+}
+
+func TestClockLocation(t *testing.T) {
+	s, client := newTestClient(t)
+	// PLC 的时钟为 UTC+9 的时刻
+	loc := time.FixedZone("JST", 9*60*60)
+	plc := client.WithLocation(loc)
+	want := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := plc.WriteClock(want); err != nil {
+		t.Fatal(err)
+	}
+	// 模拟服务器按本地时间解释时钟数据
+	if got := s.Clock().In(time.Local); got.Hour() != want.In(loc).Hour() || got.Day() != want.In(loc).Day() {
+		t.Errorf("PLC wall clock = %v, want %v", got.Format("01-02 15:04"), want.In(loc).Format("01-02 15:04"))
+	}
+	got, err := plc.ReadClock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := got.Sub(want); d < 0 || d > time.Second {
+		t.Errorf("ReadClock = %v, want %v", got, want)
+	}
+	if got.Location() != loc {
+		t.Errorf("ReadClock location = %v, want %v", got.Location(), loc)
+	}
+}
+
+func TestSyncClock(t *testing.T) {
+	s, client := newTestClient(t)
+	s.SetClock(time.Now().Add(-90 * time.Second))
+	drift, err := client.SyncClock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 时钟的分辨率为1秒
+	if drift < -92*time.Second || drift > -88*time.Second {
+		t.Errorf("drift = %v, want about %v", drift, -90*time.Second)
+	}
+	if d := time.Since(s.Clock()); d < -time.Second || d > time.Second {
+		t.Errorf("server clock is %v behind after sync", d)
+	}
+}
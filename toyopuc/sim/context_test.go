@@ -0,0 +1,88 @@
+package sim
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"toyopuc/toyopuc"
+)
+
+func TestContextWhileWaiting(t *testing.T) {
+	s, client := newTestClient(t)
+	s.AddFault(Fault{Kind: FaultDelay, Delay: 500 * time.Millisecond, Count: 1})
+	slow := make(chan error, 1)
+	go func() {
+		_, err := client.Read("D0100", 1)
+		slow <- err
+	}()
+	// 等待慢请求开始
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := client.WithContext(ctx).Read("D0200", 1)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Errorf("waited %v behind the slow request", elapsed)
+	}
+	if err = <-slow; err != nil {
+		t.Fatalf("slow request: %v", err)
+	}
+}
+
+func TestContextUDP(t *testing.T) {
+	s := NewServer()
+	if err := s.StartUDP("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	handler := toyopuc.NewUDPClientHandler(s.PacketAddr().String())
+	handler.Timeout = time.Second
+	defer func() {
+		handler.Close()
+		s.Close()
+	}()
+	client := toyopuc.NewClient(handler)
+
+	s.AddFault(Fault{Kind: FaultTimeout, Count: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := client.WithContext(ctx).Read("D0100", 1)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("error = %v, want %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("cancel took %v", elapsed)
+	}
+	if err = s.Memory.Set("D0100", 0x1234); err != nil {
+		t.Fatal(err)
+	}
+	got, err := client.Read("D0100", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := toyopuc.DecodeUint16s(got)[0]; w != 0x1234 {
+		t.Errorf("D0100 = %04x, want %04x", w, 0x1234)
+	}
+}
+
+func TestContextNil(t *testing.T) {
+	s, client := newTestClient(t)
+	if err := s.Memory.Set("D0100", 0x1234); err != nil {
+		t.Fatal(err)
+	}
+	// nil 等同于 context.Background()
+	var ctx context.Context
+	got, err := client.WithContext(ctx).Read("D0100", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0] != 0x34 || got[1] != 0x12 {
+		t.Errorf("Read(D0100) = % x, want % x", got, []byte{0x34, 0x12})
+	}
+}
@@ -0,0 +1,85 @@
+package sim
+
+import (
+	"time"
+
+	"toyopuc/toyopuc"
+)
+
+// CPUStatus 当前的 CPU 状态
+func (s *Server) CPUStatus() toyopuc.CPUStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// SetCPUStatus 设置 CPU 状态 如报警、重故障
+func (s *Server) SetCPUStatus(status toyopuc.CPUStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+// Clock 当前的时钟
+func (s *Server) Clock() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return time.Now().Add(s.clock)
+}
+
+// SetClock 设置时钟 之后与本机时间同步走动
+func (s *Server) SetClock(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clock = time.Until(t)
+}
+
+// command 命令 (0x32) 按子命令分发 响应以子命令开头
+func (s *Server) command(r *reader) (results []byte, code byte) {
+	sub := r.uint16()
+	if r.failed {
+		code = toyopuc.ExceptionCodeIllegalDataByteInCommandFormat
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch sub {
+	case toyopuc.SubCommandReadCPUStatus:
+		if !r.done() {
+			code = toyopuc.ExceptionCodeIllegalDataByteInCommandFormat
+			return
+		}
+		results = s.status.Bytes()
+	case toyopuc.SubCommandRunStop:
+		run := r.byte()
+		if !r.done() || run > 1 {
+			code = toyopuc.ExceptionCodeIllegalDataByteInCommandFormat
+			return
+		}
+		if run == 1 && s.status.FatalFailure {
+			code = toyopuc.ExceptionCodeUnenforceableCommandWithSeriousFault
+			return
+		}
+		s.status.Run = run == 1
+		s.status.UnderStop = run == 0
+	case toyopuc.SubCommandReadClock:
+		if !r.done() {
+			code = toyopuc.ExceptionCodeIllegalDataByteInCommandFormat
+			return
+		}
+		results, _ = toyopuc.EncodeClock(time.Now().Add(s.clock).Local())
+	case toyopuc.SubCommandWriteClock:
+		t, err := toyopuc.DecodeClock(r.rest(), time.Local)
+		if err != nil {
+			code = toyopuc.ExceptionCodeDataOtherThanSpecified
+			return
+		}
+		s.clock = time.Until(t)
+	default:
+		code = toyopuc.ExceptionCodeIllegalSubcommandCode
+		return
+	}
+	results = append([]byte{byte(sub), byte(sub >> 8)}, results...)
+	return
+}
@@ -0,0 +1,59 @@
+package sim
+
+import (
+	"errors"
+	"testing"
+
+	"toyopuc/toyopuc"
+)
+
+func TestRunStop(t *testing.T) {
+	s, client := newTestClient(t)
+	steps := []struct {
+		name string
+		do   func() error
+		run  bool
+	}{
+		{name: "stop", do: client.StopCPU, run: false},
+		{name: "run", do: client.RunCPU, run: true},
+	}
+	for _, step := range steps {
+		if err := step.do(); err != nil {
+			t.Fatalf("%v: %v", step.name, err)
+		}
+		status, err := client.ReadCPUStatus()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Run != step.run || status.UnderStop == step.run {
+			t.Errorf("after %v: status = %v", step.name, status)
+		}
+		if !status.PC10Mode {
+			t.Errorf("after %v: PC10 mode is lost", step.name)
+		}
+		if s.CPUStatus().Run != step.run {
+			t.Errorf("after %v: server run = %v", step.name, s.CPUStatus().Run)
+		}
+	}
+}
+
+func TestRunWithFatalFailure(t *testing.T) {
+	s, client := newTestClient(t)
+	if err := client.StopCPU(); err != nil {
+		t.Fatal(err)
+	}
+	status := s.CPUStatus()
+	status.FatalFailure = true
+	s.SetCPUStatus(status)
+
+	if err := client.RunCPU(); !errors.Is(err, toyopuc.ErrUnenforceableCommandWithSeriousFault) {
+		t.Fatalf("RunCPU error = %v, want %v", err, toyopuc.ErrUnenforceableCommandWithSeriousFault)
+	}
+	got, err := client.ReadCPUStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Run || !got.FatalFailure {
+		t.Errorf("status = %v, want stopped with fatal failure", got)
+	}
+}
@@ -0,0 +1,350 @@
+package sim
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"toyopuc/toyopuc"
+)
+
+// FaultKind 故障类型
+type FaultKind int
+
+const (
+	// 响应 RC 为 Fault.Code 的错误码
+	FaultException FaultKind = iota
+	// 响应 FT 错误
+	FaultWrongFT
+	// 响应功能码与请求不一致
+	FaultFunctionCode
+	// 响应帧缺少最后一个字节，连接保持
+	FaultTruncated
+	// 响应长度头为0
+	FaultZeroLength
+	// 响应长度头超过最大长度
+	FaultOversizedLength
+	// 延迟 Fault.Delay 后正常响应
+	FaultDelay
+	// 发送部分响应帧后断开连接 UDP 时不响应
+	FaultDrop
+	// 不响应，连接保持 客户端等待超时
+	FaultTimeout
+)
+
+// String 故障类型名称
+func (k FaultKind) String() string {
+	switch k {
+	case FaultException:
+		return "exception"
+	case FaultWrongFT:
+		return "wrong FT"
+	case FaultFunctionCode:
+		return "function code mismatch"
+	case FaultTruncated:
+		return "truncated frame"
+	case FaultZeroLength:
+		return "zero length"
+	case FaultOversizedLength:
+		return "oversized length"
+	case FaultDelay:
+		return "delay"
+	case FaultDrop:
+		return "drop connection"
+	case FaultTimeout:
+		return "timeout"
+	}
+	return "unknown"
+}
+
+// AddressRange 地址范围 [From, To] 字地址
+// PC10 指令按区域号匹配数据扩展的 No，文件寄存器 FR 的块为 PC10AreaFR 起的区域号
+type AddressRange struct {
+	Family toyopuc.Family
+	// 扩展指令的程序号/区域号
+	No   byte
+	From uint16
+	To   uint16
+}
+
+// ParseRange 按设备地址生成地址范围 如 ParseRange("D0100", "D01FF")
+// 两个地址必须在同一区域
+func ParseRange(from, to string) (r *AddressRange, err error) {
+	a, err := toyopuc.ParseAddress(from)
+	if err != nil {
+		return
+	}
+	b, err := toyopuc.ParseAddress(to)
+	if err != nil {
+		return
+	}
+	if a.Family != b.Family || a.No != b.No || a.Word > b.Word {
+		err = fmt.Errorf("sim: '%v' and '%v' are not a range in the same area", from, to)
+		return
+	}
+	r = &AddressRange{Family: a.Family, No: a.No, From: a.Word, To: b.Word}
+	return
+}
+
+// Fault 故障规则
+// 请求同时满足功能码与地址范围时注入故障
+type Fault struct {
+	Kind FaultKind
+	// 匹配的功能码 为空时匹配全部
+	FunctionCodes []byte
+	// 匹配的地址范围 为nil时不按地址匹配
+	Addresses *AddressRange
+	// FaultException 的错误码
+	Code byte
+	// FaultDelay 的延迟时间
+	Delay time.Duration
+	// 注入次数 0 为不限
+	Count int
+}
+
+// AddFault 添加故障规则 按添加顺序匹配第一个
+func (s *Server) AddFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = append(s.faults, &f)
+}
+
+// ClearFaults 清除全部故障规则
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = nil
+}
+
+// matchFault 查找匹配的故障规则，注入次数用完时移除
+func (s *Server) matchFault(pdu *toyopuc.ProtocolDataUnit) *Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, f := range s.faults {
+		if !f.matches(pdu) {
+			continue
+		}
+		if f.Count > 0 {
+			f.Count--
+			if f.Count == 0 {
+				s.faults = append(s.faults[:k:k], s.faults[k+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+// matches 请求是否匹配
+func (f *Fault) matches(pdu *toyopuc.ProtocolDataUnit) bool {
+	if len(f.FunctionCodes) > 0 {
+		found := false
+		for _, fc := range f.FunctionCodes {
+			if fc == pdu.FunctionCode {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.Addresses == nil {
+		return true
+	}
+	for _, s := range requestSpans(pdu) {
+		if s.family == f.Addresses.Family && s.no == f.Addresses.No && s.start <= int(f.Addresses.To) && s.end > int(f.Addresses.From) {
+			return true
+		}
+	}
+	return false
+}
+
+// respond 按故障规则发送响应
+// 错误码、断开与超时不执行请求，失败的写入不改变内存
+// 返回 false 时关闭连接
+func (f *Fault) respond(s *Server, w func([]byte) error, pdu *toyopuc.ProtocolDataUnit) bool {
+	switch f.Kind {
+	case FaultException:
+		w(encodeFrame(&toyopuc.ProtocolDataUnit{FunctionCode: pdu.FunctionCode, Response: f.Code}))
+	case FaultWrongFT:
+		frame := encodeFrame(s.Handle(pdu))
+		frame[0] = toyopuc.RequestFTByte
+		w(frame)
+	case FaultFunctionCode:
+		response := s.Handle(pdu)
+		response.FunctionCode++
+		w(encodeFrame(response))
+	case FaultTruncated:
+		frame := encodeFrame(s.Handle(pdu))
+		w(frame[:len(frame)-1])
+	case FaultZeroLength:
+		frame := encodeFrame(s.Handle(pdu))
+		binary.LittleEndian.PutUint16(frame[2:], 0)
+		w(frame[:headerSize])
+	case FaultOversizedLength:
+		frame := encodeFrame(s.Handle(pdu))
+		binary.LittleEndian.PutUint16(frame[2:], 0xFFFF)
+		w(frame)
+	case FaultDelay:
+		time.Sleep(f.Delay)
+		w(encodeFrame(s.Handle(pdu)))
+	case FaultDrop:
+		frame := encodeFrame(&toyopuc.ProtocolDataUnit{FunctionCode: pdu.FunctionCode})
+		w(frame[:headerSize])
+		return false
+	case FaultTimeout:
+	}
+	return true
+}
+
+// span 请求访问的字地址范围 [start, end)
+type span struct {
+	family     toyopuc.Family
+	no         byte
+	start, end int
+}
+
+// requestSpans 按功能码解析请求访问的字地址范围
+func requestSpans(pdu *toyopuc.ProtocolDataUnit) (spans []span) {
+	d := pdu.Data
+	u16 := func(p int) int {
+		if p+2 > len(d) {
+			return 0
+		}
+		return int(binary.LittleEndian.Uint16(d[p:]))
+	}
+	switch pdu.FunctionCode {
+	case toyopuc.FunSequentialProgramReadWord, toyopuc.FunSequentialProgramWriteWord:
+		start, end := wordRange(d, 0, 2, pdu.FunctionCode == toyopuc.FunSequentialProgramWriteWord)
+		spans = append(spans, span{family: toyopuc.FamilySequentialProgram, start: start, end: end})
+	case toyopuc.FunIOReadWord, toyopuc.FunIOWriteWord:
+		start, end := wordRange(d, 0, 2, pdu.FunctionCode == toyopuc.FunIOWriteWord)
+		spans = append(spans, span{family: toyopuc.FamilyIO, start: start, end: end})
+	case toyopuc.FunIOReadByte, toyopuc.FunIOWriteByte:
+		start, end := wordRange(d, 0, 1, pdu.FunctionCode == toyopuc.FunIOWriteByte)
+		spans = append(spans, span{family: toyopuc.FamilyIO, start: start, end: end})
+	case toyopuc.FunIOReadBit, toyopuc.FunIOWriteBit:
+		spans = append(spans, span{family: toyopuc.FamilyIO, start: u16(0) / 16, end: u16(0)/16 + 1})
+	case toyopuc.FunIOReadMultipointWord, toyopuc.FunIOReadMultipointByte, toyopuc.FunIOReadMultipointBit,
+		toyopuc.FunIOWriteMultipointWord, toyopuc.FunIOWriteMultipointByte, toyopuc.FunIOWriteMultipointBit:
+		size, div := 2, 1
+		switch pdu.FunctionCode {
+		case toyopuc.FunIOWriteMultipointWord:
+			size = 4
+		case toyopuc.FunIOWriteMultipointByte, toyopuc.FunIOWriteMultipointBit:
+			size = 3
+		}
+		switch pdu.FunctionCode {
+		case toyopuc.FunIOReadMultipointByte, toyopuc.FunIOWriteMultipointByte:
+			div = 2
+		case toyopuc.FunIOReadMultipointBit, toyopuc.FunIOWriteMultipointBit:
+			div = 16
+		}
+		for p := 0; p+2 <= len(d); p += size {
+			w := u16(p) / div
+			spans = append(spans, span{family: toyopuc.FamilyIO, start: w, end: w + 1})
+		}
+	case toyopuc.FunProgramExpansionReadWord, toyopuc.FunProgramExpansionWriteWord:
+		if len(d) > 0 {
+			start, end := wordRange(d, 1, 2, pdu.FunctionCode == toyopuc.FunProgramExpansionWriteWord)
+			spans = append(spans, span{family: toyopuc.FamilyProgramExpansion, no: d[0], start: start, end: end})
+		}
+	case toyopuc.FunDataExpansionReadWord, toyopuc.FunDateExpansionWriteWord:
+		if len(d) > 0 {
+			start, end := wordRange(d, 1, 2, pdu.FunctionCode == toyopuc.FunDateExpansionWriteWord)
+			spans = append(spans, span{family: toyopuc.FamilyDataExpansion, no: d[0], start: start, end: end})
+		}
+	case toyopuc.FunDataExpansionReadByte, toyopuc.FunDataExpansionWriteByte:
+		if len(d) > 0 {
+			start, end := wordRange(d, 1, 1, pdu.FunctionCode == toyopuc.FunDataExpansionWriteByte)
+			spans = append(spans, span{family: toyopuc.FamilyDataExpansion, no: d[0], start: start, end: end})
+		}
+	case toyopuc.FunDataExpansionReadMultipoint, toyopuc.FunDataExpansionWriteMultipoint:
+		if len(d) < 3 {
+			return
+		}
+		write := pdu.FunctionCode == toyopuc.FunDataExpansionWriteMultipoint
+		p := 3
+		groups := []struct{ n, div, value int }{{int(d[0]), 16, 1}, {int(d[1]), 2, 1}, {int(d[2]), 1, 2}}
+		for _, g := range groups {
+			for k := 0; k < g.n && p+3 <= len(d); k++ {
+				w := u16(p+1) / g.div
+				spans = append(spans, span{family: toyopuc.FamilyDataExpansion, no: d[p], start: w, end: w + 1})
+				p += 3
+				if write {
+					p += g.value
+				}
+			}
+		}
+	case toyopuc.FunPC10ReadBlock, toyopuc.FunPC10WriteBlock:
+		if len(d) < 4 {
+			return
+		}
+		no, offset := pc10Address(d)
+		quantity := u16(4)
+		if pdu.FunctionCode == toyopuc.FunPC10WriteBlock {
+			quantity = len(d) - 4
+		}
+		if quantity < 1 {
+			quantity = 1
+		}
+		spans = append(spans, span{family: toyopuc.FamilyDataExpansion, no: no, start: offset / 2, end: (offset + quantity + 1) / 2})
+	case toyopuc.FunPC10ReadMultipoint, toyopuc.FunPC10WriteMultipoint:
+		if len(d) < 3 {
+			return
+		}
+		write := pdu.FunctionCode == toyopuc.FunPC10WriteMultipoint
+		p := 3
+		// 位为位地址，字节与字为字节地址
+		groups := []struct{ n, div, value int }{{int(d[0]), 16, 1}, {int(d[1]), 2, 1}, {int(d[2]), 2, 2}}
+		for _, g := range groups {
+			for k := 0; k < g.n && p+4 <= len(d); k++ {
+				no, offset := pc10Address(d[p:])
+				w := offset / g.div
+				spans = append(spans, span{family: toyopuc.FamilyDataExpansion, no: no, start: w, end: w + 1})
+				p += 4
+				if write {
+					p += g.value
+				}
+			}
+		}
+	case toyopuc.FunRegisterFR:
+		// 登录整个块
+		if len(d) > 0 {
+			spans = append(spans, span{family: toyopuc.FamilyDataExpansion, no: d[0], start: 0, end: toyopuc.FRBlockWords})
+		}
+	}
+	return
+}
+
+// pc10Address 解析 PC10 的32位地址 区域号<<24 | 区域内的地址
+func pc10Address(d []byte) (no byte, offset int) {
+	address := binary.LittleEndian.Uint32(d)
+	return byte(address >> 24), int(address & 0xFFFFFF)
+}
+
+// wordRange 块读写请求的字地址范围
+// p 为地址的位置，unit 为每个单位的字节数 (字 2 字节 1)
+func wordRange(d []byte, p, unit int, write bool) (start, end int) {
+	if p+2 > len(d) {
+		return
+	}
+	address := int(binary.LittleEndian.Uint16(d[p:]))
+	quantity := 1
+	if write {
+		quantity = (len(d) - p - 2) / unit
+	} else if p+4 <= len(d) {
+		quantity = int(binary.LittleEndian.Uint16(d[p+2:]))
+	}
+	if quantity < 1 {
+		quantity = 1
+	}
+	// 换算为字地址
+	byteStart, byteEnd := address*unit, (address+quantity)*unit
+	start, end = byteStart/2, (byteEnd+1)/2
+	return
+}
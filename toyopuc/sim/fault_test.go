@@ -0,0 +1,136 @@
+package sim
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"toyopuc/toyopuc"
+)
+
+func TestFault(t *testing.T) {
+	tests := []struct {
+		name  string
+		fault Fault
+		want  error
+		// 失败的写入不改变内存
+		unchanged bool
+	}{
+		{name: "exception", fault: Fault{Kind: FaultException, Code: toyopuc.ExceptionCodeAddressNotInRange}, want: toyopuc.ErrAddressNotInRange, unchanged: true},
+		{name: "wrong FT", fault: Fault{Kind: FaultWrongFT}, want: toyopuc.ErrInvalidFrame},
+		{name: "function code", fault: Fault{Kind: FaultFunctionCode}, want: toyopuc.ErrFunctionCodeMismatch},
+		{name: "truncated", fault: Fault{Kind: FaultTruncated}, want: toyopuc.ErrTimeout},
+		{name: "zero length", fault: Fault{Kind: FaultZeroLength}, want: toyopuc.ErrLength},
+		{name: "oversized length", fault: Fault{Kind: FaultOversizedLength}, want: toyopuc.ErrLength},
+		{name: "delay", fault: Fault{Kind: FaultDelay, Delay: time.Second}, want: toyopuc.ErrTimeout},
+		{name: "drop", fault: Fault{Kind: FaultDrop}, want: io.EOF, unchanged: true},
+		{name: "timeout", fault: Fault{Kind: FaultTimeout}, want: toyopuc.ErrTimeout, unchanged: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer()
+			if err := s.Start("127.0.0.1:0"); err != nil {
+				t.Fatal(err)
+			}
+			handler := toyopuc.NewTCPClientHandler(s.Addr().String())
+			handler.Timeout = 200 * time.Millisecond
+			defer func() {
+				handler.Close()
+				s.Close()
+			}()
+			client := toyopuc.NewClient(handler)
+
+			f := tt.fault
+			f.FunctionCodes = []byte{toyopuc.FunIOWriteWord}
+			f.Count = 1
+			s.AddFault(f)
+			err := client.Write("D0100", []byte{0x34, 0x12})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Write error = %v, want %v", err, tt.want)
+			}
+			if tt.unchanged {
+				if w, _ := s.Memory.Get("D0100", 1); w[0] != 0 {
+					t.Errorf("D0100 = %04x after a failed write, want %04x", w[0], 0)
+				}
+			}
+			// 故障注入一次后恢复正常
+			if err = client.Write("D0100", []byte{0x78, 0x56}); err != nil {
+				t.Fatal(err)
+			}
+			if w, _ := s.Memory.Get("D0100", 1); w[0] != 0x5678 {
+				t.Errorf("D0100 = %04x, want %04x", w[0], 0x5678)
+			}
+		})
+	}
+}
+
+func TestFaultAddressRange(t *testing.T) {
+	s, client := newTestClient(t)
+	r, err := ParseRange("D0100", "D01FF")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.AddFault(Fault{Kind: FaultException, Code: toyopuc.ExceptionCodeWriteForbiddenInArea, Addresses: r})
+	if err = client.Write("D0300", []byte{1, 0}); err != nil {
+		t.Fatalf("write outside the range: %v", err)
+	}
+	if err = client.Write("D01FF", []byte{1, 0, 2, 0}); !errors.Is(err, toyopuc.ErrWriteForbiddenInArea) {
+		t.Fatalf("Write error = %v, want %v", err, toyopuc.ErrWriteForbiddenInArea)
+	}
+	if w, _ := s.Memory.Get("D01FF", 2); w[0] != 0 || w[1] != 0 {
+		t.Errorf("D01FF = %04x after a failed write, want 0", w)
+	}
+	s.ClearFaults()
+	if err = client.Write("D01FF", []byte{1, 0}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFaultAddressRangePC10(t *testing.T) {
+	s, client := newTestClient(t)
+	r, err := ParseRange("U08100", "U081FF")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fr := &AddressRange{Family: toyopuc.FamilyDataExpansion, No: toyopuc.PC10AreaFR + 1, From: 0x0100, To: 0x01FF}
+	s.AddFault(Fault{Kind: FaultException, Code: toyopuc.ExceptionCodeAddressNotInRange, Addresses: r})
+	s.AddFault(Fault{Kind: FaultException, Code: toyopuc.ExceptionCodeAddressNotInRange, Addresses: fr})
+	// U08000 为区域 09 的字地址 0000
+	tests := []struct {
+		name  string
+		send  func() error
+		fault bool
+	}{
+		{name: "block before", send: func() error { _, err := client.ReadPC10Block(toyopuc.PC10Address(0x09, 0x01FE), 2); return err }},
+		{name: "block overlapping", send: func() error { _, err := client.ReadPC10Block(toyopuc.PC10Address(0x09, 0x01FE), 4); return err }, fault: true},
+		{name: "block after", send: func() error { _, err := client.ReadPC10Block(toyopuc.PC10Address(0x09, 0x0400), 2); return err }},
+		{name: "block other area", send: func() error { _, err := client.ReadPC10Block(toyopuc.PC10Address(0x08, 0x0200), 2); return err }},
+		{name: "write block", send: func() error { return client.WritePC10Block(toyopuc.PC10Address(0x09, 0x03FE), []byte{1, 2}) }, fault: true},
+		{name: "multipoint word", send: func() error {
+			_, err := client.ReadPC10Multipoint(nil, nil, []uint32{toyopuc.PC10Address(0x09, 0x0000), toyopuc.PC10Address(0x09, 0x0300)})
+			return err
+		}, fault: true},
+		{name: "multipoint bit", send: func() error {
+			_, err := client.ReadPC10Multipoint([]uint32{toyopuc.PC10Address(0x09, 0x1000)}, nil, nil)
+			return err
+		}, fault: true},
+		{name: "multipoint outside", send: func() error {
+			return client.WritePC10Multipoint(nil, nil, []uint32{toyopuc.PC10Address(0x09, 0x0400)}, []byte{1}, nil, nil)
+		}},
+		{name: "fr", send: func() error { _, err := client.ReadFR(toyopuc.FRBlockWords+0x0180, 1); return err }, fault: true},
+		{name: "fr other block", send: func() error { _, err := client.ReadFR(0x0180, 1); return err }},
+		{name: "fr registration", send: func() error { return client.CommitFR(toyopuc.FRBlockWords, 1) }, fault: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.send()
+			if tt.fault && !errors.Is(err, toyopuc.ErrAddressNotInRange) {
+				t.Errorf("error = %v, want %v", err, toyopuc.ErrAddressNotInRange)
+			}
+			if !tt.fault && err != nil {
+				t.Errorf("error = %v, want nil", err)
+			}
+		})
+	}
+}
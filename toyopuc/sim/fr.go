@@ -0,0 +1,112 @@
+package sim
+
+import (
+	"time"
+
+	"toyopuc/toyopuc"
+)
+
+// FR 按 FR 字地址读出 (RAM)
+func (m *Memory) FR(address uint32, quantity int) []uint16 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	values := make([]uint16, quantity)
+	copy(values, m.words(toyopuc.FamilyDataExpansion, frFirstArea)[address:])
+	return values
+}
+
+// SetFR 按 FR 字地址写入 (RAM)
+func (m *Memory) SetFR(address uint32, value []uint16) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	copy(m.words(toyopuc.FamilyDataExpansion, frFirstArea)[address:], value)
+}
+
+// SetFRRegistration 设置 FR 登录
+// delay 为登录所需的时间，期间 CPU 状态 UnderWritingFlashRegister 置位
+// fail 时登录结束后 AbnormalWriteFlashRegister 置位，块不写入闪存
+func (s *Server) SetFRRegistration(delay time.Duration, fail bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.frDelay, s.frFail = delay, fail
+}
+
+// SetFRStartDelay 登录命令响应后经过 delay 才开始写入 (UnderWritingFlashRegister 置位)
+// 模拟 CPU 在下一个扫描周期才开始登录
+func (s *Server) SetFRStartDelay(delay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.frStart = delay
+}
+
+// FlashFR 已登录的 FR 块 (0 - 0x3F) 未登录时返回nil
+func (s *Server) FlashFR(block int) []uint16 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := s.flash[frFirstArea+byte(block)]
+	if w == nil {
+		return nil
+	}
+	return append([]uint16(nil), w...)
+}
+
+// registerFR FR 登录 (0xCA) 数据为 FR 区域号 0x40 + 块号
+// 登录中再次登录时返回 ExceptionCodeConflictWithOtherCommand
+func (s *Server) registerFR(r *reader) (results []byte, code byte) {
+	no := r.byte()
+	if !r.done() {
+		code = toyopuc.ExceptionCodeIllegalDataByteInCommandFormat
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if no < frFirstArea || no >= frFirstArea+frBlocks {
+		return nil, toyopuc.ExceptionCodeAddressNotInRange
+	}
+	if s.frBusy || s.status.UnderWritingFlashRegister {
+		return nil, toyopuc.ExceptionCodeConflictWithOtherCommand
+	}
+	block := uint32(no-frFirstArea) * frBlockWords
+	data := s.Memory.FR(block, frBlockWords)
+	s.frBusy = true
+	s.status.AbnormalWriteFlashRegister = false
+
+	fail, delay := s.frFail, s.frDelay
+	done := func() {
+		s.frBusy = false
+		s.status.UnderWritingFlashRegister = false
+		s.status.AbnormalWriteFlashRegister = fail
+		if fail {
+			return
+		}
+		if s.flash == nil {
+			s.flash = make(map[byte][]uint16)
+		}
+		s.flash[no] = data
+	}
+	start := func() {
+		s.status.UnderWritingFlashRegister = true
+		if delay <= 0 {
+			done()
+			return
+		}
+		time.AfterFunc(delay, func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			done()
+		})
+	}
+	if s.frStart <= 0 {
+		start()
+		return
+	}
+	time.AfterFunc(s.frStart, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		start()
+	})
+	return
+}
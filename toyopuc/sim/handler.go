@@ -0,0 +1,412 @@
+package sim
+
+import (
+	"encoding/binary"
+
+	"toyopuc/toyopuc"
+)
+
+// areaSize 区域的字数
+func areaSize(family toyopuc.Family, no byte) int {
+	if family == toyopuc.FamilyDataExpansion {
+		switch no {
+		case 0x00:
+			return 0x2000
+		case 0x07:
+			return 0x1000
+		case frFirstArea:
+			return frWords
+		}
+	}
+	return 0x8000
+}
+
+// Handle 处理一个请求，返回响应
+// 响应的 Response 为0时正常，否则为错误码
+func (s *Server) Handle(request *toyopuc.ProtocolDataUnit) (response *toyopuc.ProtocolDataUnit) {
+	data, code := s.handle(request.FunctionCode, request.Data)
+	response = &toyopuc.ProtocolDataUnit{FunctionCode: request.FunctionCode, Response: code}
+	if code == 0 {
+		response.Data = data
+	}
+	return
+}
+
+// handle 按功能码分发
+func (s *Server) handle(functionCode byte, data []byte) (results []byte, code byte) {
+	r := &reader{data: data}
+	switch functionCode {
+	case toyopuc.FunCommand:
+		return s.command(r)
+	case toyopuc.FunRelay:
+		return s.relay(r)
+	case toyopuc.FunRegisterFR:
+		return s.registerFR(r)
+	}
+	m := s.Memory
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch functionCode {
+	case toyopuc.FunSequentialProgramReadWord:
+		return m.readWords(toyopuc.FamilySequentialProgram, 0, r)
+	case toyopuc.FunSequentialProgramWriteWord:
+		return m.writeWords(toyopuc.FamilySequentialProgram, 0, r)
+	case toyopuc.FunIOReadWord:
+		return m.readWords(toyopuc.FamilyIO, 0, r)
+	case toyopuc.FunIOWriteWord:
+		return m.writeWords(toyopuc.FamilyIO, 0, r)
+	case toyopuc.FunIOReadByte:
+		return m.readBytes(toyopuc.FamilyIO, 0, r, 0x200)
+	case toyopuc.FunIOWriteByte:
+		return m.writeBytes(toyopuc.FamilyIO, 0, r, 0x200)
+	case toyopuc.FunIOReadBit:
+		return m.readBit(r)
+	case toyopuc.FunIOWriteBit:
+		return m.writeBit(r)
+	case toyopuc.FunIOReadMultipointWord, toyopuc.FunIOReadMultipointByte, toyopuc.FunIOReadMultipointBit:
+		return m.readIOMultipoint(functionCode, r)
+	case toyopuc.FunIOWriteMultipointWord, toyopuc.FunIOWriteMultipointByte, toyopuc.FunIOWriteMultipointBit:
+		return m.writeIOMultipoint(functionCode, r)
+	case toyopuc.FunProgramExpansionReadWord:
+		return m.readWords(toyopuc.FamilyProgramExpansion, r.byte(), r)
+	case toyopuc.FunProgramExpansionWriteWord:
+		return m.writeWords(toyopuc.FamilyProgramExpansion, r.byte(), r)
+	case toyopuc.FunDataExpansionReadWord:
+		return m.readWords(toyopuc.FamilyDataExpansion, r.byte(), r)
+	case toyopuc.FunDateExpansionWriteWord:
+		return m.writeWords(toyopuc.FamilyDataExpansion, r.byte(), r)
+	case toyopuc.FunDataExpansionReadByte:
+		return m.readBytes(toyopuc.FamilyDataExpansion, r.byte(), r, 0x400)
+	case toyopuc.FunDataExpansionWriteByte:
+		return m.writeBytes(toyopuc.FamilyDataExpansion, r.byte(), r, 0x400)
+	case toyopuc.FunDataExpansionReadMultipoint:
+		return m.readExpansionMultipoint(r)
+	case toyopuc.FunDataExpansionWriteMultipoint:
+		return m.writeExpansionMultipoint(r)
+	case toyopuc.FunPC10ReadBlock:
+		return m.readPC10Block(r)
+	case toyopuc.FunPC10WriteBlock:
+		return m.writePC10Block(r)
+	case toyopuc.FunPC10ReadMultipoint:
+		return m.readPC10Multipoint(r)
+	case toyopuc.FunPC10WriteMultipoint:
+		return m.writePC10Multipoint(r)
+	}
+	code = toyopuc.ExceptionCodeIllegalCommandCode
+	return
+}
+
+// area 校验区域并返回区域的字 调用方必须持有锁
+func (m *Memory) area(family toyopuc.Family, no byte) (w []uint16, code byte) {
+	if !validArea(family, no) {
+		code = toyopuc.ExceptionCodeAddressNotInRange
+		return
+	}
+	w = m.words(family, no)[:areaSize(family, no)]
+	return
+}
+
+// readWords 字读出 address + quantity
+func (m *Memory) readWords(family toyopuc.Family, no byte, r *reader) (results []byte, code byte) {
+	address, quantity := r.uint16(), r.uint16()
+	if !r.done() {
+		return nil, toyopuc.ExceptionCodeIllegalDataByteInCommandFormat
+	}
+	if quantity < 1 || quantity > 0x200 {
+		return nil, toyopuc.ExceptionCodeNumOutOfRange
+	}
+	w, code := m.area(family, no)
+	if code != 0 {
+		return
+	}
+	if int(address)+int(quantity) > len(w) {
+		return nil, toyopuc.ExceptionCodeAddressNotInRange
+	}
+	results = make([]byte, int(quantity)*2)
+	for k := 0; k < int(quantity); k++ {
+		binary.LittleEndian.PutUint16(results[k*2:], w[int(address)+k])
+	}
+	return
+}
+
+// writeWords 字写入 address + value
+func (m *Memory) writeWords(family toyopuc.Family, no byte, r *reader) (results []byte, code byte) {
+	address, value := r.uint16(), r.rest()
+	if r.failed || len(value) == 0 || len(value)%2 != 0 {
+		return nil, toyopuc.ExceptionCodeIllegalDataByteInCommandFormat
+	}
+	quantity := len(value) / 2
+	if quantity > 0x200 {
+		return nil, toyopuc.ExceptionCodeNumOutOfRange
+	}
+	w, code := m.area(family, no)
+	if code != 0 {
+		return
+	}
+	if int(address)+quantity > len(w) {
+		return nil, toyopuc.ExceptionCodeAddressNotInRange
+	}
+	for k := 0; k < quantity; k++ {
+		w[int(address)+k] = binary.LittleEndian.Uint16(value[k*2:])
+	}
+	return
+}
+
+// readBytes 字节读出 address + quantity
+func (m *Memory) readBytes(family toyopuc.Family, no byte, r *reader, max uint16) (results []byte, code byte) {
+	address, quantity := r.uint16(), r.uint16()
+	if !r.done() {
+		return nil, toyopuc.ExceptionCodeIllegalDataByteInCommandFormat
+	}
+	if quantity < 1 || quantity > max {
+		return nil, toyopuc.ExceptionCodeNumOutOfRange
+	}
+	w, code := m.area(family, no)
+	if code != 0 {
+		return
+	}
+	if int(address)+int(quantity) > len(w)*2 {
+		return nil, toyopuc.ExceptionCodeAddressNotInRange
+	}
+	results = make([]byte, quantity)
+	for k := range results {
+		results[k] = getByte(w, address+uint16(k))
+	}
+	return
+}
+
+// writeBytes 字节写入 address + value
+func (m *Memory) writeBytes(family toyopuc.Family, no byte, r *reader, max int) (results []byte, code byte) {
+	address, value := r.uint16(), r.rest()
+	if r.failed || len(value) == 0 {
+		return nil, toyopuc.ExceptionCodeIllegalDataByteInCommandFormat
+	}
+	if len(value) > max {
+		return nil, toyopuc.ExceptionCodeNumOutOfRange
+	}
+	w, code := m.area(family, no)
+	if code != 0 {
+		return
+	}
+	if int(address)+len(value) > len(w)*2 {
+		return nil, toyopuc.ExceptionCodeAddressNotInRange
+	}
+	for k, v := range value {
+		setByte(w, address+uint16(k), v)
+	}
+	return
+}
+
+// readBit 位读出 address
+func (m *Memory) readBit(r *reader) (results []byte, code byte) {
+	address := r.uint16()
+	if !r.done() {
+		return nil, toyopuc.ExceptionCodeIllegalDataByteInCommandFormat
+	}
+	w, _ := m.area(toyopuc.FamilyIO, 0)
+	return []byte{getBit(w, address)}, 0
+}
+
+// writeBit 位写入 address + value
+func (m *Memory) writeBit(r *reader) (results []byte, code byte) {
+	address, value := r.uint16(), r.byte()
+	if !r.done() {
+		return nil, toyopuc.ExceptionCodeIllegalDataByteInCommandFormat
+	}
+	w, _ := m.area(toyopuc.FamilyIO, 0)
+	setBit(w, address, value)
+	return
+}
+
+// readIOMultipoint I/O寄存器 多点读出 address...
+func (m *Memory) readIOMultipoint(functionCode byte, r *reader) (results []byte, code byte) {
+	if len(r.data) == 0 || len(r.data)%2 != 0 {
+		return nil, toyopuc.ExceptionCodeIllegalDataByteInCommandFormat
+	}
+	if len(r.data)/2 > 0x80 {
+		return nil, toyopuc.ExceptionCodeNumOutOfRange
+	}
+	w, _ := m.area(toyopuc.FamilyIO, 0)
+	for !r.done() {
+		address := r.uint16()
+		switch functionCode {
+		case toyopuc.FunIOReadMultipointWord:
+			if int(address) >= len(w) {
+				return nil, toyopuc.ExceptionCodeAddressNotInRange
+			}
+			results = append(results, byte(w[address]), byte(w[address]>>8))
+		case toyopuc.FunIOReadMultipointByte:
+			if int(address) >= len(w)*2 {
+				return nil, toyopuc.ExceptionCodeAddressNotInRange
+			}
+			results = append(results, getByte(w, address))
+		default:
+			results = append(results, getBit(w, address))
+		}
+	}
+	return
+}
+
+// writeIOMultipoint I/O寄存器 多点写入 (address + value)...
+func (m *Memory) writeIOMultipoint(functionCode byte, r *reader) (results []byte, code byte) {
+	size := 3
+	if functionCode == toyopuc.FunIOWriteMultipointWord {
+		size = 4
+	}
+	if len(r.data) == 0 || len(r.data)%size != 0 {
+		return nil, toyopuc.ExceptionCodeIllegalDataByteInCommandFormat
+	}
+	if len(r.data)/size > 0x80 {
+		return nil, toyopuc.ExceptionCodeNumOutOfRange
+	}
+	w, _ := m.area(toyopuc.FamilyIO, 0)
+	// 先校验全部地址 再写入
+	for p := 0; p < len(r.data); p += size {
+		address := int(binary.LittleEndian.Uint16(r.data[p:]))
+		if functionCode == toyopuc.FunIOWriteMultipointWord && address >= len(w) || functionCode == toyopuc.FunIOWriteMultipointByte && address >= len(w)*2 {
+			return nil, toyopuc.ExceptionCodeAddressNotInRange
+		}
+	}
+	for !r.done() {
+		address := r.uint16()
+		switch functionCode {
+		case toyopuc.FunIOWriteMultipointWord:
+			w[address] = r.uint16()
+		case toyopuc.FunIOWriteMultipointByte:
+			setByte(w, address, r.byte())
+		default:
+			setBit(w, address, r.byte())
+		}
+	}
+	return
+}
+
+// point 数据扩展 多点读写的一个点
+type point struct {
+	w       []uint16
+	address uint16
+}
+
+// expansionPoints 数据扩展 多点读写的点 numBit numByte numWord + (no + address [+ value])...
+// 写入时 values 为按顺序排列的全部值
+func (m *Memory) expansionPoints(r *reader, write bool) (bits, bytes, words []point, values []byte, code byte) {
+	numBit, numByte, numWord := int(r.byte()), int(r.byte()), int(r.byte())
+	if r.failed {
+		code = toyopuc.ExceptionCodeIllegalDataByteInCommandFormat
+		return
+	}
+	quantity := numBit + numByte + numWord
+	dataQuantity := (numBit+7)/8 + numByte + numWord*2
+	if quantity < 1 || quantity > 176 || dataQuantity > 128 {
+		code = toyopuc.ExceptionCodeNumOutOfRange
+		return
+	}
+	parse := func(n, valueSize, limit int) (points []point) {
+		for k := 0; k < n && code == 0; k++ {
+			no, address := r.byte(), r.uint16()
+			w, c := m.area(toyopuc.FamilyDataExpansion, no)
+			if c != 0 {
+				code = c
+				return
+			}
+			if int(address) >= len(w)*limit {
+				code = toyopuc.ExceptionCodeAddressNotInRange
+				return
+			}
+			points = append(points, point{w: w, address: address})
+			if write {
+				values = append(values, r.bytes(valueSize)...)
+			}
+		}
+		return
+	}
+	// 位地址 = 字地址*16 字节地址 = 字地址*2
+	bits = parse(numBit, 1, 16)
+	bytes = parse(numByte, 1, 2)
+	words = parse(numWord, 2, 1)
+	if code == 0 && !r.done() {
+		code = toyopuc.ExceptionCodeIllegalDataByteInCommandFormat
+	}
+	return
+}
+
+// readExpansionMultipoint 数据扩展 多点读出
+// 响应: 位 (每字节8位 低位在前) + 字节 + 字
+func (m *Memory) readExpansionMultipoint(r *reader) (results []byte, code byte) {
+	bits, bytes, words, _, code := m.expansionPoints(r, false)
+	if code != 0 {
+		return
+	}
+	results = make([]byte, (len(bits)+7)/8, (len(bits)+7)/8+len(bytes)+len(words)*2)
+	for k, p := range bits {
+		results[k/8] |= getBit(p.w, p.address) << (k % 8)
+	}
+	for _, p := range bytes {
+		results = append(results, getByte(p.w, p.address))
+	}
+	for _, p := range words {
+		results = append(results, byte(p.w[p.address]), byte(p.w[p.address]>>8))
+	}
+	return
+}
+
+// writeExpansionMultipoint 数据扩展 多点写入
+func (m *Memory) writeExpansionMultipoint(r *reader) (results []byte, code byte) {
+	bits, bytes, words, values, code := m.expansionPoints(r, true)
+	if code != 0 {
+		return
+	}
+	for _, p := range bits {
+		setBit(p.w, p.address, values[0])
+		values = values[1:]
+	}
+	for _, p := range bytes {
+		setByte(p.w, p.address, values[0])
+		values = values[1:]
+	}
+	for _, p := range words {
+		p.w[p.address] = binary.LittleEndian.Uint16(values)
+		values = values[2:]
+	}
+	return
+}
+
+// reader 顺序读取请求数据
+// 长度不足时 failed 置位，之后返回0
+type reader struct {
+	data   []byte
+	pos    int
+	failed bool
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.pos+n > len(r.data) {
+		r.failed = true
+		r.pos = len(r.data)
+		return make([]byte, n)
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *reader) byte() byte {
+	return r.bytes(1)[0]
+}
+
+func (r *reader) uint16() uint16 {
+	return binary.LittleEndian.Uint16(r.bytes(2))
+}
+
+// rest 剩余的全部数据
+func (r *reader) rest() []byte {
+	b := r.data[r.pos:]
+	r.pos = len(r.data)
+	return b
+}
+
+// done 数据恰好读完
+func (r *reader) done() bool {
+	return !r.failed && r.pos == len(r.data)
+}
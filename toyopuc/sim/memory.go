@@ -0,0 +1,141 @@
+package sim
+
+import (
+	"sync"
+
+	"toyopuc/toyopuc"
+)
+
+// 每个区域的字数 覆盖16位字地址
+const areaWords = 0x10000
+
+// PC10 文件寄存器 FR
+// 按 PC10 手册独立定义，不引用客户端的常量
+const (
+	// FR 的字数
+	frWords = 0x200000
+	// 第一块的区域号
+	frFirstArea = 0x40
+	// 每块 (区域) 的字数
+	frBlockWords = 0x8000
+	// 块数 区域号 0x40 - 0x7F
+	frBlocks = frWords / frBlockWords
+)
+
+// area 区域 指令族 + 程序号/区域号
+type area struct {
+	family toyopuc.Family
+	no     byte
+}
+
+// Memory 内存设备模型
+// 基本I/O寄存器、顺序程序、程序扩展 PRG1 - PRG3、数据扩展区域 各自独立
+type Memory struct {
+	mu    sync.Mutex
+	areas map[area][]uint16
+}
+
+// NewMemory 创建全部为0的内存
+func NewMemory() *Memory {
+	return &Memory{areas: make(map[area][]uint16)}
+}
+
+// validArea 区域是否存在
+//  程序扩展 no 01 - 03
+//  数据扩展 no 00 扩展区域 01 - 03 PRG1 - PRG3 07 GX/GY 08 - 0B U
+func validArea(family toyopuc.Family, no byte) bool {
+	switch family {
+	case toyopuc.FamilyIO, toyopuc.FamilySequentialProgram:
+		return no == 0
+	case toyopuc.FamilyProgramExpansion:
+		return no >= 1 && no <= 3
+	case toyopuc.FamilyDataExpansion:
+		return no <= 3 || no == 7 || (no >= 8 && no <= 0x0B)
+	}
+	return false
+}
+
+// words 区域的字 调用方必须持有锁
+func (m *Memory) words(family toyopuc.Family, no byte) []uint16 {
+	key := area{family: family, no: no}
+	w, ok := m.areas[key]
+	if !ok {
+		n := areaWords
+		if size := areaSize(family, no); size > n {
+			n = size
+		}
+		w = make([]uint16, n)
+		m.areas[key] = w
+	}
+	return w
+}
+
+// Words 读出字
+func (m *Memory) Words(family toyopuc.Family, no byte, address uint16, quantity int) []uint16 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	values := make([]uint16, quantity)
+	copy(values, m.words(family, no)[address:])
+	return values
+}
+
+// SetWords 写入字
+func (m *Memory) SetWords(family toyopuc.Family, no byte, address uint16, value []uint16) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	copy(m.words(family, no)[address:], value)
+}
+
+// Get 按设备地址读出字 如 D0100 P2-D0100 U08000
+func (m *Memory) Get(address string, quantity int) (values []uint16, err error) {
+	a, err := toyopuc.ParseAddress(address)
+	if err != nil {
+		return
+	}
+	values = m.Words(a.Family, a.No, a.Word, quantity)
+	return
+}
+
+// Set 按设备地址写入字
+func (m *Memory) Set(address string, value ...uint16) (err error) {
+	a, err := toyopuc.ParseAddress(address)
+	if err != nil {
+		return
+	}
+	m.SetWords(a.Family, a.No, a.Word, value)
+	return
+}
+
+// getByte 字节 低位字节在前 调用方必须持有锁
+func getByte(w []uint16, address uint16) byte {
+	if address%2 == 1 {
+		return byte(w[address/2] >> 8)
+	}
+	return byte(w[address/2])
+}
+
+// setByte 调用方必须持有锁
+func setByte(w []uint16, address uint16, value byte) {
+	p := &w[address/2]
+	if address%2 == 1 {
+		*p = *p&0x00FF | uint16(value)<<8
+	} else {
+		*p = *p&0xFF00 | uint16(value)
+	}
+}
+
+// getBit 位 位地址/16 为字地址 调用方必须持有锁
+func getBit(w []uint16, address uint16) byte {
+	return byte(w[address/16]>>(address%16)) & 1
+}
+
+// setBit 调用方必须持有锁
+func setBit(w []uint16, address uint16, value byte) {
+	if value != 0 {
+		w[address/16] |= 1 << (address % 16)
+	} else {
+		w[address/16] &^= 1 << (address % 16)
+	}
+}
@@ -0,0 +1,165 @@
+package sim
+
+import (
+	"encoding/binary"
+
+	"toyopuc/toyopuc"
+)
+
+// pc10Area PC10 32位地址的区域 调用方必须持有锁
+// 区域号 00 - 0B 与数据扩展相同，40 - 7F 为文件寄存器 FR 的块 (每块 0x8000 字)
+func (m *Memory) pc10Area(address uint32) (w []uint16, offset uint32, code byte) {
+	no := byte(address >> 24)
+	offset = address & 0xFFFFFF
+	if no >= frFirstArea && no < frFirstArea+frBlocks {
+		block := int(no-frFirstArea) * frBlockWords
+		w = m.words(toyopuc.FamilyDataExpansion, frFirstArea)[block : block+frBlockWords]
+		return
+	}
+	w, code = m.area(toyopuc.FamilyDataExpansion, no)
+	return
+}
+
+// uint32 4字节地址
+func (r *reader) uint32() uint32 {
+	return binary.LittleEndian.Uint32(r.bytes(4))
+}
+
+// readPC10Block PC10 块读出 address (4 bytes) + quantity 字节单位
+func (m *Memory) readPC10Block(r *reader) (results []byte, code byte) {
+	address, quantity := r.uint32(), r.uint16()
+	if !r.done() {
+		return nil, toyopuc.ExceptionCodeIllegalDataByteInCommandFormat
+	}
+	if quantity < 1 || quantity > 0x400 {
+		return nil, toyopuc.ExceptionCodeNumOutOfRange
+	}
+	w, offset, code := m.pc10Area(address)
+	if code != 0 {
+		return
+	}
+	if int(offset)+int(quantity) > len(w)*2 {
+		return nil, toyopuc.ExceptionCodeAddressNotInRange
+	}
+	results = make([]byte, quantity)
+	for k := range results {
+		a := offset + uint32(k)
+		results[k] = getByte(w[a/2:], uint16(a%2))
+	}
+	return
+}
+
+// writePC10Block PC10 块写入 address (4 bytes) + value
+func (m *Memory) writePC10Block(r *reader) (results []byte, code byte) {
+	address, value := r.uint32(), r.rest()
+	if r.failed || len(value) == 0 {
+		return nil, toyopuc.ExceptionCodeIllegalDataByteInCommandFormat
+	}
+	if len(value) > 0x400 {
+		return nil, toyopuc.ExceptionCodeNumOutOfRange
+	}
+	w, offset, code := m.pc10Area(address)
+	if code != 0 {
+		return
+	}
+	if int(offset)+len(value) > len(w)*2 {
+		return nil, toyopuc.ExceptionCodeAddressNotInRange
+	}
+	for k, v := range value {
+		a := offset + uint32(k)
+		setByte(w[a/2:], uint16(a%2), v)
+	}
+	return
+}
+
+// pc10Point PC10 多点读写的一点 已按单位换算为 w 中的位置
+type pc10Point struct {
+	w []uint16
+	// 位: 字地址 字节: 字节所在的字
+	word uint32
+	// 位号 或 字节 (0 低位 1 高位)
+	sub uint16
+}
+
+// pc10Points 解析 PC10 多点读写的点数与地址
+// 位为位地址，字节、字为字节地址 (字必须为偶数)
+func (m *Memory) pc10Points(r *reader, write bool) (bits, bytes, words []pc10Point, values []byte, code byte) {
+	numBit, numByte, numWord := int(r.byte()), int(r.byte()), int(r.byte())
+	if r.failed {
+		code = toyopuc.ExceptionCodeIllegalDataByteInCommandFormat
+		return
+	}
+	quantity := numBit + numByte + numWord
+	dataQuantity := (numBit+7)/8 + numByte + numWord*2
+	if quantity < 1 || quantity > toyopuc.PC10MaxPoints || dataQuantity > toyopuc.PC10MaxData {
+		code = toyopuc.ExceptionCodeNumOutOfRange
+		return
+	}
+	parse := func(n, valueSize int, unit uint32) (points []pc10Point) {
+		for k := 0; k < n && code == 0; k++ {
+			w, offset, c := m.pc10Area(r.uint32())
+			if c != 0 {
+				code = c
+				return
+			}
+			// unit: 每字的位数或字节数
+			if offset >= uint32(len(w))*unit || (valueSize == 2 && offset%2 != 0) {
+				code = toyopuc.ExceptionCodeAddressNotInRange
+				return
+			}
+			points = append(points, pc10Point{w: w, word: offset / unit, sub: uint16(offset % unit)})
+			if write {
+				values = append(values, r.bytes(valueSize)...)
+			}
+		}
+		return
+	}
+	bits = parse(numBit, 1, 16)
+	bytes = parse(numByte, 1, 2)
+	words = parse(numWord, 2, 2)
+	if code == 0 && !r.done() {
+		code = toyopuc.ExceptionCodeIllegalDataByteInCommandFormat
+	}
+	return
+}
+
+// readPC10Multipoint PC10 多点读出
+// 响应: 位 (每字节8位 低位在前) + 字节 + 字
+func (m *Memory) readPC10Multipoint(r *reader) (results []byte, code byte) {
+	bits, bytes, words, _, code := m.pc10Points(r, false)
+	if code != 0 {
+		return
+	}
+	results = make([]byte, (len(bits)+7)/8, (len(bits)+7)/8+len(bytes)+len(words)*2)
+	for k, p := range bits {
+		results[k/8] |= getBit(p.w[p.word:], p.sub) << (k % 8)
+	}
+	for _, p := range bytes {
+		results = append(results, getByte(p.w[p.word:], p.sub))
+	}
+	for _, p := range words {
+		results = append(results, byte(p.w[p.word]), byte(p.w[p.word]>>8))
+	}
+	return
+}
+
+// writePC10Multipoint PC10 多点写入
+func (m *Memory) writePC10Multipoint(r *reader) (results []byte, code byte) {
+	bits, bytes, words, values, code := m.pc10Points(r, true)
+	if code != 0 {
+		return
+	}
+	for _, p := range bits {
+		setBit(p.w[p.word:], p.sub, values[0])
+		values = values[1:]
+	}
+	for _, p := range bytes {
+		setByte(p.w[p.word:], p.sub, values[0])
+		values = values[1:]
+	}
+	for _, p := range words {
+		p.w[p.word] = binary.LittleEndian.Uint16(values)
+		values = values[2:]
+	}
+	return
+}
@@ -0,0 +1,259 @@
+package sim
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"toyopuc/toyopuc"
+)
+
+// newPoolTestClient 启动模拟服务器并返回连接池客户端
+func newPoolTestClient(t *testing.T, size int) (*Server, *toyopuc.TCPPoolHandler, toyopuc.Client) {
+	t.Helper()
+	s := NewServer()
+	if err := s.Start("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	handler := toyopuc.NewTCPPoolHandler(s.Addr().String(), size)
+	handler.ReconnectBackoff = 0
+	t.Cleanup(func() {
+		handler.Close()
+		s.Close()
+	})
+	return s, handler, toyopuc.NewClient(handler)
+}
+
+// startSlowRead 在另一个 goroutine 中读取 等待请求被服务器接收
+func startSlowRead(t *testing.T, s *Server, client toyopuc.Client, delay time.Duration) <-chan error {
+	s.AddFault(Fault{Kind: FaultDelay, Delay: delay, Count: 1})
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.Read("D0100", 1)
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	return done
+}
+
+func TestPoolMaxWaiters(t *testing.T) {
+	s, handler, client := newPoolTestClient(t, 1)
+	handler.MaxWaiters = 1
+	slow := startSlowRead(t, s, client, 300*time.Millisecond)
+
+	waiting := make(chan error, 1)
+	go func() {
+		_, err := client.Read("D0200", 1)
+		waiting <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+	_, err := client.Read("D0300", 1)
+	if err == nil || !strings.Contains(err.Error(), "too many requests") {
+		t.Fatalf("error = %v, want too many requests", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("rejected after %v", elapsed)
+	}
+	if err = <-slow; err != nil {
+		t.Fatalf("slow request: %v", err)
+	}
+	if err = <-waiting; err != nil {
+		t.Fatalf("waiting request: %v", err)
+	}
+}
+
+func TestPoolMaxWait(t *testing.T) {
+	s, handler, client := newPoolTestClient(t, 1)
+	handler.MaxWait = 50 * time.Millisecond
+	slow := startSlowRead(t, s, client, 300*time.Millisecond)
+
+	start := time.Now()
+	_, err := client.Read("D0200", 1)
+	if !errors.Is(err, toyopuc.ErrTimeout) || !toyopuc.IsRetriable(err) {
+		t.Fatalf("error = %v, want retriable %v", err, toyopuc.ErrTimeout)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > 200*time.Millisecond {
+		t.Errorf("gave up after %v, want %v", elapsed, handler.MaxWait)
+	}
+	if err = <-slow; err != nil {
+		t.Fatalf("slow request: %v", err)
+	}
+}
+
+func TestPoolBrokenConnection(t *testing.T) {
+	s, handler, client := newPoolTestClient(t, 1)
+	var mu sync.Mutex
+	var states []toyopuc.ConnState
+	handler.OnStateChange = func(state toyopuc.ConnState, err error) {
+		mu.Lock()
+		states = append(states, state)
+		mu.Unlock()
+	}
+	if err := s.Memory.Set("D0100", 0x1234); err != nil {
+		t.Fatal(err)
+	}
+	s.AddFault(Fault{Kind: FaultDrop, Count: 1})
+	if _, err := client.Read("D0100", 1); err == nil {
+		t.Fatal("Read over dropped connection succeeded")
+	}
+	// 断开的连接放回连接池 下次使用时重新连接
+	got, err := client.Read("D0100", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, []byte{0x34, 0x12}) {
+		t.Errorf("Read(D0100) = % x, want % x", got, []byte{0x34, 0x12})
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	want := fmt.Sprint([]toyopuc.ConnState{toyopuc.ConnConnected, toyopuc.ConnLost, toyopuc.ConnConnected})
+	if fmt.Sprint(states) != want {
+		t.Errorf("states = %v, want %v", states, want)
+	}
+}
+
+func TestPoolStateChangeCallbackSends(t *testing.T) {
+	s, handler, client := newPoolTestClient(t, 1)
+	// 只有一个连接 回调时连接必须已放回连接池
+	callback, done := readOnConnect(t, s, client)
+	handler.OnStateChange = callback
+	waitCallback(t, client, done)
+}
+
+// startDuplicateServer 每个响应发送两次的服务器 第二次相当于迟到的响应
+func startDuplicateServer(t *testing.T, s *Server) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					request, err := readFrame(conn)
+					if err != nil {
+						return
+					}
+					response := encodeFrame(s.Handle(&toyopuc.ProtocolDataUnit{FunctionCode: request[headerSize], Data: request[headerSize+1:]}))
+					if _, err = conn.Write(response); err != nil {
+						return
+					}
+					time.Sleep(10 * time.Millisecond)
+					if _, err = conn.Write(response); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestPoolHealthCheck(t *testing.T) {
+	s := NewServer()
+	handler := toyopuc.NewTCPPoolHandler(startDuplicateServer(t, s), 1)
+	handler.ReconnectBackoff = 0
+	handler.HealthCheckInterval = time.Millisecond
+	var states []toyopuc.ConnState
+	handler.OnStateChange = func(state toyopuc.ConnState, err error) {
+		states = append(states, state)
+	}
+	defer handler.Close()
+	client := toyopuc.NewClient(handler)
+
+	for _, value := range []uint16{0x1111, 0x2222} {
+		if err := s.Memory.Set("D0100", value); err != nil {
+			t.Fatal(err)
+		}
+		got, err := client.Read("D0100", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 检查读到多余的响应时关闭连接 不会当作下一个请求的响应
+		if want := []byte{byte(value), byte(value >> 8)}; !bytes.Equal(got, want) {
+			t.Errorf("Read(D0100) = % x, want % x", got, want)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	want := fmt.Sprint([]toyopuc.ConnState{toyopuc.ConnConnected, toyopuc.ConnLost, toyopuc.ConnConnected})
+	if fmt.Sprint(states) != want {
+		t.Errorf("states = %v, want %v", states, want)
+	}
+}
+
+func TestPoolHealthCheckAfterTimeout(t *testing.T) {
+	s, handler, client := newPoolTestClient(t, 1)
+	handler.Timeout = 100 * time.Millisecond
+	handler.HealthCheckInterval = time.Millisecond
+	if err := s.Memory.Set("D0100", 0x1234, 0x5678); err != nil {
+		t.Fatal(err)
+	}
+	s.AddFault(Fault{Kind: FaultDelay, Delay: 200 * time.Millisecond, Count: 1})
+	if _, err := client.Read("D0100", 1); err == nil {
+		t.Fatal("Read of delayed response succeeded")
+	}
+	// 超时的连接已关闭 迟到的响应不会被检查或下一个请求读到
+	time.Sleep(200 * time.Millisecond)
+	got, err := client.Read("D0101", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, []byte{0x78, 0x56}) {
+		t.Errorf("Read(D0101) = % x, want % x", got, []byte{0x78, 0x56})
+	}
+}
+
+func TestPoolConcurrent(t *testing.T) {
+	s, handler, client := newPoolTestClient(t, 4)
+	handler.Timeout = time.Second
+	const workers, reads = 16, 20
+	for k := 0; k < workers; k++ {
+		if err := s.Memory.Set(fmt.Sprintf("D%04X", 0x100+k), uint16(0x1000+k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.AddFault(Fault{Kind: FaultDrop, Count: 2})
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var failed int
+	for k := 0; k < workers; k++ {
+		wg.Add(1)
+		go func(k int) {
+			defer wg.Done()
+			address := fmt.Sprintf("D%04X", 0x100+k)
+			want := []byte{byte(k), 0x10}
+			for i := 0; i < reads; i++ {
+				got, err := client.Read(address, 1)
+				if err != nil {
+					mu.Lock()
+					failed++
+					mu.Unlock()
+					continue
+				}
+				// 响应不能与其他请求错位
+				if !bytes.Equal(got, want) {
+					t.Errorf("Read(%v) = % x, want % x", address, got, want)
+				}
+			}
+		}(k)
+	}
+	wg.Wait()
+	if failed != 2 {
+		t.Errorf("%v requests failed, want %v dropped", failed, 2)
+	}
+}
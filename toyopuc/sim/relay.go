@@ -0,0 +1,73 @@
+package sim
+
+import (
+	"encoding/binary"
+
+	"toyopuc/toyopuc"
+)
+
+// station 中继的目标 链接号 + 站号
+type station struct {
+	link byte
+	no   uint16
+}
+
+// AddStation 添加经由链接号 link 可以到达的站 中继命令 (0x60) 的内部帧由 target 处理
+// target 可以是 s 本身或另一个 Server，多级中继时在 target 上继续添加
+func (s *Server) AddStation(link byte, no uint16, target *Server) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stations == nil {
+		s.stations = make(map[station]*Server)
+	}
+	s.stations[station{link: link, no: no}] = target
+}
+
+// SetHeaderOnlyErrors 作为中继的目标时 错误响应的内部帧只有头 (FT RC LL LH) 没有 CMD
+func (s *Server) SetHeaderOnlyErrors(headerOnly bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.headerOnlyErrors = headerOnly
+}
+
+// relay 中继命令 link + station + 内部帧
+// 没有该链接号时返回 0x70，没有该站时返回 0x66
+func (s *Server) relay(r *reader) (results []byte, code byte) {
+	link, no := r.byte(), r.uint16()
+	frame := r.rest()
+	if r.failed || len(frame) < headerSize+1 || frame[0] != toyopuc.RequestFTByte ||
+		int(binary.LittleEndian.Uint16(frame[2:])) != len(frame)-headerSize {
+		code = toyopuc.ExceptionCodeIllegalDataByteInCommandFormat
+		return
+	}
+	s.mu.Lock()
+	target := s.stations[station{link: link, no: no}]
+	linked := false
+	for k := range s.stations {
+		linked = linked || k.link == link
+	}
+	s.mu.Unlock()
+	switch {
+	case !linked:
+		code = toyopuc.ExceptionCodeCommandNotUsed
+		return
+	case target == nil:
+		code = toyopuc.ExceptionCodeNoAnswer
+		return
+	}
+	pdu := &toyopuc.ProtocolDataUnit{FunctionCode: frame[headerSize], Data: frame[headerSize+1:]}
+	response := encodeFrame(target.Handle(pdu))
+	target.mu.Lock()
+	headerOnly := target.headerOnlyErrors
+	target.mu.Unlock()
+	// 只有头的错误响应 LL LH 为0
+	if headerOnly && response[1] != 0 {
+		response = response[:headerSize]
+		binary.LittleEndian.PutUint16(response[2:], 0)
+	}
+	results = make([]byte, 3, 3+len(response))
+	results[0] = link
+	binary.LittleEndian.PutUint16(results[1:], no)
+	results = append(results, response...)
+	return
+}
@@ -0,0 +1,67 @@
+package sim
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"toyopuc/toyopuc"
+)
+
+func TestRelay(t *testing.T) {
+	gateway := NewServer()
+	if err := gateway.Start("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	handler := toyopuc.NewTCPClientHandler(gateway.Addr().String())
+	defer func() {
+		handler.Close()
+		gateway.Close()
+	}()
+	// gateway -link 1 station 2-> middle -link 3 station 4-> target
+	middle, target := NewServer(), NewServer()
+	gateway.AddStation(1, 2, middle)
+	middle.AddStation(3, 4, target)
+	hops := []toyopuc.RelayHop{{Link: 1, Station: 2}, {Link: 3, Station: 4}}
+
+	tests := []struct {
+		name       string
+		hops       []toyopuc.RelayHop
+		headerOnly bool
+		// 数据扩展的区域号 05 不存在
+		no   byte
+		want error
+	}{
+		{name: "read", hops: hops, no: 1},
+		{name: "no link", hops: []toyopuc.RelayHop{{Link: 9, Station: 2}}, no: 1, want: &toyopuc.ExceptionError{FunctionCode: toyopuc.FunRelay, ExceptionCode: toyopuc.ExceptionCodeCommandNotUsed}},
+		{name: "no station", hops: []toyopuc.RelayHop{{Link: 1, Station: 2}, {Link: 3, Station: 5}}, no: 1, want: toyopuc.ErrNoAnswer},
+		{name: "target error", hops: hops, no: 5, want: toyopuc.ErrAddressNotInRange},
+		{name: "header only target error", hops: hops, headerOnly: true, no: 5, want: toyopuc.ErrAddressNotInRange},
+	}
+	if err := target.Memory.Set("P1-D0100", 0x1234); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target.SetHeaderOnlyErrors(tt.headerOnly)
+			client := toyopuc.RelayClient(handler, tt.hops...)
+			got, err := client.ReadDataExpansionWord(tt.no, 0x1100, 1)
+			if tt.want != nil {
+				if !errors.Is(err, tt.want) {
+					t.Fatalf("error = %v, want %v", err, tt.want)
+				}
+				var e *toyopuc.ExceptionError
+				if !errors.As(err, &e) {
+					t.Fatalf("error %v is not an *ExceptionError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, []byte{0x34, 0x12}) {
+				t.Errorf("read = % x, want % x", got, []byte{0x34, 0x12})
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package sim
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"toyopuc/toyopuc"
+)
+
+func TestRetryTimeout(t *testing.T) {
+	s := NewServer()
+	if err := s.Start("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	handler := toyopuc.NewTCPClientHandler(s.Addr().String())
+	handler.Timeout = 100 * time.Millisecond
+	handler.ReconnectBackoff = 0
+	t.Cleanup(func() {
+		handler.Close()
+		s.Close()
+	})
+	client := toyopuc.NewClient(handler).WithRetryPolicy(&toyopuc.BackoffRetry{MaxAttempts: 3, Backoff: 10 * time.Millisecond})
+	if err := s.Memory.Set("D0100", 0x1234); err != nil {
+		t.Fatal(err)
+	}
+
+	// 读取超时一次后重试成功
+	s.AddFault(Fault{Kind: FaultTimeout, Count: 1})
+	got, err := client.Read("D0100", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, []byte{0x34, 0x12}) {
+		t.Errorf("Read(D0100) = % x, want % x", got, []byte{0x34, 0x12})
+	}
+
+	// 写入超时不重试 超时的写入在模拟服务器中未执行
+	s.AddFault(Fault{Kind: FaultTimeout, Count: 1})
+	if err = client.Write("D0100", []byte{0x78, 0x56}); !errors.Is(err, toyopuc.ErrTimeout) {
+		t.Fatalf("Write error = %v, want %v", err, toyopuc.ErrTimeout)
+	}
+	words, err := s.Memory.Get("D0100", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if words[0] != 0x1234 {
+		t.Errorf("D0100 = %04x after a timed out write, want %04x", words[0], 0x1234)
+	}
+}
@@ -0,0 +1,327 @@
+/*
+Package sim provides an in-process TOYOPUC computer-link simulator.
+
+The server speaks the same frame format as the toyopuc TCP client and
+backs every function code onto an in-memory device model, so that the
+client can be tested end to end without hardware.
+*/
+package sim
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"toyopuc/toyopuc"
+)
+
+const (
+	// FT RC LL LH
+	headerSize = 0x04
+	// 请求帧的最大长度
+	maxLength = 0x800
+)
+
+// Server TOYOPUC 计算机链接模拟服务器
+type Server struct {
+	// 内存设备模型
+	Memory *Memory
+	// Transmission logger
+	Logger *log.Logger
+
+	mu       sync.Mutex
+	listener net.Listener
+	packet   net.PacketConn
+	conns    map[net.Conn]struct{}
+	wg       sync.WaitGroup
+	closed   bool
+	// 故障规则
+	faults []*Fault
+	// CPU 状态
+	status toyopuc.CPUStatus
+	// 时钟与本机时间的偏差
+	clock time.Duration
+	// 中继命令可以到达的站
+	stations map[station]*Server
+	// 作为中继目标时错误响应只有头
+	headerOnlyErrors bool
+	// FR 登录 见 SetFRRegistration
+	frDelay time.Duration
+	frFail  bool
+	// 开始写入前的延迟 见 SetFRStartDelay
+	frStart time.Duration
+	// 登录已受理 尚未结束
+	frBusy bool
+	// 已登录 (写入闪存) 的 FR 块
+	flash map[byte][]uint16
+}
+
+// NewServer allocates a new Server with empty memory.
+// CPU 为运行中的 PC10 模式
+func NewServer() *Server {
+	return &Server{
+		Memory: NewMemory(),
+		conns:  make(map[net.Conn]struct{}),
+		status: toyopuc.CPUStatus{Run: true, PC10Mode: true},
+	}
+}
+
+// Start listens on the address and serves in background.
+// 地址为 127.0.0.1:0 时使用 Addr 取得实际端口
+func (s *Server) Start(address string) (err error) {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	s.listener = l
+	s.mu.Unlock()
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.Serve(l)
+	}()
+	return
+}
+
+// ListenAndServe listens on the address and serves until Close.
+func (s *Server) ListenAndServe(address string) error {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on the listener until Close.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return fmt.Errorf("sim: server closed")
+	}
+	s.listener = l
+	s.mu.Unlock()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(conn)
+		}()
+	}
+}
+
+// Addr returns the listener address.
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// StartUDP listens on the UDP address and serves in background.
+// 地址为 127.0.0.1:0 时使用 PacketAddr 取得实际端口
+func (s *Server) StartUDP(address string) (err error) {
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	s.packet = conn
+	s.mu.Unlock()
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.ServePacket(conn)
+	}()
+	return
+}
+
+// ServePacket 处理数据报请求直到 Close
+// 每个数据报为一个完整的帧，响应发回请求的来源地址
+func (s *Server) ServePacket(conn net.PacketConn) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		conn.Close()
+		return fmt.Errorf("sim: server closed")
+	}
+	s.packet = conn
+	s.mu.Unlock()
+	buf := make([]byte, headerSize+maxLength)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		request := buf[:n]
+		if n <= headerSize || request[0] != toyopuc.RequestFTByte || int(binary.LittleEndian.Uint16(request[2:])) != n-headerSize {
+			s.logf("sim: discarding datagram % x from '%v'", request, addr)
+			continue
+		}
+		s.logf("sim: received % x", request)
+		pdu := &toyopuc.ProtocolDataUnit{FunctionCode: request[headerSize]}
+		if n > headerSize+1 {
+			pdu.Data = append([]byte(nil), request[headerSize+1:]...)
+		}
+		write := func(b []byte) error {
+			s.logf("sim: sending % x", b)
+			_, err := conn.WriteTo(b, addr)
+			return err
+		}
+		if f := s.matchFault(pdu); f != nil {
+			s.logf("sim: injecting %v fault", f.Kind)
+			// 数据报丢失
+			if f.Kind != FaultDrop && f.Kind != FaultTimeout {
+				f.respond(s, write, pdu)
+			}
+			continue
+		}
+		write(encodeFrame(s.Handle(pdu)))
+	}
+}
+
+// PacketAddr returns the UDP address.
+func (s *Server) PacketAddr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.packet == nil {
+		return nil
+	}
+	return s.packet.LocalAddr()
+}
+
+// Close stops the listener and closes all connections.
+func (s *Server) Close() (err error) {
+	s.mu.Lock()
+	s.closed = true
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	if s.packet != nil {
+		s.packet.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return
+}
+
+// serveConn 处理一个连接上的全部请求
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+	for {
+		request, err := readFrame(conn)
+		if err != nil {
+			if err != io.EOF {
+				s.logf("sim: %v", err)
+			}
+			return
+		}
+		s.logf("sim: received % x", request)
+		pdu := &toyopuc.ProtocolDataUnit{FunctionCode: request[headerSize]}
+		if len(request) > headerSize+1 {
+			pdu.Data = request[headerSize+1:]
+		}
+		if f := s.matchFault(pdu); f != nil {
+			s.logf("sim: injecting %v fault", f.Kind)
+			write := func(b []byte) error {
+				s.logf("sim: sending % x", b)
+				_, err := conn.Write(b)
+				return err
+			}
+			if !f.respond(s, write, pdu) {
+				return
+			}
+			continue
+		}
+		response := encodeFrame(s.Handle(pdu))
+		s.logf("sim: sending % x", response)
+		if _, err = conn.Write(response); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) logf(format string, v ...interface{}) {
+	if s.Logger != nil {
+		s.Logger.Printf(format, v...)
+	}
+}
+
+// readFrame 读取一个请求帧
+//  FT: 1 bytes 0x00
+//  RC: 1 bytes 0x00
+//  LL LH: 2 bytes 数据长度 (CMD + Data)
+//  CMD: 1 byte
+//  Data: n bytes
+func readFrame(r io.Reader) (frame []byte, err error) {
+	header := make([]byte, headerSize)
+	if _, err = io.ReadFull(r, header); err != nil {
+		return
+	}
+	if header[0] != toyopuc.RequestFTByte {
+		err = fmt.Errorf("sim: FT '%#x' error", header[0])
+		return
+	}
+	length := int(binary.LittleEndian.Uint16(header[2:]))
+	if length < 1 || length > maxLength {
+		err = fmt.Errorf("sim: length '%v' must be between '%v' and '%v'", length, 1, maxLength)
+		return
+	}
+	frame = make([]byte, headerSize+length)
+	copy(frame, header)
+	_, err = io.ReadFull(r, frame[headerSize:])
+	return
+}
+
+// encodeFrame 组装响应帧
+//  FT: 1 bytes 0x80
+//  RC: 1 bytes 0x00 正常，其他为错误码
+//  LL LH: 2 bytes 数据长度 (CMD + Data)
+//  CMD: 1 byte
+//  Data: n bytes
+func encodeFrame(pdu *toyopuc.ProtocolDataUnit) []byte {
+	frame := make([]byte, headerSize+1+len(pdu.Data))
+	frame[0] = toyopuc.ResponseFTByte
+	frame[1] = pdu.Response
+	binary.LittleEndian.PutUint16(frame[2:], uint16(len(pdu.Data)+1))
+	frame[headerSize] = pdu.FunctionCode
+	copy(frame[headerSize+1:], pdu.Data)
+	return frame
+}
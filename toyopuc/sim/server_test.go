@@ -0,0 +1,516 @@
+package sim
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"toyopuc/toyopuc"
+)
+
+// newTestClient 启动模拟服务器并返回连接到它的客户端
+func newTestClient(t *testing.T) (*Server, toyopuc.Client) {
+	t.Helper()
+	s := NewServer()
+	if err := s.Start("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	handler := toyopuc.NewTCPClientHandler(s.Addr().String())
+	t.Cleanup(func() {
+		handler.Close()
+		s.Close()
+	})
+	return s, toyopuc.NewClient(handler)
+}
+
+func TestReadWrite(t *testing.T) {
+	s, client := newTestClient(t)
+	tests := []struct {
+		address string
+		value   []byte
+		// 写入后按字读出内存的地址与期望值
+		word string
+		want []uint16
+	}{
+		{address: "D0100", value: []byte{0x34, 0x12, 0x78, 0x56}, word: "D0100", want: []uint16{0x1234, 0x5678}},
+		{address: "D0200H", value: []byte{0xAB}, word: "D0200", want: []uint16{0xAB00}},
+		{address: "D0300.3", value: []byte{1, 0, 1}, word: "D0300", want: []uint16{0x0028}},
+		{address: "M0013", value: []byte{1, 1}, word: "M001W", want: []uint16{0x0018}},
+		{address: "P2-D0100", value: []byte{0x01, 0x00}, word: "P2-D0100", want: []uint16{0x0001}},
+		{address: "EX0010", value: []byte{1}, word: "EX001W", want: []uint16{0x0001}},
+		{address: "ES0000L", value: []byte{0x5A}, word: "ES0000", want: []uint16{0x005A}},
+		{address: "U08000", value: []byte{0xEF, 0xBE}, word: "U08000", want: []uint16{0xBEEF}},
+		{address: "PRG0010", value: []byte{0x02, 0x01}, word: "PRG0010", want: []uint16{0x0102}},
+		{address: "P1-PRG0010", value: []byte{0x04, 0x03}, word: "P1-PRG0010", want: []uint16{0x0304}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			if err := client.Write(tt.address, tt.value); err != nil {
+				t.Fatal(err)
+			}
+			// 字访问的数量为字数
+			quantity := len(tt.value)
+			if a, _ := toyopuc.ParseAddress(tt.address); a.Unit == toyopuc.UnitWord {
+				quantity /= 2
+			}
+			got, err := client.Read(tt.address, uint16(quantity))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.value) {
+				t.Errorf("Read(%v) = % x, want % x", tt.address, got, tt.value)
+			}
+			words, err := s.Memory.Get(tt.word, len(tt.want))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for k := range tt.want {
+				if words[k] != tt.want[k] {
+					t.Errorf("memory %v = %04x, want %04x", tt.word, words, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestReadWriteMultiFrame(t *testing.T) {
+	s, client := newTestClient(t)
+	value := make([]byte, 0x800)
+	for k := range value {
+		value[k] = byte(k * 7)
+	}
+	if err := client.Write("U07F00", value); err != nil {
+		t.Fatal(err)
+	}
+	got, err := client.Read("U07F00", uint16(len(value)/2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, value) {
+		t.Fatalf("Read(U07F00) does not match the written value")
+	}
+	// 跨越 U 的区域 08 09
+	words, _ := s.Memory.Get("U08000", 1)
+	if want := toyopuc.DecodeUint16s(value[0x200:])[0]; words[0] != want {
+		t.Errorf("U08000 = %04x, want %04x", words[0], want)
+	}
+}
+
+func TestReadWriteByteSegment(t *testing.T) {
+	s, client := newTestClient(t)
+	// U07FFEH 至 U08001L 跨越 U 的区域 08 09
+	value := []byte{0x11, 0x22, 0x33, 0x44, 0x55, 0x66}
+	if err := client.Write("U07FFEH", value); err != nil {
+		t.Fatal(err)
+	}
+	got, err := client.Read("U07FFEH", uint16(len(value)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, value) {
+		t.Errorf("Read(U07FFEH) = % x, want % x", got, value)
+	}
+	for address, want := range map[string][]uint16{
+		"U07FFE": {0x1100, 0x3322},
+		"U08000": {0x5544, 0x0066},
+		// 区域 08 的字节地址不能越过 0xFFFF 回到开头
+		"U00000": {0x0000, 0x0000},
+	} {
+		words, err := s.Memory.Get(address, len(want))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k := range want {
+			if words[k] != want[k] {
+				t.Errorf("%v = %04x, want %04x", address, words, want)
+				break
+			}
+		}
+	}
+}
+
+func TestIOMultipoint(t *testing.T) {
+	s, client := newTestClient(t)
+	tests := []struct {
+		name  string
+		write func() error
+		read  func() ([]byte, error)
+		want  []byte
+	}{
+		{
+			name:  "word",
+			write: func() error { return client.WriteIOMultipointWord([]uint16{0x1000, 0x1010}, []uint16{0x1111, 0x2222}) },
+			read:  func() ([]byte, error) { return client.ReadIOMultipointWord([]uint16{0x1000, 0x1010}) },
+			want:  []byte{0x11, 0x11, 0x22, 0x22},
+		},
+		{
+			name:  "byte",
+			write: func() error { return client.WriteIOMultipointByte([]uint16{0x2100, 0x2103}, []byte{0xA1, 0xB2}) },
+			read:  func() ([]byte, error) { return client.ReadIOMultipointByte([]uint16{0x2100, 0x2103}) },
+			want:  []byte{0xA1, 0xB2},
+		},
+		{
+			name:  "bit",
+			write: func() error { return client.WriteIOMultipointBit([]uint16{0x1800, 0x1805}, []byte{1, 1}) },
+			read: func() ([]byte, error) {
+				bits, err := client.ReadIOMultipointBit([]uint16{0x1800, 0x1801, 0x1805})
+				results := make([]byte, len(bits))
+				for k, b := range bits {
+					if b {
+						results[k] = 1
+					}
+				}
+				return results, err
+			},
+			want: []byte{1, 0, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.write(); err != nil {
+				t.Fatal(err)
+			}
+			got, err := tt.read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("read % x, want % x", got, tt.want)
+			}
+		})
+	}
+	if w := s.Memory.Words(toyopuc.FamilyIO, 0, 0x1010, 1)[0]; w != 0x2222 {
+		t.Errorf("word 0x1010 = %04x, want %04x", w, 0x2222)
+	}
+	if w := s.Memory.Words(toyopuc.FamilyIO, 0, 0x0180, 1)[0]; w != 0x0021 {
+		t.Errorf("M000W = %04x, want %04x", w, 0x0021)
+	}
+}
+
+func TestExpansion(t *testing.T) {
+	s, client := newTestClient(t)
+	tests := []struct {
+		name  string
+		write func() error
+		read  func() ([]byte, error)
+		want  []byte
+	}{
+		{
+			name:  "program word",
+			write: func() error { return client.WriteProgramExpansionWord(2, 0x0100, []uint16{0xCAFE}) },
+			read:  func() ([]byte, error) { return client.ReadProgramExpansionWord(2, 0x0100, 1) },
+			want:  []byte{0xFE, 0xCA},
+		},
+		{
+			name:  "data word",
+			write: func() error { return client.WriteDataExpansionWord(8, 0x0010, []uint16{0x0102, 0x0304}) },
+			read:  func() ([]byte, error) { return client.ReadDataExpansionWord(8, 0x0010, 2) },
+			want:  []byte{0x02, 0x01, 0x04, 0x03},
+		},
+		{
+			name:  "data byte",
+			write: func() error { return client.WriteDataExpansionByte(0, 0x1001, []byte{0x7F}) },
+			read:  func() ([]byte, error) { return client.ReadDataExpansionByte(0, 0x1000, 2) },
+			want:  []byte{0x00, 0x7F},
+		},
+		{
+			name: "data multipoint",
+			write: func() error {
+				return client.WriteDataExpansionMultipoint(2, 1, 1,
+					[]byte{0, 0}, []uint16{0x0003, 0x000A}, []byte{1, 1},
+					[]byte{1}, []uint16{0x2001}, []byte{0x66},
+					[]byte{8}, []uint16{0x0020}, []uint16{0xA55A})
+			},
+			read: func() ([]byte, error) {
+				return client.ReadDataExpansionMultipoint(3, 1, 1,
+					[]byte{0, 0, 0}, []uint16{0x0003, 0x0004, 0x000A},
+					[]byte{1}, []uint16{0x2001},
+					[]byte{8}, []uint16{0x0020})
+			},
+			want: []byte{0x05, 0x66, 0x5A, 0xA5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.write(); err != nil {
+				t.Fatal(err)
+			}
+			got, err := tt.read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("read % x, want % x", got, tt.want)
+			}
+		})
+	}
+	if w := s.Memory.Words(toyopuc.FamilyDataExpansion, 1, 0x1000, 1)[0]; w != 0x6600 {
+		t.Errorf("P1-D0000 = %04x, want %04x", w, 0x6600)
+	}
+}
+
+func TestPC10(t *testing.T) {
+	s, client := newTestClient(t)
+	tests := []struct {
+		name  string
+		write func() error
+		read  func() ([]byte, error)
+		want  []byte
+	}{
+		{
+			name:  "block",
+			write: func() error { return client.WritePC10Block(toyopuc.PC10Address(8, 0x0200), []byte{1, 2, 3}) },
+			read:  func() ([]byte, error) { return client.ReadPC10Block(toyopuc.PC10Address(8, 0x0200), 4) },
+			want:  []byte{1, 2, 3, 0},
+		},
+		{
+			name: "fr block",
+			write: func() error {
+				return client.WritePC10Block(toyopuc.PC10Address(toyopuc.PC10AreaFR+1, 0x0010), []byte{0x11, 0x22})
+			},
+			read: func() ([]byte, error) {
+				return client.ReadPC10Block(toyopuc.PC10Address(toyopuc.PC10AreaFR+1, 0x0010), 2)
+			},
+			want: []byte{0x11, 0x22},
+		},
+		{
+			name: "multipoint",
+			write: func() error {
+				return client.WritePC10Multipoint(
+					[]uint32{toyopuc.PC10Address(0, 0x0601)}, []byte{1},
+					[]uint32{toyopuc.PC10Address(2, 0x2003)}, []byte{0x44},
+					[]uint32{toyopuc.PC10Address(9, 0x0100)}, []uint16{0x1234})
+			},
+			read: func() ([]byte, error) {
+				return client.ReadPC10Multipoint(
+					[]uint32{toyopuc.PC10Address(0, 0x0600), toyopuc.PC10Address(0, 0x0601)},
+					[]uint32{toyopuc.PC10Address(2, 0x2003)},
+					[]uint32{toyopuc.PC10Address(9, 0x0100)})
+			},
+			want: []byte{0x02, 0x44, 0x34, 0x12},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.write(); err != nil {
+				t.Fatal(err)
+			}
+			got, err := tt.read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("read % x, want % x", got, tt.want)
+			}
+		})
+	}
+	if w := s.Memory.FR(toyopuc.FRBlockWords+8, 1)[0]; w != 0x2211 {
+		t.Errorf("FR %06X = %04x, want %04x", toyopuc.FRBlockWords+8, w, 0x2211)
+	}
+	if w := s.Memory.Words(toyopuc.FamilyDataExpansion, 9, 0x0080, 1)[0]; w != 0x1234 {
+		t.Errorf("U08080 = %04x, want %04x", w, 0x1234)
+	}
+}
+
+func TestFR(t *testing.T) {
+	s, client := newTestClient(t)
+	// 跨越块 0 与块 1
+	address := uint32(toyopuc.FRBlockWords - 2)
+	value := []uint16{1, 2, 3, 4}
+	if err := client.WriteFR(address, value); err != nil {
+		t.Fatal(err)
+	}
+	got, err := client.ReadFR(address, len(value))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k := range value {
+		if got[k] != value[k] {
+			t.Fatalf("ReadFR = %v, want %v", got, value)
+		}
+	}
+	if err = client.CommitFR(address, len(value)); err != nil {
+		t.Fatal(err)
+	}
+	if w := s.FlashFR(0)[toyopuc.FRBlockWords-1]; w != 2 {
+		t.Errorf("block 0 flash = %04x, want %04x", w, 2)
+	}
+	if w := s.FlashFR(1)[1]; w != 4 {
+		t.Errorf("block 1 flash = %04x, want %04x", w, 4)
+	}
+}
+
+func TestTCPBadLengthClosesConnection(t *testing.T) {
+	for _, kind := range []FaultKind{FaultZeroLength, FaultOversizedLength} {
+		t.Run(kind.String(), func(t *testing.T) {
+			s := NewServer()
+			if err := s.Start("127.0.0.1:0"); err != nil {
+				t.Fatal(err)
+			}
+			handler := toyopuc.NewTCPClientHandler(s.Addr().String())
+			handler.Timeout = 200 * time.Millisecond
+			handler.ReconnectBackoff = 0
+			var states []toyopuc.ConnState
+			handler.OnStateChange = func(state toyopuc.ConnState, err error) {
+				states = append(states, state)
+			}
+			defer func() {
+				handler.Close()
+				s.Close()
+			}()
+			client := toyopuc.NewClient(handler)
+
+			s.AddFault(Fault{Kind: kind, Count: 1})
+			if _, err := client.Read("D0100", 1); !errors.Is(err, toyopuc.ErrLength) {
+				t.Fatalf("Read error = %v, want %v", err, toyopuc.ErrLength)
+			}
+			// 剩余的数据不能与下一个响应错位
+			if err := s.Memory.Set("D0100", 0x1234); err != nil {
+				t.Fatal(err)
+			}
+			got, err := client.Read("D0100", 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, []byte{0x34, 0x12}) {
+				t.Errorf("Read(D0100) = % x, want % x", got, []byte{0x34, 0x12})
+			}
+			want := []toyopuc.ConnState{toyopuc.ConnConnected, toyopuc.ConnLost, toyopuc.ConnConnected}
+			if len(states) != len(want) {
+				t.Fatalf("states = %v, want %v", states, want)
+			}
+			for k := range want {
+				if states[k] != want[k] {
+					t.Fatalf("states = %v, want %v", states, want)
+				}
+			}
+		})
+	}
+}
+
+// readOnConnect 连接建立时在回调中读取 回调不能在持有锁时执行
+func readOnConnect(t *testing.T, s *Server, client toyopuc.Client) (callback func(toyopuc.ConnState, error), done <-chan error) {
+	t.Helper()
+	if err := s.Memory.Set("D0100", 0x1234); err != nil {
+		t.Fatal(err)
+	}
+	result := make(chan error, 1)
+	callback = func(state toyopuc.ConnState, err error) {
+		if state != toyopuc.ConnConnected {
+			return
+		}
+		got, err := client.Read("D0100", 1)
+		if err == nil && !bytes.Equal(got, []byte{0x34, 0x12}) {
+			err = fmt.Errorf("Read(D0100) = % x, want % x", got, []byte{0x34, 0x12})
+		}
+		result <- err
+	}
+	return callback, result
+}
+
+// waitCallback 等待回调中的读取完成
+func waitCallback(t *testing.T, client toyopuc.Client, done <-chan error) {
+	t.Helper()
+	read := make(chan error, 1)
+	go func() {
+		_, err := client.Read("D0100", 1)
+		read <- err
+	}()
+	select {
+	case err := <-read:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Read from OnStateChange deadlocked")
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Read from OnStateChange: %v", err)
+	}
+}
+
+func TestStateChangeCallbackSends(t *testing.T) {
+	s := NewServer()
+	if err := s.Start("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	handler := toyopuc.NewTCPClientHandler(s.Addr().String())
+	defer func() {
+		handler.Close()
+		s.Close()
+	}()
+	client := toyopuc.NewClient(handler)
+	callback, done := readOnConnect(t, s, client)
+	handler.OnStateChange = callback
+	waitCallback(t, client, done)
+}
+
+func TestCommitFR(t *testing.T) {
+	tests := []struct {
+		name  string
+		start time.Duration
+		delay time.Duration
+		fail  bool
+		want  error
+	}{
+		{name: "immediate"},
+		{name: "delayed", delay: 100 * time.Millisecond},
+		// 登录命令响应后 CPU 才开始写入
+		{name: "late start", start: 100 * time.Millisecond, delay: 100 * time.Millisecond},
+		{name: "late start failure", start: 100 * time.Millisecond, delay: 50 * time.Millisecond, fail: true, want: toyopuc.ErrFRCommit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, client := newTestClient(t)
+			s.SetFRStartDelay(tt.start)
+			s.SetFRRegistration(tt.delay, tt.fail)
+			if err := client.WriteFR(0x10, []uint16{0xABCD}); err != nil {
+				t.Fatal(err)
+			}
+			err := client.CommitFR(0x10, 1)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("CommitFR error = %v, want %v", err, tt.want)
+			}
+			flash := s.FlashFR(0)
+			if tt.fail {
+				if flash != nil {
+					t.Errorf("block 0 is registered after a failure")
+				}
+				return
+			}
+			// CommitFR 返回时登录已完成
+			if flash == nil || flash[0x10] != 0xABCD {
+				t.Fatalf("block 0 is not registered when CommitFR returns")
+			}
+		})
+	}
+}
+
+func TestReadTags(t *testing.T) {
+	s, client := newTestClient(t)
+	for address, value := range map[string]uint16{
+		"D0100": 0x1111, "D0110": 0x2222, "D0300": 0xAB00,
+		"M000W": 0x0008, "P2-D0100": 0x3333, "P2-D0101": 0x4444, "U08000": 0x5555,
+	} {
+		if err := s.Memory.Set(address, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tags := []toyopuc.Tag{
+		{Address: "D0100"}, {Address: "D0110"}, {Address: "D0300H"}, {Address: "M0003"},
+		{Address: "P2-D0100", Quantity: 2}, {Address: "U08000"},
+	}
+	want := [][]byte{{0x11, 0x11}, {0x22, 0x22}, {0xAB}, {1}, {0x33, 0x33, 0x44, 0x44}, {0x55, 0x55}}
+	got, err := client.ReadTags(tags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k := range want {
+		if !bytes.Equal(got[k], want[k]) {
+			t.Errorf("%v = % x, want % x", tags[k].Address, got[k], want[k])
+		}
+	}
+}
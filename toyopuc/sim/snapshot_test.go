@@ -0,0 +1,74 @@
+package sim
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"toyopuc/toyopuc"
+)
+
+func TestBackupRestore(t *testing.T) {
+	s, client := newTestClient(t)
+	if err := s.Memory.Set("D0100", 0x1234, 0x5678); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Memory.Set("P2-D0100", 0xCAFE); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := toyopuc.Backup(client, &toyopuc.BackupOptions{Areas: []string{"IO", "P2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err = snapshot.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if snapshot, err = toyopuc.ReadSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.Memory.Set("D0100", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Memory.Set("P2-D0100", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = toyopuc.Restore(client, snapshot, nil); err != nil {
+		t.Fatal(err)
+	}
+	for address, want := range map[string]uint16{"D0100": 0x1234, "D0101": 0x5678, "P2-D0100": 0xCAFE} {
+		words, err := s.Memory.Get(address, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if words[0] != want {
+			t.Errorf("%v = %04x, want %04x", address, words[0], want)
+		}
+	}
+}
+
+func TestBackupSkipMissing(t *testing.T) {
+	s, client := newTestClient(t)
+	// CPU 没有程序扩展区域
+	s.AddFault(Fault{Kind: FaultException, FunctionCodes: []byte{toyopuc.FunProgramExpansionReadWord}, Code: toyopuc.ExceptionCodeAddressNotInRange})
+	options := &toyopuc.BackupOptions{Areas: []string{"IO", "PRG1", "PRG2"}}
+	if _, err := toyopuc.Backup(client, options); !errors.Is(err, toyopuc.ErrAddressNotInRange) {
+		t.Fatalf("Backup error = %v, want %v", err, toyopuc.ErrAddressNotInRange)
+	}
+	options.SkipMissing = true
+	snapshot, err := toyopuc.Backup(client, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.Areas) != 1 || snapshot.Area("IO") == nil {
+		t.Errorf("areas = %v, want only IO", len(snapshot.Areas))
+	}
+
+	// 可重试的错误码不跳过
+	s.ClearFaults()
+	s.AddFault(Fault{Kind: FaultException, FunctionCodes: []byte{toyopuc.FunProgramExpansionReadWord}, Code: toyopuc.ExceptionCodeConflictWithOtherCommand})
+	if _, err = toyopuc.Backup(client, options); !errors.Is(err, toyopuc.ErrConflictWithOtherCommand) {
+		t.Errorf("Backup error = %v, want %v", err, toyopuc.ErrConflictWithOtherCommand)
+	}
+}
@@ -0,0 +1,71 @@
+package sim
+
+import "testing"
+
+type testStruct struct {
+	Word    uint16  `toyopuc:"D0100"`
+	Count   int32   `toyopuc:"D0102,int32,abcd"`
+	Speed   float32 `toyopuc:"D0104"`
+	Code    int     `toyopuc:"D0106,bcd"`
+	Name    string  `toyopuc:"D0110,string,3"`
+	Low     uint8   `toyopuc:"D0120L"`
+	Running bool    `toyopuc:"M0010.3"`
+	Flag    bool    `toyopuc:"D0130.F"`
+	Other   uint16  `toyopuc:"P2-D0100"`
+}
+
+func TestStruct(t *testing.T) {
+	s, client := newTestClient(t)
+	// 位与字节的写入不能改变同一字中的其他位
+	if err := s.Memory.Set("D0120", 0xAB00); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Memory.Set("D0130", 0x0001); err != nil {
+		t.Fatal(err)
+	}
+	want := testStruct{
+		Word:    0x1234,
+		Count:   -2,
+		Speed:   1.5,
+		Code:    1234,
+		Name:    "ABCDE",
+		Low:     0x56,
+		Running: true,
+		Flag:    true,
+		Other:   0xCAFE,
+	}
+	if err := client.WriteStruct(&want); err != nil {
+		t.Fatal(err)
+	}
+	for address, w := range map[string]uint16{
+		"D0100": 0x1234, "D0102": 0xFFFF, "D0103": 0xFFFE, "D0106": 0x1234,
+		"D0110": 0x4241, "D0112": 0x0045, "D0120": 0xAB56, "M001W": 0x0008, "D0130": 0x8001, "P2-D0100": 0xCAFE,
+	} {
+		words, err := s.Memory.Get(address, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if words[0] != w {
+			t.Errorf("%v = %04x, want %04x", address, words[0], w)
+		}
+	}
+
+	var got testStruct
+	if err := client.ReadStruct(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("ReadStruct = %+v, want %+v", got, want)
+	}
+
+	// BCD 的无效值
+	if err := s.Memory.Set("D0106", 0x12AB); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.ReadStruct(&got); err == nil {
+		t.Error("ReadStruct of invalid BCD succeeded")
+	}
+	if err := client.WriteStruct(&testStruct{Code: 10000, Name: "A"}); err == nil {
+		t.Error("WriteStruct of BCD 10000 succeeded")
+	}
+}
@@ -0,0 +1,157 @@
+package sim
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"toyopuc/toyopuc"
+)
+
+// nextUpdate 等待下一个通知
+func nextUpdate(t *testing.T, c <-chan toyopuc.Update) toyopuc.Update {
+	t.Helper()
+	select {
+	case u, ok := <-c:
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		return u
+	case <-time.After(time.Second):
+		t.Fatal("no update within 1s")
+	}
+	return toyopuc.Update{}
+}
+
+// noUpdate 确认一段时间内没有通知
+func noUpdate(t *testing.T, c <-chan toyopuc.Update) {
+	t.Helper()
+	select {
+	case u := <-c:
+		t.Fatalf("unexpected update %v %v % x", u.Tag.Address, u.Quality, u.Value)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	s, client := newTestClient(t)
+	if err := s.Memory.Set("D0100", 0x1111, 0x2222); err != nil {
+		t.Fatal(err)
+	}
+	tags := []toyopuc.Tag{{Address: "D0100"}, {Address: "D0101"}}
+	sub, err := client.Subscribe(tags, 10*time.Millisecond, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Stop()
+
+	// 第一次读出通知全部点
+	for k, want := range [][]byte{{0x11, 0x11}, {0x22, 0x22}} {
+		u := nextUpdate(t, sub.C)
+		if u.Index != k || u.Tag.Address != tags[k].Address || u.Quality != toyopuc.QualityGood || !bytes.Equal(u.Value, want) {
+			t.Errorf("update %v = %v %v %v % x, want %v good % x", k, u.Index, u.Tag.Address, u.Quality, u.Value, tags[k].Address, want)
+		}
+	}
+	noUpdate(t, sub.C)
+
+	// 只通知变化的值
+	if err = s.Memory.Set("D0101", 0x3333); err != nil {
+		t.Fatal(err)
+	}
+	if u := nextUpdate(t, sub.C); u.Index != 1 || !bytes.Equal(u.Value, []byte{0x33, 0x33}) {
+		t.Errorf("update = %v % x, want D0101 33 33", u.Tag.Address, u.Value)
+	}
+	noUpdate(t, sub.C)
+
+	// 读出失败时每个点通知一次 值为最后的值
+	s.AddFault(Fault{Kind: FaultException, Code: toyopuc.ExceptionCodeAddressNotInRange})
+	for k, want := range [][]byte{{0x11, 0x11}, {0x33, 0x33}} {
+		u := nextUpdate(t, sub.C)
+		if u.Index != k || u.Quality != toyopuc.QualityBad || u.Err == nil || !bytes.Equal(u.Value, want) {
+			t.Errorf("update %v = %v %v %v % x, want bad % x", k, u.Index, u.Quality, u.Err, u.Value, want)
+		}
+	}
+	noUpdate(t, sub.C)
+
+	// 恢复后重新通知
+	if err = s.Memory.Set("D0100", 0x4444); err != nil {
+		t.Fatal(err)
+	}
+	s.ClearFaults()
+	for k, want := range [][]byte{{0x44, 0x44}, {0x33, 0x33}} {
+		u := nextUpdate(t, sub.C)
+		if u.Index != k || u.Quality != toyopuc.QualityGood || u.Err != nil || !bytes.Equal(u.Value, want) {
+			t.Errorf("update %v = %v %v %v % x, want good % x", k, u.Index, u.Quality, u.Err, u.Value, want)
+		}
+	}
+}
+
+func TestSubscribeBackoff(t *testing.T) {
+	s, client := newTestClient(t)
+	// 前 4 次轮询失败
+	s.AddFault(Fault{Kind: FaultException, Code: toyopuc.ExceptionCodeAddressNotInRange, Count: 4})
+	polls := make(chan time.Time, 16)
+	sub, err := client.Subscribe([]toyopuc.Tag{{Address: "D0100"}}, 20*time.Millisecond, func(u toyopuc.Update) {
+		polls <- u.Time
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Stop()
+
+	// 失败只通知一次 恢复后的通知时间说明轮询的间隔
+	first := <-polls
+	// 失败后至少间隔 40ms 80ms 160ms 320ms 再轮询 不退避时在 80ms 恢复
+	select {
+	case u := <-polls:
+		if d := u.Sub(first); d < 600*time.Millisecond {
+			t.Errorf("recovered after %v, want at least %v", d, 600*time.Millisecond)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no update after recovery")
+	}
+}
+
+func TestSubscribeStop(t *testing.T) {
+	s, client := newTestClient(t)
+	sub, err := client.Subscribe([]toyopuc.Tag{{Address: "D0100"}}, 10*time.Millisecond, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nextUpdate(t, sub.C)
+
+	// Stop 中断正在进行的读出
+	s.AddFault(Fault{Kind: FaultDelay, Delay: time.Second, Count: 1})
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	sub.Stop()
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Errorf("Stop took %v", elapsed)
+	}
+	select {
+	case _, ok := <-sub.C:
+		if ok {
+			t.Error("update after Stop")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("C is not closed after Stop")
+	}
+	// 重复 Stop
+	sub.Stop()
+
+	// handler 在 Stop 之后不再调用
+	calls := make(chan struct{}, 64)
+	sub, err = client.Subscribe([]toyopuc.Tag{{Address: "D0100"}}, 5*time.Millisecond, func(u toyopuc.Update) {
+		calls <- struct{}{}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-calls
+	sub.Stop()
+	n := len(calls)
+	time.Sleep(50 * time.Millisecond)
+	if len(calls) != n {
+		t.Errorf("handler called %v times after Stop", len(calls)-n)
+	}
+}
@@ -0,0 +1,111 @@
+package sim
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"toyopuc/toyopuc"
+)
+
+// newUDPTestClient 启动 UDP 模拟服务器并返回连接到它的客户端
+func newUDPTestClient(t *testing.T) (*Server, *toyopuc.UDPClientHandler, toyopuc.Client) {
+	t.Helper()
+	s := NewServer()
+	if err := s.StartUDP("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	handler := toyopuc.NewUDPClientHandler(s.PacketAddr().String())
+	handler.Timeout = 100 * time.Millisecond
+	t.Cleanup(func() {
+		handler.Close()
+		s.Close()
+	})
+	return s, handler, toyopuc.NewClient(handler)
+}
+
+func TestUDPRetransmit(t *testing.T) {
+	s, _, client := newUDPTestClient(t)
+	if err := s.Memory.Set("D0100", 0x1234); err != nil {
+		t.Fatal(err)
+	}
+	s.AddFault(Fault{Kind: FaultTimeout, Count: 2})
+	got, err := client.Read("D0100", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, []byte{0x34, 0x12}) {
+		t.Errorf("Read(D0100) = % x, want % x", got, []byte{0x34, 0x12})
+	}
+
+	// 重发 Retries 次后超时
+	s.AddFault(Fault{Kind: FaultTimeout, Count: 3})
+	if _, err = client.Read("D0100", 1); !errors.Is(err, toyopuc.ErrTimeout) {
+		t.Fatalf("Read error = %v, want %v", err, toyopuc.ErrTimeout)
+	}
+}
+
+func TestUDPWriteNotRetransmitted(t *testing.T) {
+	s, _, client := newUDPTestClient(t)
+	tests := []struct {
+		name  string
+		codes []byte
+		write func() error
+	}{
+		{
+			name:  "write word",
+			codes: []byte{toyopuc.FunIOWriteWord},
+			write: func() error { return client.WriteIOWord(0x1000, []uint16{0x5678}) },
+		},
+		{
+			name:  "stop",
+			codes: []byte{toyopuc.FunCommand},
+			write: func() error { return client.StopCPU() },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 重发时第二次发送会成功
+			s.AddFault(Fault{Kind: FaultTimeout, FunctionCodes: tt.codes, Count: 1})
+			if err := tt.write(); !errors.Is(err, toyopuc.ErrTimeout) {
+				t.Fatalf("error = %v, want %v", err, toyopuc.ErrTimeout)
+			}
+			s.ClearFaults()
+		})
+	}
+	if w := s.Memory.Words(toyopuc.FamilyIO, 0, 0x1000, 1)[0]; w != 0 {
+		t.Errorf("word 0x1000 = %04x, want it unwritten", w)
+	}
+	status, err := client.ReadCPUStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Run {
+		t.Errorf("CPU stopped by a retransmitted request")
+	}
+}
+
+func TestUDPDiscardStaleResponse(t *testing.T) {
+	s, handler, client := newUDPTestClient(t)
+	handler.Retries = 0
+	if err := s.Memory.Set("D0100", 0x1111); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Memory.Set("D0200", 0x2222, 0x3333); err != nil {
+		t.Fatal(err)
+	}
+	s.AddFault(Fault{Kind: FaultDelay, Delay: 200 * time.Millisecond, Count: 1})
+	if _, err := client.Read("D0100", 1); !errors.Is(err, toyopuc.ErrTimeout) {
+		t.Fatalf("Read error = %v, want %v", err, toyopuc.ErrTimeout)
+	}
+	// D0100 的响应在等待 D0200 的响应时到达
+	handler.Timeout = time.Second
+	got, err := client.Read("D0200", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0x22, 0x22, 0x33, 0x33}; !bytes.Equal(got, want) {
+		t.Errorf("Read(D0200) = % x, want % x", got, want)
+	}
+}
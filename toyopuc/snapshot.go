@@ -0,0 +1,402 @@
+package toyopuc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strings"
+	"time"
+)
+
+// 快照文件
+//  magic    8 字节 "TOYOPUC\x1A"
+//  version  uint16
+//  time     int64 备份时间 (UnixNano)
+//  count    uint16 区域数
+//  区域     功能码 (0x1C 0x90 0x94) no 起始字地址 uint16 字数 uint32 数据 (字数*2 字节)
+//  crc      uint32 之前全部内容的 CRC32 (IEEE)
+// 数值均为小端
+const (
+	snapshotMagic   = "TOYOPUC\x1A"
+	snapshotVersion = 1
+	// 单个区域的最大字数
+	snapshotMaxWords = 0x10000
+)
+
+// SnapshotArea 快照中的一个区域
+type SnapshotArea struct {
+	// 区域名 见 SnapshotAreas
+	Name string
+	// 指令族 FamilyIO FamilyProgramExpansion FamilyDataExpansion
+	Family Family
+	// 程序号/区域号 (0x90 0x94 的 no)
+	No byte
+	// 起始字地址
+	Start uint16
+	// 字数据
+	Words []uint16
+}
+
+// Snapshot 内存快照
+type Snapshot struct {
+	// 备份时间
+	Time  time.Time
+	Areas []*SnapshotArea
+}
+
+// snapshotArea 备份的区域
+type snapshotArea struct {
+	name   string
+	family Family
+	no     byte
+	start  uint16
+	words  int
+}
+
+// 备份的全部区域 按顺序读出
+var snapshotAreas = []snapshotArea{
+	// 基本区域 P - B
+	{name: "IO", family: FamilyIO, start: 0x0000, words: 0x8000},
+	// 程序
+	{name: "PRG1", family: FamilyProgramExpansion, no: 0x01, start: 0x0000, words: 0x8000},
+	{name: "PRG2", family: FamilyProgramExpansion, no: 0x02, start: 0x0000, words: 0x8000},
+	{name: "PRG3", family: FamilyProgramExpansion, no: 0x03, start: 0x0000, words: 0x8000},
+	// 扩展区域 EP - H
+	{name: "EXT", family: FamilyDataExpansion, no: 0x00, start: 0x0000, words: 0x2000},
+	// 程序1 - 3 的基本区域
+	{name: "P1", family: FamilyDataExpansion, no: 0x01, start: 0x0000, words: 0x8000},
+	{name: "P2", family: FamilyDataExpansion, no: 0x02, start: 0x0000, words: 0x8000},
+	{name: "P3", family: FamilyDataExpansion, no: 0x03, start: 0x0000, words: 0x8000},
+	// GX/GY
+	{name: "GXY", family: FamilyDataExpansion, no: 0x07, start: 0x0000, words: 0x1000},
+	// 扩展寄存器 U
+	{name: "U08", family: FamilyDataExpansion, no: 0x08, start: 0x0000, words: 0x8000},
+	{name: "U09", family: FamilyDataExpansion, no: 0x09, start: 0x0000, words: 0x8000},
+	{name: "U0A", family: FamilyDataExpansion, no: 0x0A, start: 0x0000, words: 0x8000},
+	{name: "U0B", family: FamilyDataExpansion, no: 0x0B, start: 0x0000, words: 0x8000},
+}
+
+// SnapshotAreas 备份的区域名
+//  IO             I/O寄存器 基本区域 (0x1C)
+//  PRG1 - PRG3    程序扩展 (0x90 no 01 - 03)
+//  EXT            数据扩展 扩展区域 EP - H (0x94 no 00)
+//  P1 - P3        数据扩展 程序1 - 3 的基本区域 (0x94 no 01 - 03)
+//  GXY            数据扩展 GX/GY (0x94 no 07)
+//  U08 - U0B      数据扩展 扩展寄存器 U (0x94 no 08 - 0B)
+func SnapshotAreas() []string {
+	names := make([]string, len(snapshotAreas))
+	for k, a := range snapshotAreas {
+		names[k] = a.name
+	}
+	return names
+}
+
+// areaFilter 区域名过滤 names 为空时全部区域
+// withFR 为 true 时也可以指定 FR 块 FR00 - FR3F
+func areaFilter(names []string, withFR bool) (match func(name string) bool, err error) {
+	if len(names) == 0 {
+		return func(string) bool { return true }, nil
+	}
+	set := make(map[string]bool)
+	for _, n := range names {
+		n = strings.ToUpper(strings.TrimSpace(n))
+		known := false
+		for _, a := range snapshotAreas {
+			known = known || a.name == n
+		}
+		for block := 0; withFR && block < FRBlocks; block++ {
+			known = known || frAreaName(block) == n
+		}
+		if !known {
+			all := strings.Join(SnapshotAreas(), " ")
+			if withFR {
+				all += " FR00-FR3F"
+			}
+			return nil, fmt.Errorf("toyopuc: unknown snapshot area '%v', must be one of %v", n, all)
+		}
+		set[n] = true
+	}
+	return func(name string) bool { return set[name] }, nil
+}
+
+// BackupOptions 备份选项
+type BackupOptions struct {
+	// 只备份这些区域 为空时备份全部区域
+	Areas []string
+	// 跳过 CPU 不支持的区域 (第一次读出返回异常响应)，否则返回错误
+	SkipMissing bool
+	// 每帧读出后调用 done 为该区域已读出的字数
+	Progress func(area string, done, total int)
+}
+
+// Backup 读出全部区域的快照
+// I/O寄存器使用 ReadIOWord，程序扩展使用 ReadProgramExpansionWord，数据扩展使用 ReadDataExpansionWord
+func Backup(client Client, options *BackupOptions) (snapshot *Snapshot, err error) {
+	if options == nil {
+		options = &BackupOptions{}
+	}
+	match, err := areaFilter(options.Areas, false)
+	if err != nil {
+		return
+	}
+	max, _ := frameWords(client)
+	s := &Snapshot{Time: time.Now()}
+	for _, a := range snapshotAreas {
+		if !match(a.name) {
+			continue
+		}
+		area := &SnapshotArea{Name: a.name, Family: a.family, No: a.no, Start: a.start, Words: make([]uint16, 0, a.words)}
+		for done := 0; done < a.words; {
+			n := minInt(a.words-done, max)
+			address := a.start + uint16(done)
+			var results []byte
+			switch a.family {
+			case FamilyIO:
+				results, err = client.ReadIOWord(address, uint16(n))
+			case FamilyProgramExpansion:
+				results, err = client.ReadProgramExpansionWord(a.no, address, uint16(n))
+			default:
+				results, err = client.ReadDataExpansionWord(a.no, address, uint16(n))
+			}
+			if err == nil && len(results) != n*2 {
+				err = fmt.Errorf("toyopuc: response data size '%v' does not match expected '%v'", len(results), n*2)
+			}
+			if err != nil {
+				break
+			}
+			area.Words = append(area.Words, DecodeUint16s(results)...)
+			done += n
+			if options.Progress != nil {
+				options.Progress(a.name, done, a.words)
+			}
+		}
+		if err != nil {
+			var exception *ExceptionError
+			if options.SkipMissing && len(area.Words) == 0 && errors.As(err, &exception) && !exception.Retriable() {
+				err = nil
+				continue
+			}
+			err = fmt.Errorf("toyopuc: backup area '%v' at address '%04X': %w", a.name, int(a.start)+len(area.Words), err)
+			return
+		}
+		s.Areas = append(s.Areas, area)
+	}
+	snapshot = s
+	return
+}
+
+// RestoreOptions 恢复选项
+type RestoreOptions struct {
+	// 只恢复这些区域 为空时恢复快照中的全部区域
+	Areas []string
+	// 不写入 只返回将要写入的块
+	DryRun bool
+	// 每帧写入后调用 done 为该区域已写入的字数
+	Progress func(area string, done, total int)
+}
+
+// RestoreBlock 恢复时写入的一帧
+type RestoreBlock struct {
+	Area    string
+	Family  Family
+	No      byte
+	Address uint16
+	Words   int
+}
+
+// String 区域与字地址范围
+func (b RestoreBlock) String() string {
+	return fmt.Sprintf("%v %04X-%04X (%v words)", b.Area, b.Address, int(b.Address)+b.Words-1, b.Words)
+}
+
+// Restore 将快照写回 PLC
+// I/O寄存器使用 WriteIOWord，程序扩展使用 WriteProgramExpansionWord，数据扩展使用 WriteDataExpansionWord
+// 返回已写入的块 (DryRun 时为将要写入的块，client 可以为nil)，出错时为出错之前已写入的块
+// 快照中的 FR 块不恢复，使用 ImportFR
+func Restore(client Client, snapshot *Snapshot, options *RestoreOptions) (blocks []RestoreBlock, err error) {
+	if options == nil {
+		options = &RestoreOptions{}
+	}
+	match, err := areaFilter(options.Areas, false)
+	if err != nil {
+		return
+	}
+	// 写入前检查全部区域 避免只恢复一部分
+	for _, area := range snapshot.Areas {
+		if !area.inAddressSpace(len(area.Words)) {
+			err = fmt.Errorf("toyopuc: snapshot area '%v' at '%04X' with '%v' words exceeds the address space", area.Name, area.Start, len(area.Words))
+			return
+		}
+	}
+	_, max := frameWords(client)
+	for _, area := range snapshot.Areas {
+		// FR 块需要登录 见 ImportFR
+		if !match(area.Name) || isFRArea(area.Family, area.No) {
+			continue
+		}
+		total := len(area.Words)
+		for done := 0; done < total; {
+			n := minInt(total-done, max)
+			block := RestoreBlock{Area: area.Name, Family: area.Family, No: area.No, Address: area.Start + uint16(done), Words: n}
+			value := area.Words[done : done+n]
+			if !options.DryRun {
+				switch area.Family {
+				case FamilyIO:
+					err = client.WriteIOWord(block.Address, value)
+				case FamilyProgramExpansion:
+					err = client.WriteProgramExpansionWord(area.No, block.Address, value)
+				case FamilyDataExpansion:
+					err = client.WriteDataExpansionWord(area.No, block.Address, value)
+				default:
+					err = fmt.Errorf("toyopuc: snapshot area '%v' family '%v' cannot be restored", area.Name, area.Family)
+				}
+				if err != nil {
+					err = fmt.Errorf("toyopuc: restore area '%v' at address '%04X': %w", area.Name, block.Address, err)
+					return
+				}
+			}
+			blocks = append(blocks, block)
+			done += n
+			if options.Progress != nil {
+				options.Progress(area.Name, done, total)
+			}
+		}
+	}
+	return
+}
+
+// Area 按区域名查找 没有时返回nil
+func (s *Snapshot) Area(name string) *SnapshotArea {
+	name = strings.ToUpper(name)
+	for _, a := range s.Areas {
+		if a.Name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// familyCode 区域在快照文件中的功能码
+func familyCode(f Family) (code byte, err error) {
+	switch f {
+	case FamilyIO:
+		code = FunIOReadWord
+	case FamilyProgramExpansion:
+		code = FunProgramExpansionReadWord
+	case FamilyDataExpansion:
+		code = FunDataExpansionReadWord
+	default:
+		err = fmt.Errorf("toyopuc: family '%v' cannot be saved in a snapshot", f)
+	}
+	return
+}
+
+// WriteTo 写入快照文件
+func (s *Snapshot) WriteTo(w io.Writer) (n int64, err error) {
+	var buf bytes.Buffer
+	buf.WriteString(snapshotMagic)
+	binary.Write(&buf, binary.LittleEndian, uint16(snapshotVersion))
+	binary.Write(&buf, binary.LittleEndian, s.Time.UnixNano())
+	binary.Write(&buf, binary.LittleEndian, uint16(len(s.Areas)))
+	for _, a := range s.Areas {
+		var code byte
+		if code, err = familyCode(a.Family); err != nil {
+			return
+		}
+		if len(a.Words) > snapshotMaxWords {
+			err = fmt.Errorf("toyopuc: snapshot area '%v' size '%v' must be at most '%v' words", a.Name, len(a.Words), snapshotMaxWords)
+			return
+		}
+		buf.WriteByte(code)
+		buf.WriteByte(a.No)
+		binary.Write(&buf, binary.LittleEndian, a.Start)
+		binary.Write(&buf, binary.LittleEndian, uint32(len(a.Words)))
+		buf.Write(WordBytes(a.Words))
+	}
+	binary.Write(&buf, binary.LittleEndian, crc32.ChecksumIEEE(buf.Bytes()))
+	return buf.WriteTo(w)
+}
+
+// ReadSnapshot 读出快照文件 校验版本与 CRC
+func ReadSnapshot(r io.Reader) (snapshot *Snapshot, err error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return
+	}
+	if len(data) < len(snapshotMagic)+2+8+2+4 || string(data[:len(snapshotMagic)]) != snapshotMagic {
+		err = fmt.Errorf("toyopuc: not a snapshot file")
+		return
+	}
+	content, sum := data[:len(data)-4], binary.LittleEndian.Uint32(data[len(data)-4:])
+	if crc := crc32.ChecksumIEEE(content); crc != sum {
+		err = fmt.Errorf("toyopuc: snapshot checksum '%08X' does not match expected '%08X'", crc, sum)
+		return
+	}
+	p := content[len(snapshotMagic):]
+	if version := binary.LittleEndian.Uint16(p); version != snapshotVersion {
+		err = fmt.Errorf("toyopuc: snapshot version '%v' is not supported, must be '%v'", version, snapshotVersion)
+		return
+	}
+	s := &Snapshot{Time: time.Unix(0, int64(binary.LittleEndian.Uint64(p[2:])))}
+	count := int(binary.LittleEndian.Uint16(p[10:]))
+	p = p[12:]
+	for k := 0; k < count; k++ {
+		if len(p) < 8 {
+			err = fmt.Errorf("toyopuc: snapshot area '%v' header is truncated", k)
+			return
+		}
+		a := &SnapshotArea{No: p[1], Start: binary.LittleEndian.Uint16(p[2:])}
+		words := int(binary.LittleEndian.Uint32(p[4:]))
+		switch p[0] {
+		case FunIOReadWord:
+			a.Family = FamilyIO
+		case FunProgramExpansionReadWord:
+			a.Family = FamilyProgramExpansion
+		case FunDataExpansionReadWord:
+			a.Family = FamilyDataExpansion
+		default:
+			err = fmt.Errorf("toyopuc: snapshot area '%v' unknown function code '%v'", k, p[0])
+			return
+		}
+		if words > snapshotMaxWords || len(p)-8 < words*2 {
+			err = fmt.Errorf("toyopuc: snapshot area '%v' data is truncated", k)
+			return
+		}
+		if !a.inAddressSpace(words) {
+			err = fmt.Errorf("toyopuc: snapshot area '%v' at '%04X' with '%v' words exceeds the address space", k, a.Start, words)
+			return
+		}
+		a.Name = snapshotAreaName(a.Family, a.No)
+		a.Words = DecodeUint16s(p[8 : 8+words*2])
+		s.Areas = append(s.Areas, a)
+		p = p[8+words*2:]
+	}
+	if len(p) != 0 {
+		err = fmt.Errorf("toyopuc: snapshot has '%v' unexpected bytes", len(p))
+		return
+	}
+	snapshot = s
+	return
+}
+
+// inAddressSpace 从 Start 起的 words 个字不超出16位字地址
+func (a *SnapshotArea) inAddressSpace(words int) bool {
+	return int(a.Start)+words <= 0x10000
+}
+
+// snapshotAreaName 区域名 FR 块为 FR00 - FR3F，不在备份区域中时使用 功能码-no
+func snapshotAreaName(family Family, no byte) string {
+	for _, a := range snapshotAreas {
+		if a.family == family && a.no == no {
+			return a.name
+		}
+	}
+	if isFRArea(family, no) {
+		return frAreaName(int(no - PC10AreaFR))
+	}
+	code, _ := familyCode(family)
+	return fmt.Sprintf("%02X-%02X", code, no)
+}
@@ -0,0 +1,216 @@
+package toyopuc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testSnapshot() *Snapshot {
+	return &Snapshot{
+		Time: time.Unix(1700000000, 123),
+		Areas: []*SnapshotArea{
+			{Name: "IO", Family: FamilyIO, Start: 0x0000, Words: []uint16{0x1234, 0x5678}},
+			{Name: "PRG1", Family: FamilyProgramExpansion, No: 0x01, Start: 0x0010, Words: []uint16{0xCAFE}},
+			{Name: "P2", Family: FamilyDataExpansion, No: 0x02, Start: 0x0000, Words: make([]uint16, 600)},
+			{Name: "FR01", Family: FamilyDataExpansion, No: PC10AreaFR + 1, Words: []uint16{1, 2, 3}},
+		},
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	want := testSnapshot()
+	var buf bytes.Buffer
+	if _, err := want.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadSnapshot(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Time.Equal(want.Time) {
+		t.Errorf("Time = %v, want %v", got.Time, want.Time)
+	}
+	if len(got.Areas) != len(want.Areas) {
+		t.Fatalf("%v areas, want %v", len(got.Areas), len(want.Areas))
+	}
+	for k, a := range want.Areas {
+		g := got.Areas[k]
+		if g.Name != a.Name || g.Family != a.Family || g.No != a.No || g.Start != a.Start || len(g.Words) != len(a.Words) {
+			t.Errorf("area %v = %v %v %v %04X %v words, want %v %v %v %04X %v words", k,
+				g.Name, g.Family, g.No, g.Start, len(g.Words), a.Name, a.Family, a.No, a.Start, len(a.Words))
+			continue
+		}
+		for i := range a.Words {
+			if g.Words[i] != a.Words[i] {
+				t.Errorf("area %v word %v = %04x, want %04x", a.Name, i, g.Words[i], a.Words[i])
+				break
+			}
+		}
+	}
+}
+
+// resum 重新计算 CRC
+func resum(content []byte) []byte {
+	var sum [4]byte
+	binary.LittleEndian.PutUint32(sum[:], crc32.ChecksumIEEE(content))
+	return append(content, sum[:]...)
+}
+
+func TestReadSnapshotErrors(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := testSnapshot().WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	file := buf.Bytes()
+	content := file[:len(file)-4]
+	// magic 之后 version 2 time 8 count 2
+	header := len(snapshotMagic) + 2 + 8 + 2
+	tests := []struct {
+		name string
+		data func() []byte
+		want string
+	}{
+		{
+			name: "not a snapshot",
+			data: func() []byte { return []byte("TOYOPUC") },
+			want: "not a snapshot file",
+		},
+		{
+			name: "crc mismatch",
+			data: func() []byte {
+				d := append([]byte(nil), file...)
+				d[header+8] ^= 0xFF
+				return d
+			},
+			want: "checksum",
+		},
+		{
+			name: "wrong version",
+			data: func() []byte {
+				d := append([]byte(nil), content...)
+				binary.LittleEndian.PutUint16(d[len(snapshotMagic):], snapshotVersion+1)
+				return resum(d)
+			},
+			want: "version '2' is not supported",
+		},
+		{
+			name: "truncated area header",
+			data: func() []byte {
+				d := append([]byte(nil), content[:header+4]...)
+				binary.LittleEndian.PutUint16(d[header-2:], 1)
+				return resum(d)
+			},
+			want: "area '0' header is truncated",
+		},
+		{
+			name: "truncated area data",
+			data: func() []byte {
+				d := append([]byte(nil), content[:header+8+2]...)
+				binary.LittleEndian.PutUint16(d[header-2:], 1)
+				return resum(d)
+			},
+			want: "area '0' data is truncated",
+		},
+		{
+			name: "unknown function code",
+			data: func() []byte {
+				d := append([]byte(nil), content...)
+				d[header] = FunIOReadByte
+				return resum(d)
+			},
+			want: "unknown function code",
+		},
+		{
+			name: "area beyond address space",
+			data: func() []byte {
+				d := append([]byte(nil), content...)
+				binary.LittleEndian.PutUint16(d[header+2:], 0xFFFF)
+				return resum(d)
+			},
+			want: "area '0' at 'FFFF' with '2' words exceeds the address space",
+		},
+		{
+			name: "trailing bytes",
+			data: func() []byte {
+				d := append(append([]byte(nil), content...), 0, 0, 0)
+				return resum(d)
+			},
+			want: "'3' unexpected bytes",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadSnapshot(bytes.NewReader(tt.data()))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ReadSnapshot error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestoreAddressSpace(t *testing.T) {
+	snapshot := testSnapshot()
+	snapshot.Areas[1].Start = 0xFFFF
+	snapshot.Areas[1].Words = []uint16{1, 2}
+	if _, err := Restore(nil, snapshot, &RestoreOptions{DryRun: true}); err == nil || !strings.Contains(err.Error(), "exceeds the address space") {
+		t.Errorf("Restore error = %v, want exceeds the address space", err)
+	}
+	// 到 FFFF 为止的区域可以恢复
+	snapshot.Areas[1].Words = []uint16{1}
+	blocks, err := Restore(nil, snapshot, &RestoreOptions{Areas: []string{"PRG1"}, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 1 || blocks[0].Address != 0xFFFF || blocks[0].Words != 1 {
+		t.Errorf("blocks = %+v, want one word at FFFF", blocks)
+	}
+}
+
+func TestRestoreDryRun(t *testing.T) {
+	tests := []struct {
+		name  string
+		areas []string
+		want  []string
+	}{
+		{
+			name: "all",
+			want: []string{
+				"IO 0000-0001 (2 words)",
+				"PRG1 0010-0010 (1 words)",
+				"P2 0000-00FB (252 words)",
+				"P2 00FC-01F7 (252 words)",
+				"P2 01F8-0257 (96 words)",
+			},
+		},
+		{
+			name:  "filter",
+			areas: []string{"prg1", " IO"},
+			want: []string{
+				"IO 0000-0001 (2 words)",
+				"PRG1 0010-0010 (1 words)",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks, err := Restore(nil, testSnapshot(), &RestoreOptions{Areas: tt.areas, DryRun: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, len(blocks))
+			for k, b := range blocks {
+				got[k] = b.String()
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("blocks =\n%v\nwant\n%v", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+	if _, err := Restore(nil, testSnapshot(), &RestoreOptions{Areas: []string{"FR01"}, DryRun: true}); err == nil {
+		t.Errorf("Restore with area FR01 succeeded")
+	}
+}
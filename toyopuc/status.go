@@ -0,0 +1,226 @@
+package toyopuc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// CPU 状态数据的字节数
+const cpuStatusSize = 8
+
+// CPUStatus CPU 状态 (命令 0x32 子命令 0x11 的8字节状态数据)
+type CPUStatus struct {
+	// 状态1
+	// 运行中
+	Run bool
+	// 停止中
+	UnderStop bool
+	// 停止请求持续中
+	UnderStopRequestContinuity bool
+	// 伪停止中
+	UnderPseudoStop bool
+	// 调试模式
+	DebugMode bool
+	// I/O 监视用户模式
+	IOMonitorUserMode bool
+	// PC3 模式
+	PC3Mode bool
+	// PC10 模式
+	PC10Mode bool
+
+	// 状态2
+	// 重故障
+	FatalFailure bool
+	// 轻故障
+	FaintFailure bool
+	// 报警
+	Alarm bool
+	// I/O 分配参数已变更
+	IOAllocationParameterAltered bool
+	// 安装了存储卡
+	WithMemoryCard bool
+
+	// 状态3
+	// 存储卡运行
+	MemoryCardOperation bool
+	// 程序及附加信息 写保护
+	WriteProtectedProgram bool
+	// 系统内存 读保护/写保护
+	ReadProtectedSystemMemory  bool
+	WriteProtectedSystemMemory bool
+	// 系统 I/O 读保护/写保护
+	ReadProtectedSystemIO  bool
+	WriteProtectedSystemIO bool
+	// 跟踪中
+	Trace bool
+	// 扫描采样跟踪中
+	ScanSamplingTrace bool
+
+	// 状态4
+	// 周期采样跟踪中
+	PeriodicSamplingTrace bool
+	// 上升沿检测有效
+	EnableDetected bool
+	// FR 写入 (登录) 中
+	UnderWritingFlashRegister bool
+	// FR 写入异常
+	AbnormalWriteFlashRegister bool
+
+	// 状态5 - 8 未解码的内容见 Raw
+	// 程序1 - 3 写入中
+	UnderProgramWriting [3]bool
+
+	// 原始的8字节状态数据
+	Raw [cpuStatusSize]byte
+}
+
+// cpuStatusFlag 状态位 第 index 字节的第 bit 位
+type cpuStatusFlag struct {
+	index, bit int
+	value      *bool
+	name       string
+}
+
+// flags 状态位的位置
+func (s *CPUStatus) flags() []cpuStatusFlag {
+	return []cpuStatusFlag{
+		{0, 0, &s.Run, "run"},
+		{0, 1, &s.UnderStop, "stop"},
+		{0, 2, &s.UnderStopRequestContinuity, "stop request"},
+		{0, 3, &s.UnderPseudoStop, "pseudo stop"},
+		{0, 4, &s.DebugMode, "debug"},
+		{0, 5, &s.IOMonitorUserMode, "io monitor"},
+		{0, 6, &s.PC3Mode, "pc3"},
+		{0, 7, &s.PC10Mode, "pc10"},
+		{1, 0, &s.FatalFailure, "fatal failure"},
+		{1, 1, &s.FaintFailure, "faint failure"},
+		{1, 2, &s.Alarm, "alarm"},
+		{1, 4, &s.IOAllocationParameterAltered, "io allocation altered"},
+		{1, 5, &s.WithMemoryCard, "memory card"},
+		{2, 0, &s.MemoryCardOperation, "memory card operation"},
+		{2, 1, &s.WriteProtectedProgram, "program write protected"},
+		{2, 2, &s.ReadProtectedSystemMemory, "system memory read protected"},
+		{2, 3, &s.WriteProtectedSystemMemory, "system memory write protected"},
+		{2, 4, &s.ReadProtectedSystemIO, "system io read protected"},
+		{2, 5, &s.WriteProtectedSystemIO, "system io write protected"},
+		{2, 6, &s.Trace, "trace"},
+		{2, 7, &s.ScanSamplingTrace, "scan sampling trace"},
+		{3, 0, &s.PeriodicSamplingTrace, "periodic sampling trace"},
+		{3, 1, &s.EnableDetected, "edge detection"},
+		{3, 6, &s.UnderWritingFlashRegister, "writing fr"},
+		{3, 7, &s.AbnormalWriteFlashRegister, "fr write error"},
+		{4, 0, &s.UnderProgramWriting[0], "writing prg1"},
+		{4, 1, &s.UnderProgramWriting[1], "writing prg2"},
+		{4, 2, &s.UnderProgramWriting[2], "writing prg3"},
+	}
+}
+
+// DecodeCPUStatus 解码8字节状态数据
+func DecodeCPUStatus(data []byte) (status *CPUStatus, err error) {
+	if len(data) != cpuStatusSize {
+		err = fmt.Errorf("%w: cpu status size '%v' does not match expected '%v'", ErrLength, len(data), cpuStatusSize)
+		return
+	}
+	status = &CPUStatus{}
+	copy(status.Raw[:], data)
+	for _, f := range status.flags() {
+		*f.value = data[f.index]&(1<<f.bit) != 0
+	}
+	return
+}
+
+// Bytes 编码为8字节状态数据 未解码的位取自 Raw
+func (s *CPUStatus) Bytes() []byte {
+	data := make([]byte, cpuStatusSize)
+	copy(data, s.Raw[:])
+	for _, f := range s.flags() {
+		if *f.value {
+			data[f.index] |= 1 << f.bit
+		} else {
+			data[f.index] &^= 1 << f.bit
+		}
+	}
+	return data
+}
+
+// String 置位的状态
+func (s *CPUStatus) String() string {
+	var names []string
+	for _, f := range s.flags() {
+		if *f.value {
+			names = append(names, f.name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
+
+// ReadCPUStatus
+// CPU 状态读出
+//  Function code         : 1 byte (0x32)
+//  Sub command           : 2 bytes (0x11 0x00)
+func (toyopuc *client) ReadCPUStatus() (status *CPUStatus, err error) {
+	data, err := toyopuc.command(SubCommandReadCPUStatus, nil)
+	if err != nil {
+		return
+	}
+	return DecodeCPUStatus(data)
+}
+
+// RunCPU
+// 运行
+//  Function code         : 1 byte (0x32)
+//  Sub command           : 2 bytes (0x12 0x00)
+//  Data                  : 1 byte (0x01)
+func (toyopuc *client) RunCPU() (err error) {
+	_, err = toyopuc.command(SubCommandRunStop, []byte{0x01})
+	return
+}
+
+// StopCPU
+// 停止
+//  Function code         : 1 byte (0x32)
+//  Sub command           : 2 bytes (0x12 0x00)
+//  Data                  : 1 byte (0x00)
+func (toyopuc *client) StopCPU() (err error) {
+	_, err = toyopuc.command(SubCommandRunStop, []byte{0x00})
+	return
+}
+
+// command 发送命令 (0x32) 返回子命令之后的数据
+// 响应的前2字节为请求的子命令
+func (toyopuc *client) command(sub uint16, data []byte) (results []byte, err error) {
+	request := ProtocolDataUnit{
+		FunctionCode: FunCommand,
+		Data:         append(dataBlock(sub), data...),
+	}
+	response, err := toyopuc.send(&request)
+	if err != nil {
+		return
+	}
+	if len(response.Data) < 2 {
+		err = fmt.Errorf("%w: response data size '%v' is less than expected '%v'", ErrLength, len(response.Data), 2)
+		return
+	}
+	if s := binary.LittleEndian.Uint16(response.Data); s != sub {
+		err = fmt.Errorf("%w: response sub command '%#x' for request '%#x'", ErrFunctionCodeMismatch, s, sub)
+		return
+	}
+	results = response.Data[2:]
+	return
+}
+
+// isWriteCommand 改变 PLC 状态的子命令
+func isWriteCommand(request *ProtocolDataUnit) bool {
+	if request.FunctionCode != FunCommand || len(request.Data) < 2 {
+		return false
+	}
+	switch binary.LittleEndian.Uint16(request.Data) {
+	case SubCommandRunStop, SubCommandWriteClock:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package toyopuc
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// replyTransporter 响应的数据固定为 data
+type replyTransporter struct {
+	data []byte
+}
+
+func (r replyTransporter) Send(aduRequest []byte) (aduResponse []byte, err error) {
+	aduResponse = []byte{ResponseFTByte, 0x00, byte(len(r.data) + 1), 0x00, aduRequest[tcpHeaderSize]}
+	return append(aduResponse, r.data...), nil
+}
+
+func TestDecodeCPUStatus(t *testing.T) {
+	s := &CPUStatus{}
+	for _, f := range s.flags() {
+		t.Run(f.name, func(t *testing.T) {
+			data := make([]byte, cpuStatusSize)
+			data[f.index] = 1 << f.bit
+			// 未解码的位保留在 Raw 中
+			data[7] = 0xA5
+			status, err := DecodeCPUStatus(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, g := range status.flags() {
+				if *g.value != (g.name == f.name) {
+					t.Errorf("%v = %v", g.name, *g.value)
+				}
+			}
+			if status.String() != f.name {
+				t.Errorf("String() = %v, want %v", status.String(), f.name)
+			}
+			if got := status.Bytes(); !bytes.Equal(got, data) {
+				t.Errorf("Bytes() = % x, want % x", got, data)
+			}
+		})
+	}
+	if _, err := DecodeCPUStatus(make([]byte, cpuStatusSize-1)); !errors.Is(err, ErrLength) {
+		t.Errorf("DecodeCPUStatus error = %v, want %v", err, ErrLength)
+	}
+}
+
+func TestCommandSubCommandMismatch(t *testing.T) {
+	packager := &tcpPackager{RequestFT: RequestFTByte, ResponseFTByte: ResponseFTByte}
+	// 响应为时钟读出的子命令
+	client := NewClient2(packager, replyTransporter{data: append(dataBlock(SubCommandReadClock), make([]byte, cpuStatusSize)...)})
+	if _, err := client.ReadCPUStatus(); !errors.Is(err, ErrFunctionCodeMismatch) {
+		t.Errorf("ReadCPUStatus error = %v, want %v", err, ErrFunctionCodeMismatch)
+	}
+	if err := client.StopCPU(); !errors.Is(err, ErrFunctionCodeMismatch) {
+		t.Errorf("StopCPU error = %v, want %v", err, ErrFunctionCodeMismatch)
+	}
+	client = NewClient2(packager, replyTransporter{data: []byte{0x11}})
+	if _, err := client.ReadCPUStatus(); !errors.Is(err, ErrLength) {
+		t.Errorf("ReadCPUStatus error = %v, want %v", err, ErrLength)
+	}
+}
@@ -0,0 +1,438 @@
+package toyopuc
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 结构体标签
+// 格式: toyopuc:"地址[,类型][,字序][,字数]"
+//  toyopuc:"D0100"              uint16 int16 等按字段类型推断
+//  toyopuc:"D0100,int32,cdab"   两个连续的字 字序 cdab/abcd 默认 cdab
+//  toyopuc:"D0200,float32,abcd"
+//  toyopuc:"D0300,bcd"          4位BCD码
+//  toyopuc:"D0400,string,10"    10个字的ASCII字符串
+//  toyopuc:"M0010.3"            bool
+//  toyopuc:"D0100.F"            bool 字设备的位
+//  toyopuc:"D0100L"             uint8 字节
+// 整数字段必须能容纳该类型的全部取值，如 uint16 不能映射到 uint8 或 int16 字段
+const structTagName = "toyopuc"
+
+// structField 带标签的结构体字段
+type structField struct {
+	// 字段名
+	name string
+	// 字段值
+	value reflect.Value
+	// 地址
+	addr *Address
+	// 数据类型
+	kind DataType
+	// 32位数据字序
+	order WordOrder
+	// 占用的字数
+	words int
+}
+
+// ReadStruct 按结构体标签读出
+// v 必须是结构体指针，所有字段通过批量读出计划合并为尽量少的帧
+func (toyopuc *client) ReadStruct(v interface{}) (err error) {
+	fields, err := structFields(v)
+	if err != nil {
+		return
+	}
+	addrs := make([]*Address, len(fields))
+	quantities := make([]uint16, len(fields))
+	for k, f := range fields {
+		addrs[k] = f.addr
+		quantities[k] = 1
+		if f.addr.Unit == UnitWord {
+			quantities[k] = uint16(f.words)
+		}
+	}
+	plan, err := planRead(addrs, quantities)
+	if err != nil {
+		return
+	}
+	results, err := toyopuc.ExecutePlan(plan)
+	if err != nil {
+		return
+	}
+	for k, f := range fields {
+		if err = f.decode(results[k]); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// WriteStruct 按结构体标签写入
+// v 必须是结构体指针，连续的字地址合并为一帧写入
+func (toyopuc *client) WriteStruct(v interface{}) (err error) {
+	fields, err := structFields(v)
+	if err != nil {
+		return
+	}
+	var wordFields []*structField
+	for _, f := range fields {
+		if f.addr.Unit == UnitWord {
+			wordFields = append(wordFields, f)
+			continue
+		}
+		var data []byte
+		if data, err = f.encode(); err != nil {
+			return
+		}
+		if err = toyopuc.write(f.addr, data); err != nil {
+			return
+		}
+	}
+	for _, r := range mergeWordRanges(wordFields) {
+		value := make([]uint16, r.quantity())
+		for _, f := range r.fields {
+			var data []byte
+			if data, err = f.encode(); err != nil {
+				return
+			}
+			copy(value[int(f.addr.Word)-r.start:], DecodeUint16s(data))
+		}
+		if err = toyopuc.writeWord(r.addr(), value); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// wordRange 合并后的连续字区域 用于写入
+// 结束地址可能为 0x10000 使用 int
+type wordRange struct {
+	start  int
+	end    int
+	fields []*structField
+}
+
+// addr 区域起始地址
+func (r *wordRange) addr() *Address {
+	a := *r.fields[0].addr
+	a.Unit = UnitWord
+	a.Word = uint16(r.start)
+	return &a
+}
+
+// quantity 区域字数
+func (r *wordRange) quantity() uint16 {
+	return uint16(r.end - r.start)
+}
+
+// mergeWordRanges 合并相同指令族、相同区域号的连续字地址
+// 写入时不能跨越间隙，总字数不超过 0x200
+func mergeWordRanges(fields []*structField) (ranges []*wordRange) {
+	sorted := make([]*structField, len(fields))
+	copy(sorted, fields)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i].addr, sorted[j].addr
+		if a.Family != b.Family {
+			return a.Family < b.Family
+		}
+		if a.No != b.No {
+			return a.No < b.No
+		}
+		return a.Word < b.Word
+	})
+	var cur *wordRange
+	for _, f := range sorted {
+		start := int(f.addr.Word)
+		end := start + f.words
+		if cur != nil {
+			first := cur.fields[0].addr
+			if first.Family == f.addr.Family && first.No == f.addr.No && start <= cur.end && end-cur.start <= 0x200 {
+				if end > cur.end {
+					cur.end = end
+				}
+				cur.fields = append(cur.fields, f)
+				continue
+			}
+		}
+		cur = &wordRange{start: start, end: end, fields: []*structField{f}}
+		ranges = append(ranges, cur)
+	}
+	return
+}
+
+// structFields 解析结构体中带标签的字段
+func structFields(v interface{}) (fields []*structField, err error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		err = fmt.Errorf("toyopuc: '%T' must be a non-nil pointer to a struct", v)
+		return
+	}
+	rv = rv.Elem()
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		tag, ok := sf.Tag.Lookup(structTagName)
+		if !ok || tag == "-" {
+			continue
+		}
+		var f *structField
+		if f, err = parseStructField(sf, rv.Field(i), tag); err != nil {
+			return
+		}
+		fields = append(fields, f)
+	}
+	return
+}
+
+// parseStructField 解析字段标签
+func parseStructField(sf reflect.StructField, value reflect.Value, tag string) (f *structField, err error) {
+	parts := strings.Split(tag, ",")
+	addr, err := ParseAddress(parts[0])
+	if err != nil {
+		err = fmt.Errorf("toyopuc: field '%v': %v", sf.Name, err)
+		return
+	}
+	if !value.CanSet() {
+		err = fmt.Errorf("toyopuc: field '%v' is not settable", sf.Name)
+		return
+	}
+	f = &structField{name: sf.Name, value: value, addr: addr, words: 1}
+	for _, p := range parts[1:] {
+		p = strings.TrimSpace(p)
+		switch p {
+		case "":
+		case "cdab", "CDAB", "abcd", "ABCD":
+			f.order, _ = ParseWordOrder(p)
+		default:
+			if kind, e := ParseDataType(p); e == nil {
+				f.kind = kind
+				break
+			}
+			n, e := strconv.Atoi(p)
+			if e != nil || n < 1 {
+				err = fmt.Errorf("toyopuc: field '%v' unknown tag option '%v'", sf.Name, p)
+				return
+			}
+			f.words = n
+		}
+	}
+	if f.kind == "" {
+		f.kind = inferFieldKind(addr, value.Kind())
+	}
+	// 类型与地址、字段的匹配
+	var ok bool
+	switch f.kind {
+	// 整数字段必须能容纳该类型的全部取值
+	case TypeBool:
+		ok = addr.Unit == UnitBit && value.Kind() == reflect.Bool
+	case TypeUint8:
+		ok = addr.Unit == UnitByte && isUintKind(value.Kind()) && f.fits()
+	case TypeUint16, TypeBCD:
+		ok = addr.Unit == UnitWord && (isUintKind(value.Kind()) || isIntKind(value.Kind())) && f.fits()
+		f.words = 1
+	case TypeInt16:
+		ok = addr.Unit == UnitWord && isIntKind(value.Kind()) && f.fits()
+		f.words = 1
+	case TypeUint32:
+		ok = addr.Unit == UnitWord && (isUintKind(value.Kind()) || isIntKind(value.Kind())) && f.fits()
+		f.words = 2
+	case TypeInt32:
+		ok = addr.Unit == UnitWord && isIntKind(value.Kind()) && f.fits()
+		f.words = 2
+	case TypeFloat32:
+		ok = addr.Unit == UnitWord && (value.Kind() == reflect.Float32 || value.Kind() == reflect.Float64)
+		f.words = 2
+	case TypeString:
+		ok = addr.Unit == UnitWord && value.Kind() == reflect.String
+	}
+	if !ok {
+		err = fmt.Errorf("toyopuc: field '%v' of type '%v' cannot be mapped to '%v' as '%v'", sf.Name, value.Type(), addr, f.kind)
+		return
+	}
+	return
+}
+
+// inferFieldKind 未指定类型时按地址与字段类型推断
+func inferFieldKind(addr *Address, kind reflect.Kind) DataType {
+	switch addr.Unit {
+	case UnitBit:
+		return TypeBool
+	case UnitByte:
+		return TypeUint8
+	}
+	switch kind {
+	case reflect.Int16, reflect.Int, reflect.Int8:
+		return TypeInt16
+	case reflect.Uint32, reflect.Uint64:
+		return TypeUint32
+	case reflect.Int32, reflect.Int64:
+		return TypeInt32
+	case reflect.Float32, reflect.Float64:
+		return TypeFloat32
+	case reflect.String:
+		return TypeString
+	}
+	return TypeUint16
+}
+
+// decode 将读出的数据写入字段
+// data 格式与 Read 相同
+func (f *structField) decode(data []byte) (err error) {
+	switch f.kind {
+	case TypeBool:
+		f.value.SetBool(data[0] != 0)
+	case TypeUint8:
+		f.value.SetUint(uint64(data[0]))
+	case TypeUint16:
+		f.setInteger(int64(DecodeUint16s(data)[0]))
+	case TypeInt16:
+		f.value.SetInt(int64(DecodeInt16s(data)[0]))
+	case TypeUint32:
+		var values []uint32
+		if values, err = DecodeUint32s(data, f.order); err != nil {
+			return fmt.Errorf("toyopuc: field '%v': %w", f.name, err)
+		}
+		f.setInteger(int64(values[0]))
+	case TypeInt32:
+		var values []int32
+		if values, err = DecodeInt32s(data, f.order); err != nil {
+			return fmt.Errorf("toyopuc: field '%v': %w", f.name, err)
+		}
+		f.value.SetInt(int64(values[0]))
+	case TypeFloat32:
+		var values []float32
+		if values, err = DecodeFloat32s(data, f.order); err != nil {
+			return fmt.Errorf("toyopuc: field '%v': %w", f.name, err)
+		}
+		f.value.SetFloat(float64(values[0]))
+	case TypeBCD:
+		var values []uint16
+		if values, err = DecodeBCDs(data); err != nil {
+			return fmt.Errorf("toyopuc: field '%v': %v", f.name, err)
+		}
+		f.setInteger(int64(values[0]))
+	case TypeString:
+		var s string
+		if s, err = DecodeString(data); err != nil {
+			return fmt.Errorf("toyopuc: field '%v': %v", f.name, err)
+		}
+		f.value.SetString(s)
+	}
+	return
+}
+
+// encode 字段值转写入数据
+// 字 CDAB，位 1 ON 0 OFF
+func (f *structField) encode() (data []byte, err error) {
+	if !f.inRange() {
+		return nil, fmt.Errorf("toyopuc: field '%v' value '%v' is out of range for '%v'", f.name, f.value, f.kind)
+	}
+	var words []uint16
+	switch f.kind {
+	case TypeBool:
+		return []byte{boolToByte(f.value.Bool())}, nil
+	case TypeUint8:
+		return []byte{byte(f.value.Uint())}, nil
+	case TypeUint16:
+		words = []uint16{uint16(f.integer())}
+	case TypeInt16:
+		words = EncodeInt16s([]int16{int16(f.value.Int())})
+	case TypeUint32:
+		words = EncodeUint32s([]uint32{uint32(f.integer())}, f.order)
+	case TypeInt32:
+		words = EncodeInt32s([]int32{int32(f.value.Int())}, f.order)
+	case TypeFloat32:
+		words = EncodeFloat32s([]float32{float32(f.value.Float())}, f.order)
+	case TypeBCD:
+		if words, err = EncodeBCDs([]uint16{uint16(f.integer())}); err != nil {
+			return nil, fmt.Errorf("toyopuc: field '%v': %v", f.name, err)
+		}
+	case TypeString:
+		if words, err = EncodeString(f.value.String(), f.words); err != nil {
+			return nil, fmt.Errorf("toyopuc: field '%v': %v", f.name, err)
+		}
+	}
+	return WordBytes(words), nil
+}
+
+// setInteger 整数写入有符号或无符号字段
+func (f *structField) setInteger(n int64) {
+	if isIntKind(f.value.Kind()) {
+		f.value.SetInt(n)
+	} else {
+		f.value.SetUint(uint64(n))
+	}
+}
+
+// integer 读取有符号或无符号字段
+func (f *structField) integer() int64 {
+	if isIntKind(f.value.Kind()) {
+		return f.value.Int()
+	}
+	return int64(f.value.Uint())
+}
+
+// fits 字段能否容纳该类型的全部取值
+func (f *structField) fits() bool {
+	min, max, _ := integerRange(f.kind)
+	if isIntKind(f.value.Kind()) {
+		return !f.value.OverflowInt(min) && !f.value.OverflowInt(max)
+	}
+	return min >= 0 && !f.value.OverflowUint(uint64(max))
+}
+
+// inRange 字段值是否在该类型的取值范围内
+func (f *structField) inRange() bool {
+	min, max, ok := integerRange(f.kind)
+	if !ok {
+		return true
+	}
+	if isIntKind(f.value.Kind()) {
+		n := f.value.Int()
+		return n >= min && n <= max
+	}
+	return f.value.Uint() <= uint64(max)
+}
+
+// integerRange 整数类型的取值范围
+func integerRange(kind DataType) (min, max int64, ok bool) {
+	switch kind {
+	case TypeUint8:
+		return 0, 0xFF, true
+	case TypeUint16:
+		return 0, 0xFFFF, true
+	case TypeBCD:
+		return 0, 9999, true
+	case TypeInt16:
+		return -0x8000, 0x7FFF, true
+	case TypeUint32:
+		return 0, 0xFFFFFFFF, true
+	case TypeInt32:
+		return -0x80000000, 0x7FFFFFFF, true
+	}
+	return
+}
+
+// isBitDevice 是否为位设备的位访问
+func isBitDevice(a *Address) bool {
+	_, ok := a.BitAddress()
+	return ok
+}
+
+func isUintKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+func isIntKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
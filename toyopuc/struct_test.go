@@ -0,0 +1,240 @@
+package toyopuc
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestStructFields(t *testing.T) {
+	var v struct {
+		Word    uint16  `toyopuc:"D0100"`
+		Signed  int16   `toyopuc:"D0101"`
+		Count   int32   `toyopuc:"D0102,int32,abcd"`
+		Total   uint32  `toyopuc:"D0104"`
+		Speed   float64 `toyopuc:"D0106, float32 , CDAB"`
+		Code    int     `toyopuc:"D0108,bcd"`
+		Name    string  `toyopuc:"D0110,string,10"`
+		Running bool    `toyopuc:"M0010.3"`
+		Flag    bool    `toyopuc:"D0100.F"`
+		Low     uint8   `toyopuc:"D0120L"`
+		Skipped uint16  `toyopuc:"-"`
+		Untaged uint16
+	}
+	fields, err := structFields(&v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"Word D0100 uint16 cdab 1",
+		"Signed D0101 int16 cdab 1",
+		"Count D0102 int32 abcd 2",
+		"Total D0104 uint32 cdab 2",
+		"Speed D0106 float32 cdab 2",
+		"Code D0108 bcd cdab 1",
+		"Name D0110 string cdab 10",
+		"Running M0013 bool cdab 1",
+		"Flag D0100.F bool cdab 1",
+		"Low D0120L uint8 cdab 1",
+	}
+	var got []string
+	for _, f := range fields {
+		got = append(got, fmt.Sprintf("%v %v %v %v %v", f.name, f.addr, f.kind, f.order, f.words))
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("fields =\n%v\nwant\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestStructFieldErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{name: "not a pointer", v: struct{}{}, want: "pointer to a struct"},
+		{name: "nil pointer", v: (*struct{})(nil), want: "pointer to a struct"},
+		{name: "pointer to int", v: new(int), want: "pointer to a struct"},
+		{name: "bad address", v: &struct {
+			A uint16 `toyopuc:"Q0100"`
+		}{}, want: "field 'A'"},
+		{name: "unknown option", v: &struct {
+			A uint16 `toyopuc:"D0100,uint64"`
+		}{}, want: "unknown tag option 'uint64'"},
+		{name: "zero words", v: &struct {
+			A string `toyopuc:"D0100,string,0"`
+		}{}, want: "unknown tag option '0'"},
+		{name: "unexported", v: &struct {
+			a uint16 `toyopuc:"D0100"`
+		}{}, want: "not settable"},
+		{name: "bool on word", v: &struct {
+			A bool `toyopuc:"D0100"`
+		}{}, want: "cannot be mapped"},
+		{name: "uint16 on bit", v: &struct {
+			A uint16 `toyopuc:"M0010.3,uint16"`
+		}{}, want: "cannot be mapped"},
+		{name: "uint8 on word", v: &struct {
+			A uint8 `toyopuc:"D0100,uint8"`
+		}{}, want: "cannot be mapped"},
+		{name: "signed uint8", v: &struct {
+			A int8 `toyopuc:"D0100L"`
+		}{}, want: "cannot be mapped"},
+		{name: "int16 in unsigned field", v: &struct {
+			A uint16 `toyopuc:"D0100,int16"`
+		}{}, want: "cannot be mapped"},
+		{name: "int32 in unsigned field", v: &struct {
+			A uint32 `toyopuc:"D0100,int32"`
+		}{}, want: "cannot be mapped"},
+		{name: "float32 in int field", v: &struct {
+			A int `toyopuc:"D0100,float32"`
+		}{}, want: "cannot be mapped"},
+		{name: "string in int field", v: &struct {
+			A int `toyopuc:"D0100,string"`
+		}{}, want: "cannot be mapped"},
+		{name: "string on byte", v: &struct {
+			A string `toyopuc:"D0100L"`
+		}{}, want: "cannot be mapped"},
+		{name: "uint16 in uint8 field", v: &struct {
+			A uint8 `toyopuc:"D0100"`
+		}{}, want: "cannot be mapped"},
+		{name: "int16 in int8 field", v: &struct {
+			A int8 `toyopuc:"D0100"`
+		}{}, want: "cannot be mapped"},
+		{name: "uint16 in int16 field", v: &struct {
+			A int16 `toyopuc:"D0100,uint16"`
+		}{}, want: "cannot be mapped"},
+		{name: "bcd in uint8 field", v: &struct {
+			A uint8 `toyopuc:"D0100,bcd"`
+		}{}, want: "cannot be mapped"},
+		{name: "uint32 in uint16 field", v: &struct {
+			A uint16 `toyopuc:"D0100,uint32"`
+		}{}, want: "cannot be mapped"},
+		{name: "uint32 in int32 field", v: &struct {
+			A int32 `toyopuc:"D0100,uint32"`
+		}{}, want: "cannot be mapped"},
+		{name: "int32 in int16 field", v: &struct {
+			A int16 `toyopuc:"D0100,int32"`
+		}{}, want: "cannot be mapped"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := structFields(tt.v)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("structFields error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeWordRanges(t *testing.T) {
+	field := func(address string, words int) *structField {
+		addr, err := ParseAddress(address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &structField{name: address, addr: addr, words: words}
+	}
+	tests := []struct {
+		name   string
+		fields []*structField
+		want   []string
+	}{
+		{
+			name:   "adjacent",
+			fields: []*structField{field("D0102", 2), field("D0100", 1), field("D0101", 1)},
+			want:   []string{"D0100+4 D0100 D0101 D0102"},
+		},
+		{
+			name:   "gap",
+			fields: []*structField{field("D0100", 2), field("D0103", 1)},
+			want:   []string{"D0100+2 D0100", "D0103+1 D0103"},
+		},
+		{
+			name:   "overlap",
+			fields: []*structField{field("D0100", 10), field("D0104", 2)},
+			want:   []string{"D0100+10 D0100 D0104"},
+		},
+		{
+			name:   "programs",
+			fields: []*structField{field("P1-D0100", 1), field("D0101", 1), field("P2-D0101", 1), field("D0100", 1)},
+			want:   []string{"D0100+2 D0100 D0101", "P1-D0100+1 P1-D0100", "P2-D0101+1 P2-D0101"},
+		},
+		{
+			name:   "frame limit",
+			fields: []*structField{field("D0000", 0x100), field("D0100", 0x100), field("D0200", 1)},
+			want:   []string{"D0000+512 D0000 D0100", "D0200+1 D0200"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, r := range mergeWordRanges(tt.fields) {
+				s := fmt.Sprintf("%v+%v", r.addr(), r.quantity())
+				for _, f := range r.fields {
+					s += " " + f.name
+				}
+				got = append(got, s)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("ranges =\n%v\nwant\n%v", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestStructEncodeRange(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		ok   bool
+	}{
+		{name: "uint16 max", v: &struct {
+			A uint32 `toyopuc:"D0100,uint16"`
+		}{A: 0xFFFF}, ok: true},
+		{name: "uint16 overflow", v: &struct {
+			A uint32 `toyopuc:"D0100,uint16"`
+		}{A: 0x10000}},
+		{name: "uint16 negative", v: &struct {
+			A int `toyopuc:"D0100,uint16"`
+		}{A: -1}},
+		{name: "int16 min", v: &struct {
+			A int32 `toyopuc:"D0100,int16"`
+		}{A: -0x8000}, ok: true},
+		{name: "int16 overflow", v: &struct {
+			A int32 `toyopuc:"D0100,int16"`
+		}{A: 0x8000}},
+		{name: "uint32 overflow", v: &struct {
+			A uint64 `toyopuc:"D0100,uint32"`
+		}{A: 1 << 32}},
+		{name: "int32 overflow", v: &struct {
+			A int64 `toyopuc:"D0100,int32"`
+		}{A: -1<<31 - 1}},
+		{name: "uint8 overflow", v: &struct {
+			A uint16 `toyopuc:"D0100L"`
+		}{A: 0x100}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, err := structFields(tt.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = fields[0].encode()
+			if (err == nil) != tt.ok {
+				t.Errorf("encode error = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestMergeWordRangesEnd(t *testing.T) {
+	// 结束地址为 0x10000 时不能回绕为 0
+	fields := []*structField{
+		{name: "A", addr: &Address{Device: "D", Unit: UnitWord, Word: 0xFFFC}, words: 2},
+		{name: "B", addr: &Address{Device: "D", Unit: UnitWord, Word: 0xFFFE}, words: 2},
+	}
+	ranges := mergeWordRanges(fields)
+	if len(ranges) != 1 || ranges[0].quantity() != 4 || len(ranges[0].fields) != 2 {
+		t.Fatalf("ranges = %v, want one range of 4 words", len(ranges))
+	}
+}
@@ -0,0 +1,203 @@
+package toyopuc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// 连续读出失败后的最大轮询间隔
+	subscribeMaxBackoff = 30 * time.Second
+	// 未指定回调时通知通道的缓冲
+	subscribeBuffer = 64
+)
+
+// Quality 数据质量
+type Quality int
+
+const (
+	// 读出成功
+	QualityGood Quality = iota
+	// 读出失败 Value 为最后一次读出成功的值 (可能为nil)
+	QualityBad
+)
+
+// String 数据质量名称
+func (q Quality) String() string {
+	switch q {
+	case QualityGood:
+		return "good"
+	case QualityBad:
+		return "bad"
+	}
+	return "unknown"
+}
+
+// Update 变化通知
+type Update struct {
+	// 订阅的点 与 Subscribe 的 tags 中的第 Index 个相同
+	Tag   Tag
+	Index int
+	// 格式与 Read 相同
+	Value []byte
+	// 读出的时间
+	Time    time.Time
+	Quality Quality
+	// QualityBad 时的错误
+	Err error
+}
+
+// Subscription 订阅 按间隔轮询并通知变化的值
+type Subscription struct {
+	// 未指定回调时的通知通道 Stop 后关闭
+	C <-chan Update
+
+	tags     []Tag
+	plan     *ReadPlan
+	interval time.Duration
+	handler  func(Update)
+	client   Client
+	cancel   context.CancelFunc
+	done     chan struct{}
+	once     sync.Once
+
+	// 每个点最后通知的值与质量
+	values  [][]byte
+	quality []Quality
+	// 第一次读出之前
+	first bool
+}
+
+// Subscribe 订阅 每隔 interval 批量读出 tags，只通知变化的值
+// 第一次读出后通知全部点，读出失败时每个点通知一次 QualityBad，恢复后重新通知
+// handler 在轮询的 goroutine 中调用，为nil时通过 Subscription.C 通知
+// PLC 响应慢时延长间隔，使轮询不超过一半的时间，连续失败时间隔加倍直到 30s
+// 不同间隔的点分别订阅
+func (toyopuc *client) Subscribe(tags []Tag, interval time.Duration, handler func(Update)) (sub *Subscription, err error) {
+	if interval <= 0 {
+		err = fmt.Errorf("toyopuc: subscribe interval '%v' must be positive", interval)
+		return
+	}
+	plan, err := PlanRead(tags)
+	if err != nil {
+		return
+	}
+	parent := context.Background()
+	if toyopuc.ctx != nil {
+		parent = toyopuc.ctx
+	}
+	ctx, cancel := context.WithCancel(parent)
+	sub = &Subscription{
+		tags:     append([]Tag(nil), tags...),
+		plan:     plan,
+		interval: interval,
+		handler:  handler,
+		client:   toyopuc.WithContext(ctx),
+		cancel:   cancel,
+		done:     make(chan struct{}),
+		values:   make([][]byte, len(tags)),
+		quality:  make([]Quality, len(tags)),
+		first:    true,
+	}
+	if handler == nil {
+		c := make(chan Update, subscribeBuffer)
+		sub.C = c
+		sub.handler = func(u Update) {
+			select {
+			case c <- u:
+			case <-ctx.Done():
+			}
+		}
+		go func() {
+			<-sub.done
+			close(c)
+		}()
+	}
+	go sub.run(ctx)
+	return
+}
+
+// Stop 停止轮询 中断正在进行的读出并等待轮询结束
+// 不能在 handler 中调用
+func (s *Subscription) Stop() {
+	s.once.Do(s.cancel)
+	<-s.done
+}
+
+// run 轮询
+func (s *Subscription) run(ctx context.Context) {
+	defer close(s.done)
+
+	failures := 0
+	for {
+		start := time.Now()
+		results, err := s.client.ExecutePlan(s.plan)
+		if ctx.Err() != nil {
+			return
+		}
+		elapsed := time.Since(start)
+		s.deliver(start, results, err)
+
+		wait := s.interval - elapsed
+		if err != nil {
+			failures++
+			wait = s.backoff(failures)
+		} else {
+			failures = 0
+			// 读出时间超过间隔的一半时 等待与读出相同的时间
+			if wait < elapsed {
+				wait = elapsed
+			}
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// backoff 连续失败 n 次后的间隔 间隔本身超过 30s 时不加倍
+func (s *Subscription) backoff(failures int) time.Duration {
+	wait := s.interval
+	if wait >= subscribeMaxBackoff {
+		return wait
+	}
+	for k := 0; k < failures; k++ {
+		wait *= 2
+		if wait >= subscribeMaxBackoff {
+			return subscribeMaxBackoff
+		}
+	}
+	return wait
+}
+
+// deliver 通知变化的值与质量
+func (s *Subscription) deliver(t time.Time, results [][]byte, err error) {
+	for k, tag := range s.tags {
+		u := Update{Tag: tag, Index: k, Time: t}
+		if err != nil {
+			if !s.first && s.quality[k] == QualityBad {
+				continue
+			}
+			u.Value = s.values[k]
+			u.Quality = QualityBad
+			u.Err = err
+		} else {
+			if !s.first && s.quality[k] == QualityGood && bytes.Equal(s.values[k], results[k]) {
+				continue
+			}
+			u.Value = results[k]
+			u.Quality = QualityGood
+			s.values[k] = results[k]
+		}
+		s.quality[k] = u.Quality
+		s.handler(u)
+	}
+	s.first = false
+}
@@ -0,0 +1,28 @@
+package toyopuc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubscriptionBackoff(t *testing.T) {
+	tests := []struct {
+		interval time.Duration
+		failures int
+		want     time.Duration
+	}{
+		{interval: 100 * time.Millisecond, failures: 1, want: 200 * time.Millisecond},
+		{interval: 100 * time.Millisecond, failures: 2, want: 400 * time.Millisecond},
+		{interval: 100 * time.Millisecond, failures: 8, want: 25600 * time.Millisecond},
+		{interval: 100 * time.Millisecond, failures: 9, want: subscribeMaxBackoff},
+		{interval: 100 * time.Millisecond, failures: 1000, want: subscribeMaxBackoff},
+		{interval: 20 * time.Second, failures: 1, want: subscribeMaxBackoff},
+		{interval: time.Minute, failures: 1, want: time.Minute},
+	}
+	for _, tt := range tests {
+		s := &Subscription{interval: tt.interval}
+		if got := s.backoff(tt.failures); got != tt.want {
+			t.Errorf("backoff(%v) with interval %v = %v, want %v", tt.failures, tt.interval, got, tt.want)
+		}
+	}
+}
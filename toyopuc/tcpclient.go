@@ -1,6 +1,7 @@
 package toyopuc
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -19,8 +20,36 @@ const (
 	// Default TCP timeout is not set
 	tcpTimeout     = 10 * time.Second
 	tcpIdleTimeout = 60 * time.Second
+	// 重连间隔 失败后加倍直到最大值
+	tcpReconnectBackoff    = 500 * time.Millisecond
+	tcpMaxReconnectBackoff = 30 * time.Second
 )
 
+// ConnState 连接状态
+type ConnState int
+
+const (
+	// 未连接 或空闲超时、调用 Close 关闭
+	ConnClosed ConnState = iota
+	// 连接已建立
+	ConnConnected
+	// 连接断开或连接失败 (PLC 离线)
+	ConnLost
+)
+
+// String 连接状态名称
+func (s ConnState) String() string {
+	switch s {
+	case ConnClosed:
+		return "closed"
+	case ConnConnected:
+		return "connected"
+	case ConnLost:
+		return "lost"
+	}
+	return "unknown"
+}
+
 // TCPClientHandler implements Packager and Transporter interface.
 type TCPClientHandler struct {
 	tcpPackager
@@ -33,6 +62,8 @@ func NewTCPClientHandler(address string) *TCPClientHandler {
 	h.Address = address
 	h.Timeout = tcpTimeout
 	h.IdleTimeout = tcpIdleTimeout
+	h.ReconnectBackoff = tcpReconnectBackoff
+	h.MaxReconnectBackoff = tcpMaxReconnectBackoff
 	h.RequestFT = RequestFTByte
 	h.ResponseFTByte = ResponseFTByte
 	return h
@@ -75,13 +106,13 @@ func (toyopuc *tcpPackager) Encode(pdu *ProtocolDataUnit) (adu []byte, err error
 func (toyopuc *tcpPackager) Verify(aduRequest []byte, aduResponse []byte) (err error) {
 	// 校验头
 	if aduResponse[0] != toyopuc.ResponseFTByte {
-		err = fmt.Errorf("toyopuc: FT error")
+		err = fmt.Errorf("%w: FT '%#x'", ErrInvalidFrame, aduResponse[0])
 		return
 	}
 	// 校验长度
 	length := int(binary.LittleEndian.Uint16(aduResponse[2:4]))
 	if length != len(aduResponse[tcpHeaderSize:]) {
-		err = fmt.Errorf("toyopuc: response data length error")
+		err = fmt.Errorf("%w: response data length '%v' does not match header '%v'", ErrLength, len(aduResponse[tcpHeaderSize:]), length)
 		return
 	}
 	return
@@ -116,63 +147,121 @@ type tcpTransporter struct {
 	IdleTimeout time.Duration
 	// Transmission logger
 	Logger *log.Logger
+	// 连接失败后的重连间隔 每次失败加倍 0 为每次请求都重新连接
+	ReconnectBackoff time.Duration
+	// 重连间隔的最大值
+	MaxReconnectBackoff time.Duration
+	// 连接状态变化时调用 在请求的调用者 goroutine 中执行
+	// 调用时不持有锁 回调中可以发送请求
+	OnStateChange func(state ConnState, err error)
 
+	// 请求的发送权 等待时可以被 ctx 中断
+	sending sendLock
 	// TCP connection
 	mu           sync.Mutex
 	conn         net.Conn
 	closeTimer   *time.Timer
 	lastActivity time.Time
+	// 连接状态
+	state ConnState
+	// 连续连接失败的次数与下次允许连接的时间
+	failures int
+	nextDial time.Time
+	lastErr  error
+	// 待通知的状态变化
+	events []connEvent
+}
+
+// connEvent 状态变化
+type connEvent struct {
+	state ConnState
+	err   error
 }
 
 // Send sends data to server and ensures response length is greater than header length.
 // 发送
+// 读写出错时关闭连接，下次请求时重新连接
 func (toyopuc *tcpTransporter) Send(aduRequest []byte) (aduResponse []byte, err error) {
+	return toyopuc.SendContext(context.Background(), aduRequest)
+}
+
+// SendContext 与 Send 相同，ctx 取消或超过期限时中断正在进行的读写
+// 中断后关闭连接，避免迟到的响应与下一个请求错位
+func (toyopuc *tcpTransporter) SendContext(ctx context.Context, aduRequest []byte) (aduResponse []byte, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	// 排在慢请求之后时同样可以被 ctx 中断
+	if err = toyopuc.sending.lock(ctx); err != nil {
+		return
+	}
+	// 释放发送权之后再通知 回调中可以发送请求
+	defer toyopuc.notify()
+	defer toyopuc.sending.unlock()
+	return toyopuc.send(ctx, aduRequest)
+}
+
+// send 发送请求 调用者持有发送权并在之后通知状态变化
+func (toyopuc *tcpTransporter) send(ctx context.Context, aduRequest []byte) (aduResponse []byte, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
 	toyopuc.mu.Lock()
 	defer toyopuc.mu.Unlock()
 
 	// Establish a new connection if not connected
-	if err = toyopuc.connect(); err != nil {
+	if err = toyopuc.connect(ctx); err != nil {
 		return
 	}
 	// Set timer to close when idle
 	toyopuc.lastActivity = time.Now()
 	toyopuc.startCloseTimer()
 	// Set write and read timeout
+	// ctx 的期限更早时使用 ctx 的期限
 	var timeout time.Time
 	if toyopuc.Timeout > 0 {
 		timeout = toyopuc.lastActivity.Add(toyopuc.Timeout)
 	}
+	if deadline, ok := ctx.Deadline(); ok && (timeout.IsZero() || deadline.Before(timeout)) {
+		timeout = deadline
+	}
 	if err = toyopuc.conn.SetDeadline(timeout); err != nil {
+		err = toyopuc.broken(ctx, err)
 		return
 	}
+	// 取消时设置已过期的期限 中断阻塞的读写
+	defer interruptOnDone(ctx, toyopuc.conn.SetDeadline)()
 	// Send data
 	toyopuc.logf("toyopuc: sending % x", aduRequest)
 	if _, err = toyopuc.conn.Write(aduRequest); err != nil {
+		err = toyopuc.broken(ctx, err)
 		return
 	}
 
 	// Read header first
+	// 超时后迟到的响应会与下一个请求错位 同样关闭连接
 	var data [tcpMaxLength]byte
 	if _, err = io.ReadFull(toyopuc.conn, data[:tcpHeaderSize]); err != nil {
+		err = toyopuc.broken(ctx, err)
 		return
 	}
 	// Read length, ignore transaction & protocol id (4 bytes)
+	// 长度错误时无法确定帧的边界 剩余的数据会与下一个响应错位 同样关闭连接
 	length := int(binary.LittleEndian.Uint16(data[2:]))
 	if length <= 0 {
-		toyopuc.flush(data[:])
-		err = fmt.Errorf("toyopuc: length in response header '%v' must not be zero", length)
+		err = toyopuc.broken(ctx, fmt.Errorf("%w: length in response header '%v' must not be zero", ErrLength, length))
 		return
 	}
 	// length := len(data)
-	if length > (tcpMaxLength - (tcpHeaderSize - 1)) {
-		toyopuc.flush(data[:])
-		err = fmt.Errorf("toyopuc: length in response header '%v' must not greater than '%v'", length, tcpMaxLength-tcpHeaderSize+1)
+	if length > tcpMaxLength-tcpHeaderSize {
+		err = toyopuc.broken(ctx, fmt.Errorf("%w: length in response header '%v' must not greater than '%v'", ErrLength, length, tcpMaxLength-tcpHeaderSize))
 		return
 	}
 	// Skip unit id
 	// 读取不到足够数量 则报timeout
 	length += tcpHeaderSize
 	if _, err = io.ReadFull(toyopuc.conn, data[tcpHeaderSize:length]); err != nil {
+		err = toyopuc.broken(ctx, err)
 		return
 	}
 	aduResponse = data[:length]
@@ -180,27 +269,162 @@ func (toyopuc *tcpTransporter) Send(aduRequest []byte) (aduResponse []byte, err
 	return
 }
 
+// sendLock 请求的发送权
+// sync.Mutex 的 Lock 不能中断，排在慢请求之后的调用者只能等到它超时
+type sendLock struct {
+	once sync.Once
+	ch   chan struct{}
+}
+
+// lock 获取发送权 ctx 取消或超过期限时返回 ctx 的错误
+func (l *sendLock) lock(ctx context.Context) error {
+	l.once.Do(func() { l.ch = make(chan struct{}, 1) })
+	select {
+	case l.ch <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *sendLock) unlock() {
+	<-l.ch
+}
+
+// interruptOnDone ctx 取消时设置已过期的期限 中断阻塞的读写
+// 返回的 stop 在读写结束后调用，等待监视的 goroutine 退出
+func interruptOnDone(ctx context.Context, setDeadline func(t time.Time) error) (stop func()) {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			setDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+		<-exited
+	}
+}
+
+// contextError ctx 取消或已超过期限时返回 ctx 的错误，否则返回 err
+func contextError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+// broken 读写出错后关闭连接
+// ctx 取消或超过期限时返回 ctx 的错误，连接正常关闭而不是断开
+// Caller must hold the mutex before calling this method.
+func (toyopuc *tcpTransporter) broken(ctx context.Context, err error) error {
+	e := contextError(ctx, nil)
+	if e == nil {
+		toyopuc.lost(err)
+		return err
+	}
+	toyopuc.logf("toyopuc: closing connection due to %v", err)
+	toyopuc.close()
+	return e
+}
+
 // Connect establishes a new connection to the address in Address.
 // Connect and Close are exported so that multiple requests can be done with one session
 func (toyopuc *tcpTransporter) Connect() error {
+	defer toyopuc.notify()
 	toyopuc.mu.Lock()
 	defer toyopuc.mu.Unlock()
 
-	return toyopuc.connect()
+	return toyopuc.connect(context.Background())
 }
 
-func (toyopuc *tcpTransporter) connect() error {
-	if toyopuc.conn == nil {
-		dialer := net.Dialer{Timeout: toyopuc.Timeout}
-		conn, err := dialer.Dial("tcp", toyopuc.Address)
-		if err != nil {
-			return err
+// connect 连接失败后在重连间隔内直接返回上次的错误
+func (toyopuc *tcpTransporter) connect(ctx context.Context) error {
+	if toyopuc.conn != nil {
+		return nil
+	}
+	if wait := time.Until(toyopuc.nextDial); toyopuc.failures > 0 && wait > 0 {
+		return fmt.Errorf("toyopuc: '%v' is offline, reconnecting in %v: %w", toyopuc.Address, wait.Round(time.Millisecond), toyopuc.lastErr)
+	}
+	dialer := net.Dialer{Timeout: toyopuc.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", toyopuc.Address)
+	if err != nil {
+		// 取消不是连接失败
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
-		toyopuc.conn = conn
+		toyopuc.failures++
+		toyopuc.lastErr = err
+		toyopuc.nextDial = time.Now().Add(toyopuc.backoff())
+		toyopuc.setState(ConnLost, err)
+		return err
 	}
+	toyopuc.conn = conn
+	toyopuc.failures = 0
+	toyopuc.lastErr = nil
+	toyopuc.setState(ConnConnected, nil)
 	return nil
 }
 
+// backoff 第 n 次连接失败后的重连间隔
+func (toyopuc *tcpTransporter) backoff() time.Duration {
+	d := toyopuc.ReconnectBackoff
+	if d <= 0 {
+		return 0
+	}
+	for k := 1; k < toyopuc.failures; k++ {
+		d *= 2
+		if toyopuc.MaxReconnectBackoff > 0 && d >= toyopuc.MaxReconnectBackoff {
+			return toyopuc.MaxReconnectBackoff
+		}
+	}
+	return d
+}
+
+// lost 连接断开 (EOF、复位、帧中超时)，关闭连接以便下次请求时重新连接
+// Caller must hold the mutex before calling this method.
+func (toyopuc *tcpTransporter) lost(err error) {
+	toyopuc.logf("toyopuc: closing broken connection: %v", err)
+	if toyopuc.conn != nil {
+		toyopuc.conn.Close()
+		toyopuc.conn = nil
+	}
+	toyopuc.setState(ConnLost, err)
+}
+
+// setState 记录状态变化 解锁后由 notify 通知
+func (toyopuc *tcpTransporter) setState(state ConnState, err error) {
+	if toyopuc.state == state {
+		return
+	}
+	toyopuc.state = state
+	if toyopuc.OnStateChange != nil {
+		toyopuc.events = append(toyopuc.events, connEvent{state: state, err: err})
+	}
+}
+
+// notify 调用 OnStateChange 不能持有锁 回调中可以继续发送请求
+func (toyopuc *tcpTransporter) notify() {
+	toyopuc.mu.Lock()
+	events := toyopuc.events
+	toyopuc.events = nil
+	toyopuc.mu.Unlock()
+
+	for _, e := range events {
+		toyopuc.OnStateChange(e.state, e.err)
+	}
+}
+
 func (toyopuc *tcpTransporter) startCloseTimer() {
 	if toyopuc.IdleTimeout <= 0 {
 		return
@@ -214,28 +438,13 @@ func (toyopuc *tcpTransporter) startCloseTimer() {
 
 // Close closes current connection.
 func (toyopuc *tcpTransporter) Close() error {
+	defer toyopuc.notify()
 	toyopuc.mu.Lock()
 	defer toyopuc.mu.Unlock()
 
 	return toyopuc.close()
 }
 
-// flush flushes pending data in the connection,
-// returns io.EOF if connection is closed.
-func (toyopuc *tcpTransporter) flush(b []byte) (err error) {
-	if err = toyopuc.conn.SetReadDeadline(time.Now()); err != nil {
-		return
-	}
-	// Timeout setting will be reset when reading
-	if _, err = toyopuc.conn.Read(b); err != nil {
-		// Ignore timeout error
-		if netError, ok := err.(net.Error); ok && netError.Timeout() {
-			err = nil
-		}
-	}
-	return
-}
-
 func (toyopuc *tcpTransporter) logf(format string, v ...interface{}) {
 	if toyopuc.Logger != nil {
 		toyopuc.Logger.Printf(format, v...)
@@ -247,12 +456,14 @@ func (toyopuc *tcpTransporter) close() (err error) {
 	if toyopuc.conn != nil {
 		err = toyopuc.conn.Close()
 		toyopuc.conn = nil
+		toyopuc.setState(ConnClosed, nil)
 	}
 	return
 }
 
 // closeIdle closes the connection if last activity is passed behind IdleTimeout.
 func (toyopuc *tcpTransporter) closeIdle() {
+	defer toyopuc.notify()
 	toyopuc.mu.Lock()
 	defer toyopuc.mu.Unlock()
 
@@ -0,0 +1,242 @@
+package toyopuc
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	tcpPoolMaxWait             = 10 * time.Second
+	tcpPoolHealthCheckInterval = 10 * time.Second
+)
+
+// TCPPoolHandler implements Packager and Transporter interface.
+// 与同一地址保持多个连接，并发的请求分配到空闲的连接上
+type TCPPoolHandler struct {
+	tcpPackager
+	tcpPool
+}
+
+// NewTCPPoolHandler allocates a new TCPPoolHandler with size connections.
+func NewTCPPoolHandler(address string, size int) *TCPPoolHandler {
+	h := &TCPPoolHandler{}
+	h.Address = address
+	h.Size = size
+	h.Timeout = tcpTimeout
+	h.IdleTimeout = tcpIdleTimeout
+	h.ReconnectBackoff = tcpReconnectBackoff
+	h.MaxReconnectBackoff = tcpMaxReconnectBackoff
+	h.MaxWait = tcpPoolMaxWait
+	h.HealthCheckInterval = tcpPoolHealthCheckInterval
+	h.RequestFT = RequestFTByte
+	h.ResponseFTByte = ResponseFTByte
+	return h
+}
+
+// TCPPoolClient creates TCP client with pooled handler and given connect string.
+func TCPPoolClient(address string, size int) Client {
+	handler := NewTCPPoolHandler(address, size)
+	return NewClient(handler)
+}
+
+// tcpPool implements Transporter interface.
+// 配置在第一次请求时复制到各个连接，之后修改无效
+type tcpPool struct {
+	// Connect string
+	Address string
+	// 连接数
+	Size int
+	// Connect & Read timeout
+	Timeout time.Duration
+	// Idle timeout to close each connection
+	IdleTimeout time.Duration
+	// Transmission logger
+	Logger *log.Logger
+	// 连接失败后的重连间隔 见 TCPClientHandler
+	ReconnectBackoff    time.Duration
+	MaxReconnectBackoff time.Duration
+	// 每个连接的状态变化时调用
+	OnStateChange func(state ConnState, err error)
+	// 等待空闲连接的最长时间 超过时返回 *TimeoutError 0 为不限
+	MaxWait time.Duration
+	// 等待空闲连接的最大请求数 超过时立即返回错误 0 为不限
+	MaxWaiters int
+	// 连接空闲超过该时间后 使用前检查是否已被对方关闭 0 为不检查
+	HealthCheckInterval time.Duration
+
+	once  sync.Once
+	conns []*tcpTransporter
+	mu    sync.Mutex
+	// 空闲的连接 有等待的请求时为空
+	idle []*tcpTransporter
+	// 按先后顺序等待空闲连接的请求
+	waiters []chan *tcpTransporter
+}
+
+// init 创建连接 (未连接) 并放入空闲队列
+func (toyopuc *tcpPool) init() {
+	toyopuc.once.Do(func() {
+		size := toyopuc.Size
+		if size < 1 {
+			size = 1
+		}
+		toyopuc.conns = make([]*tcpTransporter, size)
+		for k := range toyopuc.conns {
+			t := &tcpTransporter{
+				Address:             toyopuc.Address,
+				Timeout:             toyopuc.Timeout,
+				IdleTimeout:         toyopuc.IdleTimeout,
+				Logger:              toyopuc.Logger,
+				ReconnectBackoff:    toyopuc.ReconnectBackoff,
+				MaxReconnectBackoff: toyopuc.MaxReconnectBackoff,
+				OnStateChange:       toyopuc.OnStateChange,
+			}
+			toyopuc.conns[k] = t
+		}
+		toyopuc.idle = append(toyopuc.idle, toyopuc.conns...)
+	})
+}
+
+// Send 使用空闲的连接发送
+func (toyopuc *tcpPool) Send(aduRequest []byte) (aduResponse []byte, err error) {
+	return toyopuc.SendContext(context.Background(), aduRequest)
+}
+
+// SendContext 使用空闲的连接发送 等待空闲连接时同样可以被 ctx 中断
+func (toyopuc *tcpPool) SendContext(ctx context.Context, aduRequest []byte) (aduResponse []byte, err error) {
+	t, err := toyopuc.get(ctx)
+	if err != nil {
+		return
+	}
+	// 取出的连接只由当前请求使用 即持有发送权
+	// 放回连接池之后再通知 回调中可以使用同一个连接发送请求
+	defer t.notify()
+	defer toyopuc.put(t)
+
+	return t.send(ctx, aduRequest)
+}
+
+// get 取出空闲的连接
+// 没有空闲的连接时排队 先到的请求先得到连接
+func (toyopuc *tcpPool) get(ctx context.Context) (t *tcpTransporter, err error) {
+	toyopuc.init()
+	toyopuc.mu.Lock()
+	if len(toyopuc.idle) > 0 {
+		t = toyopuc.idle[0]
+		toyopuc.idle = toyopuc.idle[1:]
+		toyopuc.mu.Unlock()
+		toyopuc.check(t)
+		return
+	}
+	// 排队等待
+	if toyopuc.MaxWaiters > 0 && len(toyopuc.waiters) >= toyopuc.MaxWaiters {
+		toyopuc.mu.Unlock()
+		err = fmt.Errorf("toyopuc: too many requests waiting for a connection to '%v', max '%v'", toyopuc.Address, toyopuc.MaxWaiters)
+		return
+	}
+	ready := make(chan *tcpTransporter, 1)
+	toyopuc.waiters = append(toyopuc.waiters, ready)
+	toyopuc.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if toyopuc.MaxWait > 0 {
+		timer := time.NewTimer(toyopuc.MaxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case t = <-ready:
+		toyopuc.check(t)
+		return
+	case <-timeout:
+		err = &TimeoutError{Err: fmt.Errorf("no idle connection to '%v' within %v", toyopuc.Address, toyopuc.MaxWait)}
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	// 放弃等待 已分配到的连接交给下一个请求
+	toyopuc.mu.Lock()
+	for k, w := range toyopuc.waiters {
+		if w == ready {
+			toyopuc.waiters = append(toyopuc.waiters[:k:k], toyopuc.waiters[k+1:]...)
+			toyopuc.mu.Unlock()
+			return
+		}
+	}
+	toyopuc.mu.Unlock()
+	toyopuc.put(<-ready)
+	return
+}
+
+// put 放回连接 有等待的请求时交给最先等待的请求
+func (toyopuc *tcpPool) put(t *tcpTransporter) {
+	toyopuc.mu.Lock()
+	defer toyopuc.mu.Unlock()
+
+	if len(toyopuc.waiters) > 0 {
+		ready := toyopuc.waiters[0]
+		toyopuc.waiters = toyopuc.waiters[1:]
+		ready <- t
+		return
+	}
+	toyopuc.idle = append(toyopuc.idle, t)
+}
+
+// check 空闲较久的连接在使用前检查，已被关闭的连接移除 下次发送时重新连接
+// 超时或取消的请求已关闭连接，空闲的连接上不会有迟到的响应
+// 读到任何数据都关闭连接，不会有被读掉一部分的帧留给下一个请求
+// 状态变化在请求完成后由 SendContext 通知
+func (toyopuc *tcpPool) check(t *tcpTransporter) {
+	if toyopuc.HealthCheckInterval <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.conn == nil || time.Since(t.lastActivity) < toyopuc.HealthCheckInterval {
+		return
+	}
+	// 已过期的期限不会执行读取 使用很短的期限
+	var b [tcpMaxLength]byte
+	err := t.conn.SetReadDeadline(time.Now().Add(time.Millisecond))
+	if err == nil {
+		var n int
+		n, err = t.conn.Read(b[:])
+		if netError, ok := err.(net.Error); ok && netError.Timeout() {
+			err = nil
+		}
+		// 多余的数据会与下一个响应错位
+		if n > 0 {
+			err = fmt.Errorf("toyopuc: unexpected data % x", b[:n])
+		}
+	}
+	if err != nil {
+		t.lost(err)
+	}
+}
+
+// Connect 建立全部连接
+func (toyopuc *tcpPool) Connect() (err error) {
+	toyopuc.init()
+	for _, t := range toyopuc.conns {
+		if e := t.Connect(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return
+}
+
+// Close 关闭全部连接 正在使用的连接等待请求完成后关闭
+// 之后的请求重新连接
+func (toyopuc *tcpPool) Close() (err error) {
+	toyopuc.init()
+	for _, t := range toyopuc.conns {
+		if e := t.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return
+}
@@ -0,0 +1,113 @@
+package toyopuc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitQueued 等待 n 个请求排队
+func waitQueued(t *testing.T, p *tcpPool, n int) {
+	t.Helper()
+	for k := 0; k < 100; k++ {
+		p.mu.Lock()
+		queued := len(p.waiters)
+		p.mu.Unlock()
+		if queued == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("%v requests are not queued", n)
+}
+
+func TestPoolFIFO(t *testing.T) {
+	p := &tcpPool{Size: 1}
+	conn, err := p.get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := make(chan string, 2)
+	for k, name := range []string{"first", "second"} {
+		go func(name string) {
+			c, err := p.get(context.Background())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			order <- name
+			time.Sleep(20 * time.Millisecond)
+			p.put(c)
+		}(name)
+		waitQueued(t, p, k+1)
+	}
+	p.put(conn)
+
+	// 有请求在等待时 后来的请求不能直接取走放回的连接
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err = p.get(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("get error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	for _, want := range []string{"first", "second"} {
+		if got := <-order; got != want {
+			t.Errorf("served %v, want %v", got, want)
+		}
+	}
+	if _, err = p.get(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPoolCanceledWaiter(t *testing.T) {
+	p := &tcpPool{Size: 1}
+	conn, err := p.get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan error, 1)
+	go func() {
+		_, err := p.get(ctx)
+		canceled <- err
+	}()
+	waitQueued(t, p, 1)
+	served := make(chan error, 1)
+	go func() {
+		_, err := p.get(context.Background())
+		served <- err
+	}()
+	waitQueued(t, p, 2)
+
+	// 取消的请求离开队列 连接交给下一个请求
+	cancel()
+	if err = <-canceled; !errors.Is(err, context.Canceled) {
+		t.Fatalf("get error = %v, want %v", err, context.Canceled)
+	}
+	p.put(conn)
+	select {
+	case err = <-served:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("connection was not handed to the next waiter")
+	}
+}
+
+func TestPoolMaxWaitTimeout(t *testing.T) {
+	p := &tcpPool{Size: 1, MaxWait: 10 * time.Millisecond}
+	if _, err := p.get(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	_, err := p.get(context.Background())
+	if !errors.Is(err, ErrTimeout) || !IsRetriable(err) {
+		t.Errorf("get error = %v, want retriable %v", err, ErrTimeout)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.waiters) != 0 {
+		t.Errorf("%v requests still queued", len(p.waiters))
+	}
+}
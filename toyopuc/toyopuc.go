@@ -5,6 +5,7 @@ Package toyopuc provides a client for TOYOPUC.
 */
 
 import (
+	"context"
 	"fmt"
 )
 
@@ -34,16 +35,45 @@ const (
 	FunIOWriteMultipointBit       = 0x27
 
 	// 扩展
-	FunProgramExpansionReadWord    = 0x90
-	FunProgramExpansionWriteWord   = 0x91
-	FunDataExpansionReadWord       = 0x94
-	FunDateExpansionWriteWord      = 0x95
-	FunDataExpansionReadByte       = 0x96
-	FunDataExpansionWriteByte      = 0x97
-	FunDataExpansionReadMultipoint = 0x98
-
-	// TODO
+	FunProgramExpansionReadWord     = 0x90
+	FunProgramExpansionWriteWord    = 0x91
+	FunDataExpansionReadWord        = 0x94
+	FunDateExpansionWriteWord       = 0x95
+	FunDataExpansionReadByte        = 0x96
+	FunDataExpansionWriteByte       = 0x97
+	FunDataExpansionReadMultipoint  = 0x98
 	FunDataExpansionWriteMultipoint = 0x99
+
+	// PC10 扩展模式 32位地址
+	FunPC10ReadBlock       = 0xC2
+	FunPC10WriteBlock      = 0xC3
+	FunPC10ReadMultipoint  = 0xC4
+	FunPC10WriteMultipoint = 0xC5
+	// FR 登录 将 RAM 中的 FR 块写入闪存 数据为 FR 区域号 (0x40 + 块号)
+	FunRegisterFR = 0xCA
+
+	// 命令 数据的前2字节为子命令
+	FunCommand = 0x32
+	// 中继命令 见 RelayPackager
+	FunRelay = 0x60
+)
+
+// 命令 (0x32) 的子命令
+const (
+	// CPU 状态读出
+	SubCommandReadCPUStatus = 0x0011
+	// 运行/停止 切换
+	SubCommandRunStop = 0x0012
+	// 时钟读出
+	SubCommandReadClock = 0x0070
+	// 时钟写入
+	SubCommandWriteClock = 0x0071
+)
+
+// PC10 多点读写的最大点数与数据字节数
+const (
+	PC10MaxPoints = 96
+	PC10MaxData   = 128
 )
 
 // 错误码
@@ -77,16 +107,16 @@ const (
 	ExceptionCodeCommandCannotProceed                        = 0x73
 )
 
-// toyopucError implements error interface.
-// 实现了错误接口
-type toyopucError struct {
+// ExceptionError 响应 RC 不为 0 时的错误
+// 可用 errors.Is(err, ErrAddressNotInRange) 等判断错误码
+type ExceptionError struct {
 	FunctionCode  byte
 	ExceptionCode byte
 }
 
 // Error converts known modbus exception code to error message.
 // 错误 将已知的modbus异常代码转换为错误消息
-func (e *toyopucError) Error() string {
+func (e *ExceptionError) Error() string {
 	var name string
 	switch e.ExceptionCode {
 	case ExceptionCodeHardwareAbnormalityOfCPU:
@@ -168,3 +198,10 @@ type Packager interface {
 type Transporter interface {
 	Send(aduRequest []byte) (aduResponse []byte, err error)
 }
+
+// ContextTransporter 支持 context 中断的传输层
+// 不支持的传输层在发送前检查 ctx
+type ContextTransporter interface {
+	Transporter
+	SendContext(ctx context.Context, aduRequest []byte) (aduResponse []byte, err error)
+}
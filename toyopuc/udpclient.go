@@ -0,0 +1,365 @@
+package toyopuc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// 每个数据报的超时
+	udpTimeout     = 1 * time.Second
+	udpRetries     = 2
+	udpIdleTimeout = 60 * time.Second
+)
+
+// UDPClientHandler implements Packager and Transporter interface.
+// 帧格式与 TCP 相同
+type UDPClientHandler struct {
+	tcpPackager
+	udpTransporter
+}
+
+// NewUDPClientHandler allocates a new UDPClientHandler.
+func NewUDPClientHandler(address string) *UDPClientHandler {
+	h := &UDPClientHandler{}
+	h.Address = address
+	h.Timeout = udpTimeout
+	h.Retries = udpRetries
+	h.IdleTimeout = udpIdleTimeout
+	h.RequestFT = RequestFTByte
+	h.ResponseFTByte = ResponseFTByte
+	return h
+}
+
+// UDPClient creates UDP client with default handler and given connect string.
+func UDPClient(address string) Client {
+	handler := NewUDPClientHandler(address)
+	return NewClient(handler)
+}
+
+// udpTransporter implements Transporter interface.
+type udpTransporter struct {
+	// 链接模块地址
+	Address string
+	// 本地地址 为空时由系统分配端口
+	// 链接模块设置为固定的上位机端口时使用
+	LocalAddress string
+	// 等待每个数据报响应的超时
+	Timeout time.Duration
+	// 超时后重发读出请求的次数
+	// 写入指令与改变 PLC 状态的命令不重发，PLC 可能已执行但响应丢失，是否重试由 RetryPolicy 决定
+	Retries int
+	// Idle timeout to close the socket
+	IdleTimeout time.Duration
+	// Transmission logger
+	Logger *log.Logger
+
+	// 请求的发送权 等待时可以被 ctx 中断
+	sending      sendLock
+	mu           sync.Mutex
+	conn         *net.UDPConn
+	remote       *net.UDPAddr
+	closeTimer   *time.Timer
+	lastActivity time.Time
+	// 重发后可能迟到的重复响应数
+	stale      int
+	staleUntil time.Time
+}
+
+// Send 发送请求并等待匹配的响应
+// 只接受来自链接模块地址、功能码与请求相同、长度正确的数据报，其他的数据报丢弃
+// 读出请求超时后重发，重发 Retries 次后返回超时错误，写入请求超时后直接返回超时错误
+func (toyopuc *udpTransporter) Send(aduRequest []byte) (aduResponse []byte, err error) {
+	return toyopuc.SendContext(context.Background(), aduRequest)
+}
+
+// SendContext 与 Send 相同，ctx 取消或超过期限时中断等待并返回 ctx 的错误
+// 中断后迟到的响应在下一个请求前丢弃
+func (toyopuc *udpTransporter) SendContext(ctx context.Context, aduRequest []byte) (aduResponse []byte, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	if err = toyopuc.sending.lock(ctx); err != nil {
+		return
+	}
+	defer toyopuc.sending.unlock()
+	toyopuc.mu.Lock()
+	defer toyopuc.mu.Unlock()
+
+	if len(aduRequest) <= tcpHeaderSize {
+		err = fmt.Errorf("toyopuc: request length '%v' must be greater than '%v'", len(aduRequest), tcpHeaderSize)
+		return
+	}
+	if err = toyopuc.connect(); err != nil {
+		return
+	}
+	toyopuc.lastActivity = time.Now()
+	toyopuc.startCloseTimer()
+	// 丢弃之前超时或重复的响应
+	toyopuc.flush()
+	// 取消时设置已过期的期限 中断等待
+	defer interruptOnDone(ctx, toyopuc.conn.SetReadDeadline)()
+
+	retries := toyopuc.Retries
+	if isWriteRequest(udpRequest(aduRequest)) {
+		retries = 0
+	}
+	var data [tcpMaxLength + 1]byte
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			toyopuc.logf("toyopuc: retransmitting request (%v/%v)", attempt, retries)
+		}
+		toyopuc.logf("toyopuc: sending % x", aduRequest)
+		if _, err = toyopuc.conn.WriteToUDP(aduRequest, toyopuc.remote); err != nil {
+			return
+		}
+		// ctx 的期限更早时使用 ctx 的期限
+		var deadline time.Time
+		if toyopuc.Timeout > 0 {
+			deadline = time.Now().Add(toyopuc.Timeout)
+		}
+		if d, ok := ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+			deadline = d
+		}
+		if err = toyopuc.conn.SetReadDeadline(deadline); err != nil {
+			return
+		}
+		// 已取消时 监视的 goroutine 设置的期限已被覆盖
+		if ctx.Err() != nil {
+			toyopuc.conn.SetReadDeadline(time.Unix(1, 0))
+		}
+		for {
+			var n int
+			var addr *net.UDPAddr
+			if n, addr, err = toyopuc.conn.ReadFromUDP(data[:]); err != nil {
+				break
+			}
+			if !addr.IP.Equal(toyopuc.remote.IP) || addr.Port != toyopuc.remote.Port {
+				toyopuc.logf("toyopuc: discarding datagram from '%v'", addr)
+				continue
+			}
+			if !udpMatch(aduRequest, data[:n]) {
+				toyopuc.logf("toyopuc: discarding unmatched datagram % x", data[:n])
+				continue
+			}
+			aduResponse = make([]byte, n)
+			copy(aduResponse, data[:n])
+			// 之前的请求可能只是响应慢 其响应会在之后到达
+			if attempt > 0 {
+				toyopuc.stale = attempt
+				toyopuc.staleUntil = time.Now().Add(toyopuc.Timeout)
+			}
+			toyopuc.logf("toyopuc: received % x\n", aduResponse)
+			return
+		}
+		if e := contextError(ctx, nil); e != nil {
+			// 请求的响应可能在之后到达
+			toyopuc.stale = attempt + 1
+			toyopuc.staleUntil = time.Now().Add(toyopuc.Timeout)
+			err = e
+			return
+		}
+		if netError, ok := err.(net.Error); !ok || !netError.Timeout() {
+			return
+		}
+	}
+	return
+}
+
+// udpMatch 响应是否与请求匹配
+// 长度与头中的长度一致，功能码与请求相同，正常响应的数据长度与请求的数量一致
+// 之前超时的读出请求的迟到响应只在数量也相同时无法区分
+func udpMatch(aduRequest, aduResponse []byte) bool {
+	if len(aduResponse) <= tcpHeaderSize || len(aduResponse) > tcpMaxLength {
+		return false
+	}
+	length := int(binary.LittleEndian.Uint16(aduResponse[2:]))
+	if length != len(aduResponse)-tcpHeaderSize {
+		return false
+	}
+	// 请求帧本身 (如广播的回送) 不是响应
+	if bytes.Equal(aduRequest, aduResponse) {
+		return false
+	}
+	if aduResponse[tcpHeaderSize] != aduRequest[tcpHeaderSize] {
+		return false
+	}
+	// 错误响应没有数据
+	if aduResponse[1] != 0x00 {
+		return true
+	}
+	request := &ProtocolDataUnit{FunctionCode: aduRequest[tcpHeaderSize], Data: aduRequest[tcpHeaderSize+1:]}
+	if n, ok := responseLength(request); ok && n != length-1 {
+		return false
+	}
+	return true
+}
+
+// udpRequest 请求帧的 PDU 中继命令时为最内层的请求
+func udpRequest(aduRequest []byte) *ProtocolDataUnit {
+	pdu := &ProtocolDataUnit{FunctionCode: aduRequest[tcpHeaderSize], Data: aduRequest[tcpHeaderSize+1:]}
+	for pdu.FunctionCode == FunRelay && len(pdu.Data) > 3+tcpHeaderSize {
+		frame := pdu.Data[3:]
+		pdu = &ProtocolDataUnit{FunctionCode: frame[tcpHeaderSize], Data: frame[tcpHeaderSize+1:]}
+	}
+	return pdu
+}
+
+// responseLength 正常响应的数据字节数 按请求的数量计算
+// 中继命令、命令等无法由请求确定时 ok 为 false
+func responseLength(request *ProtocolDataUnit) (n int, ok bool) {
+	d := request.Data
+	u16 := func(p int) (int, bool) {
+		if p+2 > len(d) {
+			return 0, false
+		}
+		return int(binary.LittleEndian.Uint16(d[p:])), true
+	}
+	switch request.FunctionCode {
+	case FunSequentialProgramReadWord, FunIOReadWord:
+		n, ok = u16(2)
+		n *= 2
+	case FunProgramExpansionReadWord, FunDataExpansionReadWord:
+		n, ok = u16(3)
+		n *= 2
+	case FunIOReadByte:
+		n, ok = u16(2)
+	case FunDataExpansionReadByte:
+		n, ok = u16(3)
+	case FunPC10ReadBlock:
+		n, ok = u16(4)
+	case FunIOReadBit:
+		n, ok = 1, true
+	case FunIOReadMultipointWord:
+		n, ok = len(d)/2*2, true
+	case FunIOReadMultipointByte, FunIOReadMultipointBit:
+		n, ok = len(d)/2, true
+	case FunDataExpansionReadMultipoint, FunPC10ReadMultipoint:
+		if len(d) >= 3 {
+			n, ok = (int(d[0])+7)/8+int(d[1])+int(d[2])*2, true
+		}
+	default:
+		if isWriteFunction(request.FunctionCode) {
+			n, ok = 0, true
+		}
+	}
+	return
+}
+
+// Connect opens the UDP socket.
+// Connect and Close are exported so that multiple requests can be done with one session
+func (toyopuc *udpTransporter) Connect() error {
+	toyopuc.mu.Lock()
+	defer toyopuc.mu.Unlock()
+
+	return toyopuc.connect()
+}
+
+func (toyopuc *udpTransporter) connect() (err error) {
+	if toyopuc.conn != nil {
+		return
+	}
+	remote, err := net.ResolveUDPAddr("udp", toyopuc.Address)
+	if err != nil {
+		return
+	}
+	var local *net.UDPAddr
+	if toyopuc.LocalAddress != "" {
+		if local, err = net.ResolveUDPAddr("udp", toyopuc.LocalAddress); err != nil {
+			return
+		}
+	}
+	conn, err := net.ListenUDP("udp", local)
+	if err != nil {
+		return
+	}
+	toyopuc.conn = conn
+	toyopuc.remote = remote
+	return
+}
+
+// flush 丢弃已到达但未读取的数据报
+// 上次请求重发过时，等待迟到的重复响应直到 staleUntil
+func (toyopuc *udpTransporter) flush() {
+	deadline := time.Now()
+	if toyopuc.stale > 0 && toyopuc.staleUntil.After(deadline) {
+		deadline = toyopuc.staleUntil
+	}
+	defer func() {
+		toyopuc.stale = 0
+	}()
+	if err := toyopuc.conn.SetReadDeadline(deadline); err != nil {
+		return
+	}
+	var b [tcpMaxLength]byte
+	for {
+		n, addr, err := toyopuc.conn.ReadFromUDP(b[:])
+		if err != nil {
+			return
+		}
+		toyopuc.logf("toyopuc: discarding stale datagram % x", b[:n])
+		if toyopuc.stale > 0 && addr.IP.Equal(toyopuc.remote.IP) && addr.Port == toyopuc.remote.Port {
+			toyopuc.stale--
+			if toyopuc.stale == 0 {
+				if err = toyopuc.conn.SetReadDeadline(time.Now()); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (toyopuc *udpTransporter) startCloseTimer() {
+	if toyopuc.IdleTimeout <= 0 {
+		return
+	}
+	if toyopuc.closeTimer == nil {
+		toyopuc.closeTimer = time.AfterFunc(toyopuc.IdleTimeout, toyopuc.closeIdle)
+	} else {
+		toyopuc.closeTimer.Reset(toyopuc.IdleTimeout)
+	}
+}
+
+// Close closes the UDP socket.
+func (toyopuc *udpTransporter) Close() error {
+	toyopuc.mu.Lock()
+	defer toyopuc.mu.Unlock()
+
+	return toyopuc.close()
+}
+
+func (toyopuc *udpTransporter) logf(format string, v ...interface{}) {
+	if toyopuc.Logger != nil {
+		toyopuc.Logger.Printf(format, v...)
+	}
+}
+
+// close closes the UDP socket. Caller must hold the mutex before calling this method.
+func (toyopuc *udpTransporter) close() (err error) {
+	if toyopuc.conn != nil {
+		err = toyopuc.conn.Close()
+		toyopuc.conn = nil
+	}
+	return
+}
+
+// closeIdle closes the socket if last activity is passed behind IdleTimeout.
+func (toyopuc *udpTransporter) closeIdle() {
+	toyopuc.mu.Lock()
+	defer toyopuc.mu.Unlock()
+
+	if toyopuc.IdleTimeout <= 0 {
+		return
+	}
+	idle := time.Since(toyopuc.lastActivity)
+	if idle >= toyopuc.IdleTimeout {
+		toyopuc.logf("toyopuc: closing socket due to idle timeout: %v", idle)
+		toyopuc.close()
+	}
+}